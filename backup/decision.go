@@ -0,0 +1,24 @@
+package backup
+
+import "time"
+
+type Decision struct {
+	Name    string
+	LastRun time.Time
+	NextRun time.Time
+	Run     bool
+	Reason  string
+	Err     error
+}
+
+type Decisions []Decision
+
+func (d Decisions) Len() int {
+	return len(d)
+}
+func (d Decisions) Swap(i, j int) {
+	d[i], d[j] = d[j], d[i]
+}
+func (d Decisions) Less(i, j int) bool {
+	return d[i].Name < d[j].Name
+}
@@ -0,0 +1,34 @@
+package backup
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDecisionsSort(t *testing.T) {
+	t.Parallel()
+
+	decisions := Decisions{
+		{Name: "test c", Run: true},
+		{Name: "test a"},
+		{Name: "test b"},
+	}
+	if decisions.Len() != 3 {
+		t.Errorf("expected 3 decisions, got %d", decisions.Len())
+	}
+	if decisions.Less(0, 1) {
+		t.Errorf("expected decision 1 to be less than 0")
+	}
+
+	sort.Sort(decisions)
+
+	expected := Decisions{
+		{Name: "test a"},
+		{Name: "test b"},
+		{Name: "test c", Run: true},
+	}
+	if !reflect.DeepEqual(decisions, expected) {
+		t.Errorf("expected %v, got %v", expected, decisions)
+	}
+}
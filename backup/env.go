@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Reads `NAME=value` lines from a dotenv-style file. Blank lines and lines starting with `#` are ignored,
+// an optional `export ` prefix is dropped and values enclosed in matching quotes are unquoted.
+func readEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	env := []string{}
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sep := strings.IndexByte(line, '=')
+		if sep == -1 {
+			return nil, fmt.Errorf("%s:%d: expected NAME=value", path, lineNo)
+		}
+
+		name := strings.TrimSpace(strings.TrimPrefix(line[:sep], "export "))
+		if name == "" {
+			return nil, fmt.Errorf("%s:%d: variable name is empty", path, lineNo)
+		}
+
+		value := strings.TrimSpace(line[sep+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env = append(env, name+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// Builds the environment of the command. Variables inherited from the current process are overridden by
+// those read from the env file, which are in turn overridden by those set in the task configuration.
+func (t Task) environment() ([]string, error) {
+	values := map[string]string{}
+	set := func(entries []string) {
+		for _, entry := range entries {
+			if sep := strings.IndexByte(entry, '='); sep != -1 {
+				values[entry[:sep]] = entry[sep+1:]
+			} else if value, ok := os.LookupEnv(entry); ok {
+				values[entry] = value
+			}
+		}
+	}
+
+	for _, entry := range os.Environ() {
+		if sep := strings.IndexByte(entry, '='); sep > 0 && t.inheritEnv.Inherits(entry[:sep], t.envAllowlist) {
+			values[entry[:sep]] = entry[sep+1:]
+		}
+	}
+	if t.envFile != "" {
+		fileEnv, err := readEnvFile(t.envFile)
+		if err != nil {
+			return nil, err
+		}
+		set(fileEnv)
+	}
+	set(t.env)
+
+	env := make([]string, 0, len(values))
+	for name, value := range values {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+
+	return env, nil
+}
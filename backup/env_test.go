@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chialab/streamlined-backup/config"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	t.Parallel()
+
+	data := `
+# Database credentials
+PGUSER=backup
+export PGPASSWORD="s3cr3t=="
+PGDATABASE = 'my_database'
+EMPTY=
+`
+	filePath := path.Join(t.TempDir(), "backup.env")
+	if err := os.WriteFile(filePath, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"PGUSER=backup", "PGPASSWORD=s3cr3t==", "PGDATABASE=my_database", "EMPTY="}
+	if env, err := readEnvFile(filePath); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %#v, got %#v", expected, env)
+	}
+}
+
+func TestReadEnvFileError(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	testCases := map[string]string{
+		"missing_separator": "FOO=bar\nBAZ\n",
+		"empty_name":        "=bar\n",
+	}
+	expected := map[string]string{
+		"missing_separator": ":2: expected NAME=value",
+		"empty_name":        ":1: variable name is empty",
+	}
+	for name, data := range testCases {
+		filePath := path.Join(tmpDir, name+".env")
+		if err := os.WriteFile(filePath, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if env, err := readEnvFile(filePath); err == nil {
+			t.Errorf("%s: expected error, got %#v", name, env)
+		} else if err.Error() != filePath+expected[name] {
+			t.Errorf("%s: expected %s, got %s", name, filePath+expected[name], err)
+		}
+	}
+
+	if _, err := readEnvFile(path.Join(tmpDir, "missing.env")); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %#v", err)
+	}
+}
+
+func TestTaskEnvironment(t *testing.T) {
+	t.Setenv("STREAMLINED_BACKUP_TEST_PATH", "/usr/bin")
+	t.Setenv("STREAMLINED_BACKUP_TEST_SECRET", "secret")
+	t.Setenv("STREAMLINED_BACKUP_TEST_FOO", "inherited")
+
+	envFile := path.Join(t.TempDir(), "backup.env")
+	if err := os.WriteFile(envFile, []byte("STREAMLINED_BACKUP_TEST_FOO=file\nSTREAMLINED_BACKUP_TEST_BAR=file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		expected []string
+		task     Task
+	}
+	testCases := map[string]testCase{
+		"all": {
+			expected: []string{
+				"STREAMLINED_BACKUP_TEST_FOO=inherited",
+				"STREAMLINED_BACKUP_TEST_PATH=/usr/bin",
+				"STREAMLINED_BACKUP_TEST_SECRET=secret",
+			},
+			task: Task{inheritEnv: config.InheritEnvAll},
+		},
+		"none": {
+			expected: []string{"STREAMLINED_BACKUP_TEST_BAR=env"},
+			task:     Task{inheritEnv: config.InheritEnvNone, env: []string{"STREAMLINED_BACKUP_TEST_BAR=env"}},
+		},
+		"allowlist": {
+			expected: []string{
+				"STREAMLINED_BACKUP_TEST_BAR=env",
+				"STREAMLINED_BACKUP_TEST_PATH=/usr/bin",
+			},
+			task: Task{
+				inheritEnv:   config.InheritEnvAllowlist,
+				envAllowlist: []string{"STREAMLINED_BACKUP_TEST_P*"},
+				env:          []string{"STREAMLINED_BACKUP_TEST_BAR=env"},
+			},
+		},
+		"merged": {
+			expected: []string{
+				"STREAMLINED_BACKUP_TEST_BAR=file",
+				"STREAMLINED_BACKUP_TEST_FOO=env",
+				"STREAMLINED_BACKUP_TEST_SECRET=secret",
+			},
+			task: Task{
+				inheritEnv: config.InheritEnvNone,
+				envFile:    envFile,
+				env:        []string{"STREAMLINED_BACKUP_TEST_FOO=env", "STREAMLINED_BACKUP_TEST_SECRET"},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			env, err := tc.task.environment()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			actual := []string{}
+			for _, entry := range env {
+				if strings.HasPrefix(entry, "STREAMLINED_BACKUP_TEST_") {
+					actual = append(actual, entry)
+				}
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, actual)
+			}
+			if tc.task.inheritEnv == config.InheritEnvNone && len(actual) != len(env) {
+				t.Errorf("expected no inherited variables, got %#v", env)
+			}
+		})
+	}
+}
+
+func TestRunEnvironmentError(t *testing.T) {
+	t.Parallel()
+
+	handler := &testHandler{}
+	logger, lines := newTestLogger()
+	task := &Task{
+		command: [][]string{{"env"}},
+		envFile: path.Join(t.TempDir(), "missing.env"),
+		handler: handler,
+		logger:  logger,
+	}
+
+	if res := task.Run(time.Now(), false); res.Status() != StatusFailed {
+		t.Errorf("expected failed result, got %+v", res)
+	} else if !IsTaskError(res.Error(), CommandStartError) {
+		t.Errorf("expected command start error, got %#v", res.Error())
+	}
+	if logs := lines(); len(logs) != 1 || !strings.HasPrefix(logs[0], "ERROR (Command environment): ") {
+		t.Errorf("expected environment error to be logged, got %q", logs)
+	}
+}
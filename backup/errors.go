@@ -10,13 +10,36 @@ import (
 type ErrorCode int
 
 const (
-	HandlerError = iota
+	HandlerError ErrorCode = iota
 	CommandStartError
 	CommandFailedError
 	CommandTimeoutError
 	CommandKillError
+	HookError
+	SuspiciousArtifactError
 )
 
+func (c ErrorCode) String() string {
+	switch c {
+	case HandlerError:
+		return "handler"
+	case CommandStartError:
+		return "command_start"
+	case CommandFailedError:
+		return "command_failed"
+	case CommandTimeoutError:
+		return "command_timeout"
+	case CommandKillError:
+		return "command_kill"
+	case HookError:
+		return "hook"
+	case SuspiciousArtifactError:
+		return "suspicious_artifact"
+	}
+
+	return fmt.Sprintf("unknown_%d", int(c))
+}
+
 type TaskError struct {
 	code     ErrorCode
 	format   string
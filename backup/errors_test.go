@@ -50,7 +50,7 @@ func TestTaskError(t *testing.T) {
 					t.Errorf("expected previous error %s, got %s", tc.previous, err.Unwrap())
 				}
 
-				var previous error
+				var previous interface{ Error() string }
 				if !errors.As(err, &previous) {
 					t.Errorf("expected previous error %s, got %s", tc.previous, err.Unwrap())
 				}
@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/chialab/streamlined-backup/config"
+	"github.com/chialab/streamlined-backup/handler"
+	"github.com/chialab/streamlined-backup/utils"
+)
+
+// Checks on the size of artifacts, to detect runs that completed successfully but produced unexpected output.
+// Zero values disable the corresponding check.
+type sizeGuards struct {
+	minSize       int64
+	maxSize       int64
+	changePercent int
+	action        config.SuspiciousAction
+}
+
+func newSizeGuards(def config.Task) (sizeGuards, error) {
+	guards := sizeGuards{changePercent: def.MaxSizeChangePercent, action: def.OnSuspicious}
+	if def.MinSize != "" {
+		size, err := utils.ParseBytes(def.MinSize)
+		if err != nil {
+			return guards, err
+		}
+		guards.minSize = size
+	}
+	if def.MaxSize != "" {
+		size, err := utils.ParseBytes(def.MaxSize)
+		if err != nil {
+			return guards, err
+		}
+		guards.maxSize = size
+	}
+
+	return guards, nil
+}
+
+func (g sizeGuards) needsPrevious() bool {
+	return g.changePercent > 0
+}
+
+// Reports why an artifact of the given size is suspicious, or nil if it passes all checks.
+func (g sizeGuards) check(size int64, previous handler.Artifact) error {
+	if g.minSize > 0 && size < g.minSize {
+		return fmt.Errorf("artifact size %s is below min_size %s", utils.FormatBytes(size), utils.FormatBytes(g.minSize))
+	} else if g.maxSize > 0 && size > g.maxSize {
+		return fmt.Errorf("artifact size %s is above max_size %s", utils.FormatBytes(size), utils.FormatBytes(g.maxSize))
+	} else if g.changePercent > 0 && !previous.Timestamp.IsZero() && previous.Size == 0 {
+		// An empty previous artifact is itself suspicious, and no change can be measured against it.
+		return fmt.Errorf("artifact size %s cannot be compared with the previous artifact, which is empty", utils.FormatBytes(size))
+	} else if g.changePercent > 0 && previous.Size > 0 {
+		change := math.Abs(float64(size-previous.Size)) / float64(previous.Size) * 100
+		if change > float64(g.changePercent) {
+			return fmt.Errorf("artifact size %s differs by %.1f%% from the previous artifact (%s), more than max_size_change_percent %d%%", utils.FormatBytes(size), change, utils.FormatBytes(previous.Size), g.changePercent)
+		}
+	}
+
+	return nil
+}
+
+func (g sizeGuards) completion() handler.Completion {
+	switch g.action {
+	case config.SuspiciousTag:
+		return handler.CompleteUploadTagged
+	case config.SuspiciousAbort:
+		return handler.AbortUpload
+	}
+
+	return handler.CompleteUpload
+}
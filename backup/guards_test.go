@@ -0,0 +1,114 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chialab/streamlined-backup/config"
+	"github.com/chialab/streamlined-backup/handler"
+)
+
+func TestNewSizeGuards(t *testing.T) {
+	t.Parallel()
+
+	guards, err := newSizeGuards(config.Task{MinSize: "1 KiB", MaxSize: "2GB", MaxSizeChangePercent: 50, OnSuspicious: config.SuspiciousTag})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := sizeGuards{minSize: 1 << 10, maxSize: 2e9, changePercent: 50, action: config.SuspiciousTag}
+	if guards != expected {
+		t.Errorf("expected %#v, got %#v", expected, guards)
+	}
+	if !guards.needsPrevious() {
+		t.Errorf("expected previous artifact to be needed")
+	}
+	if completion := guards.completion(); completion != handler.CompleteUploadTagged {
+		t.Errorf("expected %d, got %d", handler.CompleteUploadTagged, completion)
+	}
+}
+
+func TestNewSizeGuardsError(t *testing.T) {
+	t.Parallel()
+
+	expectedErr := `invalid size "10 ten": unknown unit`
+	for _, def := range []config.Task{{MinSize: "10 ten"}, {MaxSize: "10 ten"}} {
+		if guards, err := newSizeGuards(def); err == nil {
+			t.Errorf("expected error, got %#v", guards)
+		} else if err.Error() != expectedErr {
+			t.Errorf("expected %s, got %s", expectedErr, err)
+		}
+	}
+}
+
+func TestSizeGuardsCheck(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		guards      sizeGuards
+		size        int64
+		previous    int64
+		previousRun time.Time
+		expected    string
+	}
+	testCases := map[string]testCase{
+		"no_guards": {
+			guards: sizeGuards{},
+			size:   0,
+		},
+		"above_min_size": {
+			guards: sizeGuards{minSize: 1 << 20},
+			size:   8 << 30,
+		},
+		"below_min_size": {
+			guards:   sizeGuards{minSize: 1 << 20},
+			size:     20 << 10,
+			expected: "artifact size 20.0 KiB is below min_size 1.0 MiB",
+		},
+		"above_max_size": {
+			guards:   sizeGuards{maxSize: 1 << 30},
+			size:     8 << 30,
+			expected: "artifact size 8.0 GiB is above max_size 1.0 GiB",
+		},
+		"within_change": {
+			guards:   sizeGuards{changePercent: 20},
+			size:     110,
+			previous: 100,
+		},
+		"shrunk": {
+			guards:   sizeGuards{changePercent: 20},
+			size:     20 << 10,
+			previous: 8 << 30,
+			expected: "artifact size 20.0 KiB differs by 100.0% from the previous artifact (8.0 GiB), more than max_size_change_percent 20%",
+		},
+		"grown": {
+			guards:   sizeGuards{changePercent: 20},
+			size:     150,
+			previous: 100,
+			expected: "artifact size 150 B differs by 50.0% from the previous artifact (100 B), more than max_size_change_percent 20%",
+		},
+		"no_previous": {
+			guards: sizeGuards{changePercent: 20},
+			size:   150,
+		},
+		"empty_previous": {
+			guards:      sizeGuards{changePercent: 20},
+			size:        150,
+			previousRun: time.Date(2021, 8, 17, 9, 30, 0, 0, time.UTC),
+			expected:    "artifact size 150 B cannot be compared with the previous artifact, which is empty",
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.guards.check(tc.size, handler.Artifact{Timestamp: tc.previousRun, Size: tc.previous})
+			if tc.expected == "" && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			} else if tc.expected != "" && (err == nil || err.Error() != tc.expected) {
+				t.Errorf("expected %s, got %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chialab/streamlined-backup/utils"
+)
+
+const HEARTBEAT_TIMEOUT = time.Second * 10
+
+// Maximum size of the log tail sent with pings, which is the default limit of healthchecks.io.
+const HEARTBEAT_MAX_BODY = 10000
+
+// Dead man's switch URLs, in the style of healthchecks.io: `/start` is pinged when a run starts, the URL itself
+// when it succeeds, and `/fail` when it does not. A monitor that receives no ping also detects runs that never
+// happened at all.
+type heartbeat struct {
+	urls   []string
+	client *http.Client
+}
+
+func newHeartbeat(urls []string) heartbeat {
+	return heartbeat{urls: urls, client: &http.Client{Timeout: HEARTBEAT_TIMEOUT}}
+}
+
+func (h heartbeat) start(logger *utils.Logger) {
+	h.ping(logger, "/start", "")
+}
+
+// Sends the tail of the logs, preceded by the error for runs that did not succeed.
+func (h heartbeat) finish(logger *utils.Logger, result Result) {
+	if result.status == StatusSuccess {
+		h.ping(logger, "", logTail(result.logs, HEARTBEAT_MAX_BODY))
+
+		return
+	}
+
+	message := ""
+	if result.err != nil {
+		message = strings.TrimSpace(result.err.Error()) + "\n\n"
+	}
+
+	h.ping(logger, "/fail", message+logTail(result.logs, HEARTBEAT_MAX_BODY-len(message)))
+}
+
+// Failed pings are logged, as they must not affect the outcome of the task.
+func (h heartbeat) ping(logger *utils.Logger, suffix string, body string) {
+	for _, heartbeat := range h.urls {
+		if err := h.send(heartbeat, suffix, body); err != nil {
+			logger.Error("Heartbeat failed", err)
+		}
+	}
+}
+
+func (h heartbeat) send(heartbeat string, suffix string, body string) error {
+	u, err := url.Parse(heartbeat)
+	if err != nil {
+		return err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + suffix
+
+	response, err := h.client.Post(u.String(), "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		// Transport errors include the full URL, which must not be logged.
+		if urlErr := new(url.Error); errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return fmt.Errorf("error sending heartbeat to %s: %w", redactHeartbeat(u, suffix), err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("error sending heartbeat to %s: %s", redactHeartbeat(u, suffix), response.Status)
+	}
+
+	return nil
+}
+
+// Describes a heartbeat URL without its path and credentials, as the path usually identifies the check and
+// is enough to ping it.
+func redactHeartbeat(u *url.URL, suffix string) string {
+	return fmt.Sprintf("%s://%s/[REDACTED]%s", u.Scheme, u.Host, suffix)
+}
+
+// Joins the last lines that fit in maxBytes.
+func logTail(lines []string, maxBytes int) string {
+	size, first := 0, len(lines)
+	for first > 0 && size+len(lines[first-1])+1 <= maxBytes {
+		first--
+		size += len(lines[first]) + 1
+	}
+
+	return strings.Join(lines[first:], "\n")
+}
@@ -0,0 +1,261 @@
+package backup
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chialab/streamlined-backup/utils"
+)
+
+type heartbeatPing struct {
+	path string
+	body string
+}
+
+func TestLogTail(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		lines    []string
+		maxBytes int
+		expected string
+	}{
+		"empty":     {lines: []string{}, maxBytes: 10, expected: ""},
+		"fits":      {lines: []string{"foo", "bar"}, maxBytes: 10, expected: "foo\nbar"},
+		"truncated": {lines: []string{"foo", "bar", "baz"}, maxBytes: 8, expected: "bar\nbaz"},
+		"too_long":  {lines: []string{"foo", "barbazqux"}, maxBytes: 8, expected: ""},
+		"negative":  {lines: []string{"foo"}, maxBytes: -2, expected: ""},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := logTail(tc.lines, tc.maxBytes); actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	mutex := sync.Mutex{}
+	pings := []heartbeatPing{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		pings = append(pings, heartbeatPing{path: r.URL.Path, body: string(body)})
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	logger, lines := newTestLogger()
+	heartbeat := newHeartbeat([]string{ts.URL + "/uuid/"})
+	heartbeat.start(logger)
+	heartbeat.finish(logger, NewResultSuccess(&Task{}, []string{"foo", "bar"}))
+	heartbeat.finish(logger, NewResultFailed(&Task{}, errors.New("test error\n"), []string{"foo"}))
+	heartbeat.finish(logger, NewResultTimeout(&Task{}, []string{}))
+
+	expected := []heartbeatPing{
+		{path: "/uuid/start", body: ""},
+		{path: "/uuid", body: "foo\nbar"},
+		{path: "/uuid/fail", body: "test error\n\nfoo"},
+		{path: "/uuid/fail", body: ""},
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !reflect.DeepEqual(pings, expected) {
+		t.Errorf("expected %#v, got %#v", expected, pings)
+	}
+	if logs := lines(); len(logs) != 0 {
+		t.Errorf("expected no logs, got %q", logs)
+	}
+}
+
+func TestHeartbeatError(t *testing.T) {
+	t.Parallel()
+
+	mutex := sync.Mutex{}
+	pings := []heartbeatPing{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		pings = append(pings, heartbeatPing{path: r.URL.Path, body: string(body)})
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	logger, lines := newTestLogger()
+	heartbeat := newHeartbeat([]string{ts.URL + "/missing", ts.URL + "/other"})
+	heartbeat.start(logger)
+
+	expected := []string{
+		"ERROR (Heartbeat failed): error sending heartbeat to " + ts.URL + "/[REDACTED]/start: 404 Not Found",
+		"ERROR (Heartbeat failed): error sending heartbeat to " + ts.URL + "/[REDACTED]/start: 404 Not Found",
+	}
+	if logs := lines(); !reflect.DeepEqual(logs, expected) {
+		t.Errorf("expected %q, got %q", expected, logs)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(pings) != 2 {
+		t.Errorf("expected all URLs to be pinged, got %#v", pings)
+	}
+}
+
+func TestHeartbeatTransportError(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	logger, lines := newTestLogger()
+	heartbeat := newHeartbeat([]string{ts.URL + "/secret-uuid"})
+	heartbeat.start(logger)
+
+	logs := lines()
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log line, got %q", logs)
+	} else if prefix := "ERROR (Heartbeat failed): error sending heartbeat to " + ts.URL + "/[REDACTED]/start: "; !strings.HasPrefix(logs[0], prefix) {
+		t.Errorf("expected log starting with %q, got %q", prefix, logs[0])
+	} else if strings.Contains(logs[0], "secret-uuid") {
+		t.Errorf("expected URL to be redacted, got %q", logs[0])
+	}
+}
+
+func TestTaskRunHeartbeatLastRunError(t *testing.T) {
+	t.Parallel()
+
+	mutex := sync.Mutex{}
+	pings := []heartbeatPing{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		pings = append(pings, heartbeatPing{path: r.URL.Path, body: string(body)})
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	schedule, err := utils.NewSchedule("0,30 * * * *")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	logger, _ := newTestLogger()
+	task := &Task{
+		schedule:  *schedule,
+		command:   [][]string{{"echo", "foo"}},
+		heartbeat: newHeartbeat([]string{ts.URL + "/uuid"}),
+		handler:   &testHandler{lastRunErr: errors.New("test error")},
+		logger:    logger,
+	}
+
+	if result := task.Run(time.Now(), false); result.Status() != StatusFailed {
+		t.Errorf("expected status %s, got %s", StatusFailed, result.Status())
+	}
+
+	expected := []heartbeatPing{{path: "/uuid/fail", body: "test error\n\n"}}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !reflect.DeepEqual(pings, expected) {
+		t.Errorf("expected %#v, got %#v", expected, pings)
+	}
+}
+
+func TestTaskRunnerHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		command  [][]string
+		status   int
+		result   Status
+		expected []heartbeatPing
+		logs     []string
+	}{
+		"success": {
+			command:  [][]string{{"bash", "-c", "echo foo && echo bar >&2"}},
+			status:   http.StatusOK,
+			result:   StatusSuccess,
+			expected: []heartbeatPing{{path: "/uuid/start"}, {path: "/uuid", body: "bar"}},
+			logs:     []string{"bar", "DONE"},
+		},
+		"failed": {
+			command:  [][]string{{"bash", "-c", "echo oops >&2 && exit 3"}},
+			status:   http.StatusOK,
+			result:   StatusFailed,
+			expected: []heartbeatPing{{path: "/uuid/start"}, {path: "/uuid/fail", body: "command failed: exit status 3\n\noops"}},
+			logs:     []string{"oops", "ERROR (Command failed): exit status 3"},
+		},
+		"ping_failed": {
+			command:  [][]string{{"echo", "foo"}},
+			status:   http.StatusInternalServerError,
+			result:   StatusSuccess,
+			expected: []heartbeatPing{{path: "/uuid/start"}, {path: "/uuid"}},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			mutex := sync.Mutex{}
+			pings := []heartbeatPing{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				pings = append(pings, heartbeatPing{path: r.URL.Path, body: string(body)})
+
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+
+			logger, lines := newTestLogger()
+			task := &Task{
+				command:   tc.command,
+				heartbeat: newHeartbeat([]string{ts.URL + "/uuid"}),
+				handler:   &testHandler{},
+				logger:    logger,
+			}
+
+			if result := task.runner(time.Now()); result.Status() != tc.result {
+				t.Errorf("expected status %s, got %s", tc.result, result.Status())
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if !reflect.DeepEqual(pings, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, pings)
+			}
+
+			logs := lines()
+			if tc.status != http.StatusOK {
+				tc.logs = []string{
+					"ERROR (Heartbeat failed): error sending heartbeat to " + ts.URL + "/[REDACTED]/start: 500 Internal Server Error",
+					"DONE",
+					"ERROR (Heartbeat failed): error sending heartbeat to " + ts.URL + "/[REDACTED]: 500 Internal Server Error",
+				}
+			}
+			if !reflect.DeepEqual(logs, tc.logs) {
+				t.Errorf("expected logs %q, got %q", tc.logs, logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package backup
+
+import (
+	"errors"
+
+	"github.com/chialab/streamlined-backup/config"
+)
+
+var ErrUnsupportedProcessOption = errors.New("not supported on this platform")
+
+// User, priorities and resource limits the processes of a command are run with. Unset values are inherited
+// from the backup process.
+type processOptions struct {
+	user    string
+	group   string
+	nice    *int
+	ionice  *config.IONice
+	rlimits *config.Rlimits
+}
+
+func (o processOptions) hasLimits() bool {
+	return o.nice != nil || o.ionice != nil || o.rlimits != nil
+}
@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/chialab/streamlined-backup/config"
+)
+
+const (
+	ioprioWhoProcess   = 1
+	ioprioClassShift   = 13
+	ioprioDefaultLevel = 4
+)
+
+var ioprioClasses = map[config.IONiceClass]uintptr{
+	config.IONiceRealtime:   1,
+	config.IONiceBestEffort: 2,
+	config.IONiceIdle:       3,
+}
+
+// Applies priorities and resource limits to a process started by startProcess, before it executes the command.
+func applyProcessLimits(pid int, options processOptions) error {
+	if options.nice != nil {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, *options.nice); err != nil {
+			return fmt.Errorf("nice: %w", err)
+		}
+	}
+
+	if options.ionice != nil {
+		level := uintptr(ioprioDefaultLevel)
+		if options.ionice.Priority != nil {
+			level = uintptr(*options.ionice.Priority)
+		} else if options.ionice.Class == config.IONiceIdle {
+			level = 0
+		}
+		prio := ioprioClasses[options.ionice.Class]<<ioprioClassShift | level
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), prio); errno != 0 {
+			return fmt.Errorf("ionice: %w", errno)
+		}
+	}
+
+	if options.rlimits != nil {
+		limits := []struct {
+			name     string
+			resource int
+			value    *uint64
+		}{
+			{"open_files", syscall.RLIMIT_NOFILE, options.rlimits.OpenFiles},
+			{"address_space", syscall.RLIMIT_AS, options.rlimits.AddressSpace},
+		}
+		for _, limit := range limits {
+			if limit.value == nil {
+				continue
+			}
+
+			rlimit := syscall.Rlimit{Cur: *limit.value, Max: *limit.value}
+			if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(limit.resource), uintptr(unsafe.Pointer(&rlimit)), 0, 0, 0); errno != 0 {
+				return fmt.Errorf("rlimits.%s: %w", limit.name, errno)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package backup
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/chialab/streamlined-backup/config"
+)
+
+func TestTaskExecProcessOptions(t *testing.T) {
+	t.Parallel()
+
+	nice, priority, openFiles, addressSpace := 5, 6, uint64(256), uint64(1<<30)
+	type testCase struct {
+		options processOptions
+		command string
+		root    bool
+		stdout  string
+	}
+	testCases := map[string]testCase{
+		"nice": {
+			options: processOptions{nice: &nice},
+			command: "nice",
+			stdout:  "5\n",
+		},
+		"ionice_idle": {
+			options: processOptions{ionice: &config.IONice{Class: config.IONiceIdle}},
+			command: "ionice",
+			stdout:  "idle\n",
+		},
+		"ionice_best_effort": {
+			options: processOptions{ionice: &config.IONice{Class: config.IONiceBestEffort, Priority: &priority}},
+			command: "ionice",
+			stdout:  "best-effort: prio 6\n",
+		},
+		"rlimits": {
+			options: processOptions{rlimits: &config.Rlimits{OpenFiles: &openFiles, AddressSpace: &addressSpace}},
+			command: "ulimit -n; ulimit -v",
+			stdout:  "256\n1048576\n",
+		},
+		"children": {
+			options: processOptions{nice: &nice, rlimits: &config.Rlimits{OpenFiles: &openFiles}},
+			command: "(nice; ulimit -n) | cat",
+			stdout:  "5\n256\n",
+		},
+		"user": {
+			options: processOptions{user: "nobody"},
+			command: "id -un",
+			root:    true,
+			stdout:  "nobody\n",
+		},
+		"numeric_user_and_group": {
+			options: processOptions{user: "65534", group: "0"},
+			command: "id -u; id -g",
+			root:    true,
+			stdout:  "65534\n0\n",
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.root && os.Getuid() != 0 {
+				t.Skip("changing user requires root")
+			}
+
+			logger, lines := newTestLogger()
+			task := &Task{timeout: DEFAULT_TIMEOUT, logger: logger}
+			stdout := bytes.NewBuffer(nil)
+
+			command := config.Command{{"bash", "-c", tc.command}}
+			if _, err := task.exec("Command", command, tc.options, stdout, bytes.NewBuffer(nil)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if data := stdout.String(); data != tc.stdout {
+				t.Errorf("expected stdout %q, got %q", tc.stdout, data)
+			}
+			if logs := lines(); len(logs) != 0 {
+				t.Errorf("expected no logs, got %q", logs)
+			}
+		})
+	}
+}
+
+func TestTaskExecProcessOptionsError(t *testing.T) {
+	t.Parallel()
+
+	logger, lines := newTestLogger()
+	task := &Task{timeout: DEFAULT_TIMEOUT, logger: logger}
+	options := processOptions{user: "streamlined-backup-missing"}
+
+	stages, err := task.exec("Command", config.Command{{"true"}}, options, bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+	expectedErr := `command could not be started: unknown user "streamlined-backup-missing"`
+	if !IsTaskError(err, CommandStartError) {
+		t.Errorf("expected start error, got %+v", err)
+	} else if err.Error() != expectedErr {
+		t.Errorf("expected %s, got %s", expectedErr, err)
+	}
+	if len(stages) != 1 || stages[0].ExitCode() != -1 {
+		t.Errorf("expected command not to be started, got %#v", stages)
+	}
+
+	expectedLogs := []string{`ERROR (Command start): unknown user "streamlined-backup-missing"`}
+	if logs := lines(); !reflect.DeepEqual(logs, expectedLogs) {
+		t.Errorf("expected logs %q, got %q", expectedLogs, logs)
+	}
+}
+
+func TestTaskExecProcessOptionsNotFound(t *testing.T) {
+	t.Parallel()
+
+	logger, _ := newTestLogger()
+	task := &Task{timeout: DEFAULT_TIMEOUT, logger: logger}
+	nice := 5
+
+	stages, err := task.exec("Command", config.Command{{"streamlined-backup-missing"}}, processOptions{nice: &nice}, bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+	expectedErr := `command could not be started: exec: "streamlined-backup-missing": executable file not found in $PATH`
+	if !IsTaskError(err, CommandStartError) {
+		t.Errorf("expected start error, got %+v", err)
+	} else if err.Error() != expectedErr {
+		t.Errorf("expected %s, got %s", expectedErr, err)
+	}
+	if len(stages) != 1 || stages[0].ExitCode() != -1 {
+		t.Errorf("expected command not to be started, got %#v", stages)
+	}
+}
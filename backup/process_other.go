@@ -0,0 +1,27 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package backup
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Applies priorities and resource limits to a process started by startProcess, before it executes the command.
+// Only the nice value is supported: IO priorities and limits of other processes cannot be set on this platform.
+func applyProcessLimits(pid int, options processOptions) error {
+	if options.ionice != nil {
+		return fmt.Errorf("ionice: %w", ErrUnsupportedProcessOption)
+	} else if options.rlimits != nil {
+		return fmt.Errorf("rlimits: %w", ErrUnsupportedProcessOption)
+	}
+
+	if options.nice != nil {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, *options.nice); err != nil {
+			return fmt.Errorf("nice: %w", err)
+		}
+	}
+
+	return nil
+}
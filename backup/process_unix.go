@@ -0,0 +1,131 @@
+//go:build !windows
+// +build !windows
+
+package backup
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// Shell script executing its arguments once a line is read from the file descriptor it is given, and exiting
+// if the file is closed first.
+const limitsTrampoline = `IFS= read -r _ <&%[1]d || exit 126; exec %[1]d<&-; exec "$@"`
+
+// Starts the command in a process group of its own, so that it can be signaled along with its children.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func signalProcessGroup(process *os.Process, sig syscall.Signal) error {
+	if err := syscall.Kill(-process.Pid, sig); err != nil && err != syscall.ESRCH {
+		return err
+	}
+
+	return nil
+}
+
+// Runs the command as the configured user and group. When only the user is set, its primary group and
+// supplementary groups are used, like login would.
+func setProcessCredential(cmd *exec.Cmd, options processOptions) error {
+	if options.user == "" && options.group == "" {
+		return nil
+	}
+
+	credential := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid()), NoSetGroups: true}
+	if options.user != "" {
+		u, err := user.Lookup(options.user)
+		if _, ok := err.(user.UnknownUserError); ok {
+			u, err = user.LookupId(options.user)
+		}
+		if err != nil {
+			return fmt.Errorf("unknown user %q", options.user)
+		}
+
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid uid of user %q: %w", options.user, err)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid gid of user %q: %w", options.user, err)
+		}
+		credential.Uid, credential.Gid = uint32(uid), uint32(gid)
+
+		credential.Groups, credential.NoSetGroups = []uint32{uint32(gid)}, false
+		if groupIds, err := u.GroupIds(); err == nil {
+			credential.Groups = credential.Groups[:0]
+			for _, groupId := range groupIds {
+				if gid, err := strconv.ParseUint(groupId, 10, 32); err == nil {
+					credential.Groups = append(credential.Groups, uint32(gid))
+				}
+			}
+		}
+	}
+	if options.group != "" {
+		g, err := user.LookupGroup(options.group)
+		if _, ok := err.(user.UnknownGroupError); ok {
+			g, err = user.LookupGroupId(options.group)
+		}
+		if err != nil {
+			return fmt.Errorf("unknown group %q", options.group)
+		}
+
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid gid of group %q: %w", options.group, err)
+		}
+		credential.Gid = uint32(gid)
+	}
+	cmd.SysProcAttr.Credential = credential
+
+	return nil
+}
+
+// Starts the command. When it has priorities or resource limits, a shell is started instead, which waits for
+// them to be applied before executing the command: neither the command nor the processes it spawns ever run
+// without them. On error, no process is left running.
+func startProcess(cmd *exec.Cmd, options processOptions) error {
+	if !options.hasLimits() {
+		return cmd.Start()
+	} else if filepath.Base(cmd.Path) == cmd.Path {
+		// Commands that are not found are reported as Start would.
+		if _, err := exec.LookPath(cmd.Path); err != nil {
+			return err
+		}
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, reader)
+	cmd.Args = append([]string{"sh", "-c", fmt.Sprintf(limitsTrampoline, fd), "sh", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	err = cmd.Start()
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	if err = applyProcessLimits(cmd.Process.Pid, options); err == nil {
+		_, err = writer.Write([]byte("\n"))
+	}
+	if err != nil {
+		if cmd.Process.Kill() == nil {
+			cmd.Wait()
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+//go:build windows
+// +build windows
+
+package backup
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// Process groups cannot be signaled on Windows: the process is killed right away.
+func signalProcessGroup(process *os.Process, sig syscall.Signal) error {
+	return process.Kill()
+}
+
+func setProcessCredential(cmd *exec.Cmd, options processOptions) error {
+	if options.user != "" || options.group != "" {
+		return fmt.Errorf("user: %w", ErrUnsupportedProcessOption)
+	}
+
+	return nil
+}
+
+func startProcess(cmd *exec.Cmd, options processOptions) error {
+	if options.hasLimits() {
+		return fmt.Errorf("nice, ionice and rlimits: %w", ErrUnsupportedProcessOption)
+	}
+
+	return cmd.Start()
+}
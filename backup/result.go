@@ -1,18 +1,31 @@
 package backup
 
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/chialab/streamlined-backup/config"
+	"github.com/chialab/streamlined-backup/handler"
+	"github.com/hashicorp/go-multierror"
+)
+
 type Status string
 
 const (
-	StatusSkipped Status = "skipped"
-	StatusSuccess Status = "success"
-	StatusFailed  Status = "failed"
-	StatusTimeout Status = "timeout"
+	StatusSkipped    Status = "skipped"
+	StatusSuccess    Status = "success"
+	StatusSuspicious Status = "suspicious"
+	StatusFailed     Status = "failed"
+	StatusTimeout    Status = "timeout"
 )
 
 func (status Status) Priority() uint {
 	switch status {
 	case StatusSuccess:
 		return 10
+	case StatusSuspicious:
+		return 15
 	case StatusFailed:
 		return 20
 	case StatusTimeout:
@@ -47,6 +60,15 @@ func NewResultFailed(task *Task, err error, logs []string) Result {
 	}
 }
 
+func NewResultSuspicious(task *Task, err error, logs []string) Result {
+	return Result{
+		status: StatusSuspicious,
+		task:   task,
+		err:    err,
+		logs:   logs,
+	}
+}
+
 func NewResultTimeout(task *Task, logs []string) Result {
 	return Result{
 		status: StatusTimeout,
@@ -58,10 +80,28 @@ func NewResultTimeout(task *Task, logs []string) Result {
 const UNKNOWN_TASK = "(unknown)"
 
 type Result struct {
-	status Status
-	task   *Task
-	err    error
-	logs   []string
+	status    Status
+	task      *Task
+	err       error
+	logs      []string
+	stages    []Stage
+	startTime time.Time
+	endTime   time.Time
+	bytesRead int64
+	upload    handler.Upload
+	attempt   int
+}
+
+// Marks the result as failed because of err, unless it already failed for a more severe reason.
+func (r *Result) fail(err error) {
+	if r.status.Priority() < StatusFailed.Priority() {
+		r.status = StatusFailed
+	}
+	if r.err == nil {
+		r.err = err
+	} else {
+		r.err = multierror.Append(r.err, err)
+	}
 }
 
 func (r Result) Status() Status {
@@ -104,6 +144,184 @@ func (r Result) Logs() []string {
 	return r.logs
 }
 
+// Outcome of each stage of the command, in pipeline order. It is empty if the command was not run.
+func (r Result) Stages() []Stage {
+	return r.stages
+}
+
+// Time the task started running. It is zero if the task was not run.
+func (r Result) StartTime() time.Time {
+	return r.startTime
+}
+
+func (r Result) EndTime() time.Time {
+	return r.endTime
+}
+
+func (r Result) Duration() time.Duration {
+	if r.startTime.IsZero() || r.endTime.IsZero() {
+		return 0
+	}
+
+	return r.endTime.Sub(r.startTime)
+}
+
+// Number of bytes the command wrote to its stdout.
+func (r Result) BytesRead() int64 {
+	return r.bytesRead
+}
+
+// Number of bytes stored in the destination. If the upload failed, bytes that had already been uploaded are counted.
+func (r Result) BytesUploaded() int64 {
+	return r.upload.Bytes
+}
+
+func (r Result) Parts() int {
+	return r.upload.Parts
+}
+
+// Location of the artifact in the destination, such as `s3://bucket/key`. It is empty if the upload did not start.
+func (r Result) Destination() string {
+	return r.upload.Location
+}
+
+// Number of the attempt, counting consecutive runs of the task that did not succeed: 1 unless the previous
+// run failed, timed out or was suspicious. It is derived from the persisted metrics of the task, and is 0
+// when they are not available.
+func (r Result) Attempt() int {
+	return r.attempt
+}
+
+// Copy of the result with the given attempt number.
+func (r Result) WithAttempt(attempt int) Result {
+	r.attempt = attempt
+	return r
+}
+
+type stageJSON struct {
+	Command  string   `json:"command"`
+	ExitCode int      `json:"exit_code"`
+	Error    *string  `json:"error"`
+	Logs     []string `json:"logs"`
+}
+
+type resultJSON struct {
+	Task            string         `json:"task"`
+	Status          Status         `json:"status"`
+	Command         config.Command `json:"command,omitempty"`
+	Cwd             string         `json:"cwd,omitempty"`
+	Error           *string        `json:"error"`
+	Logs            []string       `json:"logs"`
+	Stages          []stageJSON    `json:"stages,omitempty"`
+	StartTime       *time.Time     `json:"start_time,omitempty"`
+	EndTime         *time.Time     `json:"end_time,omitempty"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	BytesRead       int64          `json:"bytes_read"`
+	BytesUploaded   int64          `json:"bytes_uploaded"`
+	Parts           int            `json:"parts"`
+	Destination     string         `json:"destination,omitempty"`
+	Attempt         int            `json:"attempt,omitempty"`
+}
+
+func errorString(err error) *string {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+
+	return &message
+}
+
+func stringError(message *string) error {
+	if message == nil {
+		return nil
+	}
+
+	return errors.New(*message)
+}
+
+func timePointer(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func (r Result) MarshalJSON() ([]byte, error) {
+	data := resultJSON{
+		Task:            r.Name(),
+		Status:          r.status,
+		Error:           errorString(r.err),
+		Logs:            r.logs,
+		StartTime:       timePointer(r.startTime),
+		EndTime:         timePointer(r.endTime),
+		DurationSeconds: r.Duration().Seconds(),
+		BytesRead:       r.bytesRead,
+		BytesUploaded:   r.upload.Bytes,
+		Parts:           r.upload.Parts,
+		Destination:     r.upload.Location,
+		Attempt:         r.attempt,
+	}
+	if r.task != nil {
+		data.Command = r.task.command
+		data.Cwd = r.task.ActualCwd()
+	}
+	if data.Logs == nil {
+		data.Logs = []string{}
+	}
+	for _, stage := range r.stages {
+		data.Stages = append(data.Stages, stageJSON{
+			Command:  stage.command,
+			ExitCode: stage.exitCode,
+			Error:    errorString(stage.err),
+			Logs:     stage.logs,
+		})
+	}
+
+	return json.Marshal(data)
+}
+
+// Restores a result encoded with MarshalJSON. Errors are restored as plain errors with the same message,
+// and the task can only be used to describe the result, not to run it again.
+func (r *Result) UnmarshalJSON(raw []byte) error {
+	data := resultJSON{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return err
+	}
+
+	*r = Result{
+		status:    data.Status,
+		err:       stringError(data.Error),
+		logs:      data.Logs,
+		bytesRead: data.BytesRead,
+		upload:    handler.Upload{Location: data.Destination, Parts: data.Parts, Bytes: data.BytesUploaded},
+		attempt:   data.Attempt,
+	}
+	if data.Task != UNKNOWN_TASK {
+		r.task = &Task{name: data.Task, command: data.Command, cwd: data.Cwd}
+	}
+	if r.logs == nil {
+		r.logs = []string{}
+	}
+	if data.StartTime != nil {
+		r.startTime = *data.StartTime
+	}
+	if data.EndTime != nil {
+		r.endTime = *data.EndTime
+	}
+	for _, stage := range data.Stages {
+		r.stages = append(r.stages, Stage{
+			command:  stage.Command,
+			exitCode: stage.ExitCode,
+			err:      stringError(stage.Error),
+			logs:     stage.Logs,
+		})
+	}
+
+	return nil
+}
+
 type Results []Result
 
 func (r Results) Len() int {
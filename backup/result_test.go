@@ -1,11 +1,16 @@
 package backup
 
 import (
+	"encoding/json"
 	"errors"
 	"os"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
+
+	"github.com/chialab/streamlined-backup/config"
+	"github.com/chialab/streamlined-backup/handler"
 )
 
 func TestResultConstructors(t *testing.T) {
@@ -17,7 +22,7 @@ func TestResultConstructors(t *testing.T) {
 		logs   []string
 	}
 
-	task := &Task{command: []string{"echo", "hello world"}}
+	task := &Task{command: [][]string{{"echo", "hello world"}}}
 	err := errors.New("test error")
 	logs := []string{"test log 1", "test log 2"}
 	testCases := map[string]testCase{
@@ -48,6 +53,15 @@ func TestResultConstructors(t *testing.T) {
 			err:    err,
 			logs:   logs,
 		},
+		"suspicious": {
+			ctor: func() Result {
+				return NewResultSuspicious(task, err, logs)
+			},
+			status: StatusSuspicious,
+			task:   task,
+			err:    err,
+			logs:   logs,
+		},
 		"timed_out": {
 			ctor: func() Result {
 				return NewResultTimeout(task, logs)
@@ -110,11 +124,11 @@ func TestResultAccessors(t *testing.T) {
 		testLogs := []string{"test log 1", "test log 2"}
 		result := NewResultFailed(&Task{
 			name: "test",
-			command: []string{
+			command: [][]string{{
 				"bash",
 				"-c",
 				"echo 'hello world' \"${PWD:-/tmp}\" | bzip2",
-			},
+			}},
 			cwd: tmpDir,
 		}, testErr, testLogs)
 
@@ -148,7 +162,7 @@ func TestResultAccessors(t *testing.T) {
 		testLogs := []string{"test log 1", "test log 2"}
 		result := NewResultSuccess(&Task{
 			name:    "test",
-			command: []string{"echo", "hello world"},
+			command: [][]string{{"echo", "hello world"}},
 		}, testLogs)
 
 		if status := result.Status(); status != StatusSuccess {
@@ -170,6 +184,52 @@ func TestResultAccessors(t *testing.T) {
 		if logs := result.Logs(); !reflect.DeepEqual(logs, testLogs) {
 			t.Errorf("expected %+v, got %+v", testLogs, logs)
 		}
+		if duration := result.Duration(); duration != 0 {
+			t.Errorf("expected no duration, got %s", duration)
+		}
+	})
+
+	t.Run("with_accounting", func(t *testing.T) {
+		start := time.Date(2021, 10, 8, 18, 9, 17, 0, time.UTC)
+		result := Result{
+			status:    StatusSuccess,
+			startTime: start,
+			endTime:   start.Add(90 * time.Second),
+			bytesRead: 42 << 20,
+			upload:    handler.Upload{Location: "s3://example-bucket/foo/20211008180917", Parts: 2, Bytes: 42 << 20},
+			attempt:   3,
+		}
+
+		if startTime := result.StartTime(); !startTime.Equal(start) {
+			t.Errorf("expected %s, got %s", start, startTime)
+		}
+		if endTime := result.EndTime(); !endTime.Equal(start.Add(90 * time.Second)) {
+			t.Errorf("expected %s, got %s", start.Add(90*time.Second), endTime)
+		}
+		if duration := result.Duration(); duration != 90*time.Second {
+			t.Errorf("expected 1m30s, got %s", duration)
+		}
+		if bytesRead := result.BytesRead(); bytesRead != 42<<20 {
+			t.Errorf("expected %d, got %d", 42<<20, bytesRead)
+		}
+		if uploaded := result.BytesUploaded(); uploaded != 42<<20 {
+			t.Errorf("expected %d, got %d", 42<<20, uploaded)
+		}
+		if parts := result.Parts(); parts != 2 {
+			t.Errorf("expected 2, got %d", parts)
+		}
+		if destination := result.Destination(); destination != "s3://example-bucket/foo/20211008180917" {
+			t.Errorf("expected s3://example-bucket/foo/20211008180917, got %s", destination)
+		}
+		if attempt := result.Attempt(); attempt != 3 {
+			t.Errorf("expected 3, got %d", attempt)
+		}
+		if attempt := result.WithAttempt(4).Attempt(); attempt != 4 {
+			t.Errorf("expected 4, got %d", attempt)
+		}
+		if attempt := result.Attempt(); attempt != 3 {
+			t.Errorf("expected the original result to keep attempt 3, got %d", attempt)
+		}
 	})
 }
 
@@ -183,9 +243,10 @@ func TestResultsSort(t *testing.T) {
 		{status: StatusTimeout, task: &Task{name: "test f"}},
 		{status: StatusSuccess, task: &Task{name: "test c"}},
 		{status: StatusFailed, task: &Task{name: "test a"}},
+		{status: StatusSuspicious, task: &Task{name: "test g"}},
 	}
-	if results.Len() != 6 {
-		t.Errorf("expected 6 results, got %d", results.Len())
+	if results.Len() != 7 {
+		t.Errorf("expected 7 results, got %d", results.Len())
 	}
 	if results.Less(0, 1) {
 		t.Errorf("expected part 1 to be less than 0")
@@ -200,6 +261,7 @@ func TestResultsSort(t *testing.T) {
 		{status: StatusSkipped, task: &Task{name: "test d"}},
 		{status: StatusSuccess, task: &Task{name: "test b"}},
 		{status: StatusSuccess, task: &Task{name: "test c"}},
+		{status: StatusSuspicious, task: &Task{name: "test g"}},
 		{status: StatusFailed, task: &Task{name: "test a"}},
 		{status: StatusFailed, task: &Task{name: "test e"}},
 		{status: StatusTimeout, task: &Task{name: "test f"}},
@@ -208,3 +270,67 @@ func TestResultsSort(t *testing.T) {
 		t.Errorf("expected %v, got %v", expected, results)
 	}
 }
+
+func TestResultJSON(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, 10, 8, 18, 9, 17, 0, time.UTC)
+	testCases := map[string]struct {
+		result   Result
+		expected string
+	}{
+		"skipped": {
+			result:   NewResultSkipped(nil),
+			expected: `{"task":"(unknown)","status":"skipped","error":null,"logs":[],"duration_seconds":0,"bytes_read":0,"bytes_uploaded":0,"parts":0}`,
+		},
+		"failed": {
+			result: Result{
+				status: StatusFailed,
+				task:   &Task{name: "foo", command: config.Command{{"echo", "foo bar"}, {"gzip"}}, cwd: "/tmp"},
+				err:    errors.New("test error"),
+				logs:   []string{"test log"},
+				stages: []Stage{
+					{command: "echo 'foo bar'", exitCode: 0, logs: []string{}},
+					{command: "gzip", exitCode: 1, err: errors.New("exit status 1"), logs: []string{"test log"}},
+				},
+				startTime: start,
+				endTime:   start.Add(90 * time.Second),
+				bytesRead: 42 << 20,
+				upload:    handler.Upload{Location: "s3://example-bucket/foo", Parts: 2, Bytes: 42 << 20},
+				attempt:   3,
+			},
+			expected: `{"task":"foo","status":"failed","command":[["echo","foo bar"],["gzip"]],"cwd":"/tmp","error":"test error","logs":["test log"],` +
+				`"stages":[{"command":"echo 'foo bar'","exit_code":0,"error":null,"logs":[]},{"command":"gzip","exit_code":1,"error":"exit status 1","logs":["test log"]}],` +
+				`"start_time":"2021-10-08T18:09:17Z","end_time":"2021-10-08T18:10:47Z","duration_seconds":90,"bytes_read":44040192,"bytes_uploaded":44040192,"parts":2,` +
+				`"destination":"s3://example-bucket/foo","attempt":3}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			data, err := json.Marshal(tc.result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, data)
+			}
+
+			decoded := Result{}
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if again, err := json.Marshal(decoded); err != nil {
+				t.Fatal(err)
+			} else if string(again) != tc.expected {
+				t.Errorf("expected %s after decoding, got %s", tc.expected, again)
+			}
+			if decoded.Name() != tc.result.Name() || decoded.Command() != tc.result.Command() || decoded.Duration() != tc.result.Duration() {
+				t.Errorf("expected %+v, got %+v", tc.result, decoded)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package backup
+
+// Stage is the outcome of one of the processes of a command pipeline.
+type Stage struct {
+	command  string
+	exitCode int
+	err      error
+	logs     []string
+}
+
+func (s Stage) Command() string {
+	return s.command
+}
+
+// Exit code of the process, or -1 if it was not started or it was terminated by a signal.
+func (s Stage) ExitCode() int {
+	return s.exitCode
+}
+
+func (s Stage) Error() error {
+	return s.err
+}
+
+// Lines written by the process to stderr.
+func (s Stage) Logs() []string {
+	return s.logs
+}
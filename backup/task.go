@@ -1,11 +1,16 @@
 package backup
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alessio/shellescape"
@@ -16,20 +21,38 @@ import (
 )
 
 const DEFAULT_TIMEOUT = time.Minute * 10
+const DEFAULT_KILL_GRACE = time.Second * 10
+
+var ErrEmptyCommand = errors.New("command is empty")
+
+type hooks struct {
+	before    []string
+	after     []string
+	onSuccess []string
+	onFailure []string
+}
 
 type Task struct {
-	name     string
-	schedule utils.ScheduleExpression
-	command  []string
-	cwd      string
-	env      []string
-	timeout  time.Duration
-	handler  handler.Handler
-	logger   *log.Logger
+	name         string
+	schedule     utils.ScheduleExpression
+	command      config.Command
+	cwd          string
+	env          []string
+	envFile      string
+	inheritEnv   config.InheritEnvMode
+	envAllowlist []string
+	hooks        hooks
+	process      processOptions
+	timeout      time.Duration
+	killGrace    time.Duration
+	guards       sizeGuards
+	heartbeat    heartbeat
+	handler      handler.Handler
+	logger       *utils.Logger
 }
 
 func NewTask(name string, def config.Task) (*Task, error) {
-	logger := log.New(os.Stderr, fmt.Sprintf("[%s] ", name), log.LstdFlags|log.Lmsgprefix)
+	logger := utils.DefaultLogger().With("task", name)
 	handler, err := handler.NewHandler(def.Destination)
 	if err != nil {
 		return nil, err
@@ -43,20 +66,58 @@ func NewTask(name string, def config.Task) (*Task, error) {
 		}
 	}
 
+	var killGrace time.Duration
+	if def.KillGrace != "" {
+		killGrace, err = time.ParseDuration(def.KillGrace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	guards, err := newSizeGuards(def)
+	if err != nil {
+		return nil, err
+	}
+
+	if !def.InheritEnv.IsValid() {
+		return nil, fmt.Errorf("unknown inherit_env mode %q", def.InheritEnv)
+	}
+
 	return &Task{
-		name:     name,
-		schedule: def.Schedule,
-		command:  def.Command,
-		cwd:      def.Cwd,
-		env:      def.Env,
-		timeout:  timeout,
-		handler:  handler,
-		logger:   logger,
+		name:         name,
+		schedule:     def.Schedule,
+		command:      def.Command,
+		cwd:          def.Cwd,
+		env:          def.Env,
+		envFile:      def.EnvFile,
+		inheritEnv:   def.InheritEnv,
+		envAllowlist: def.EnvAllowlist,
+		hooks: hooks{
+			before:    def.Before,
+			after:     def.After,
+			onSuccess: def.OnSuccess,
+			onFailure: def.OnFailure,
+		},
+		process: processOptions{
+			user:    def.User,
+			group:   def.Group,
+			nice:    def.Nice,
+			ionice:  def.IONice,
+			rlimits: def.Rlimits,
+		},
+		timeout:   timeout,
+		killGrace: killGrace,
+		guards:    guards,
+		heartbeat: newHeartbeat(def.Heartbeat),
+		handler:   handler,
+		logger:    logger,
 	}, nil
 }
 
 type TaskInterface interface {
-	Run(now time.Time) (result Result)
+	Name() string
+	Run(now time.Time, force bool) (result Result)
+	Explain(now time.Time, force bool) Decision
 }
 
 func (t Task) Name() string {
@@ -64,7 +125,7 @@ func (t Task) Name() string {
 }
 
 func (t Task) CommandString() string {
-	return shellescape.QuoteCommand(t.command)
+	return t.command.String()
 }
 
 func (t Task) ActualCwd() string {
@@ -87,26 +148,62 @@ func (t Task) Timeout() time.Duration {
 	return t.timeout
 }
 
+func (t Task) KillGrace() time.Duration {
+	if t.killGrace == 0 {
+		return DEFAULT_KILL_GRACE
+	}
+
+	return t.killGrace
+}
+
 func (t Task) shouldRun(now time.Time) (bool, error) {
-	lastRun, err := t.handler.LastRun()
-	if err != nil {
-		return false, err
+	decision := t.Explain(now, false)
+
+	return decision.Run, decision.Err
+}
+
+func (t Task) Explain(now time.Time, force bool) Decision {
+	decision := Decision{Name: t.name}
+
+	if last, err := t.handler.LastArtifact(); err != nil {
+		decision.Err = err
+		decision.Reason = fmt.Sprintf("could not find last run: %s", err)
+	} else if lastRun := last.Timestamp; lastRun.IsZero() {
+		decision.NextRun = now
+		decision.Run = true
+		decision.Reason = "no previous run found"
+	} else {
+		decision.LastRun = lastRun
+		decision.NextRun = t.schedule.Next(lastRun)
+		decision.Run = decision.NextRun.Before(now)
+		if decision.Run {
+			decision.Reason = fmt.Sprintf("next run was due at %s", decision.NextRun.Format(time.RFC3339))
+		} else {
+			decision.Reason = fmt.Sprintf("next run is due at %s", decision.NextRun.Format(time.RFC3339))
+		}
 	}
 
-	if lastRun.IsZero() {
-		return true, nil
+	if force && !decision.Run {
+		decision.Run = true
+		decision.Reason = fmt.Sprintf("forced, although %s", decision.Reason)
 	}
 
-	return t.schedule.Next(lastRun).Before(now), nil
+	return decision
 }
 
-func (t Task) Run(now time.Time) Result {
+func (t Task) Run(now time.Time, force bool) Result {
+	if force {
+		return t.runner(now)
+	}
+
 	if run, err := t.shouldRun(now); err != nil {
-		t.logger.Printf("ERROR (Could not find last run): %s", err)
+		t.logger.With("error_code", HandlerError).Error("Could not find last run", err)
+		result := NewResultFailed(&t, err, []string{})
+		t.heartbeat.finish(t.logger.With("phase", "notify"), result)
 
-		return NewResultFailed(&t, err, []string{})
+		return result
 	} else if !run {
-		t.logger.Print("SKIPPED")
+		t.logger.Info("SKIPPED")
 
 		return NewResultSkipped(&t)
 	}
@@ -114,25 +211,79 @@ func (t Task) Run(now time.Time) Result {
 	return t.runner(now)
 }
 
+// Identifies a run in the logs, so that the records of concurrent or consecutive runs can be told apart.
+func newRunId() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(id)
+}
+
 func (t Task) runner(now time.Time) (result Result) {
-	result = Result{task: &t}
+	t.logger = t.logger.With("run_id", newRunId())
+	result = Result{task: &t, startTime: time.Now()}
 
-	logsWriter := utils.NewLogWriter(t.logger)
+	// Output lines are logged by exec, along with the phase and stage they come from.
+	logsWriter := utils.NewLogWriter(nil)
 	defer func() {
 		logsWriter.Close()
 		result.logs = logsWriter.Lines()
+		result.endTime = time.Now()
+		t.heartbeat.finish(t.logger.With("phase", "notify"), result)
 	}()
 
+	t.heartbeat.start(t.logger.With("phase", "notify"))
+
+	if err := t.runHook("Before hook", t.hooks.before, logsWriter); err != nil {
+		result.status, result.err = StatusFailed, err
+	} else {
+		t.upload(now, logsWriter, &result)
+	}
+
+	if err := t.runHook("After hook", t.hooks.after, logsWriter); err != nil {
+		result.fail(err)
+	}
+	if result.status == StatusSuccess {
+		if err := t.runHook("Success hook", t.hooks.onSuccess, logsWriter); err != nil {
+			result.fail(err)
+		}
+	} else if err := t.runHook("Failure hook", t.hooks.onFailure, logsWriter); err != nil {
+		result.fail(err)
+	}
+
+	if result.status == StatusSuccess {
+		t.logger.Info("DONE")
+	}
+
+	return
+}
+
+func (t Task) upload(now time.Time, logsWriter io.Writer, result *Result) {
+	logger := t.logger.With("phase", "upload")
+	var previous handler.Artifact
+	if t.guards.needsPrevious() {
+		var err error
+		if previous, err = t.handler.LastTrustedArtifact(); err != nil {
+			logger.With("error_code", HandlerError).Error("Previous artifact lookup failed", err)
+			result.status, result.err = StatusFailed, NewTaskError(HandlerError, "previous artifact could not be found: %s", err)
+
+			return
+		}
+	}
+
 	reader, writer := io.Pipe()
 	wait, initErr := t.handler.Handler(reader, now)
 	if initErr != nil {
-		t.logger.Printf("ERROR (Initialization failed): %s", initErr)
-		result.status = StatusFailed
-		result.err = NewTaskError(HandlerError, "handler could not be initialized: %s", initErr)
+		logger.With("error_code", HandlerError).Error("Initialization failed", initErr)
+		result.status, result.err = StatusFailed, NewTaskError(HandlerError, "handler could not be initialized: %s", initErr)
 
 		return
 	}
+	output := utils.NewCountingWriter(writer)
 	defer func() {
+		result.bytesRead = output.Count()
 		if panicked := recover(); panicked != nil {
 			panicErr := utils.ToError(panicked)
 
@@ -143,75 +294,264 @@ func (t Task) runner(now time.Time) (result Result) {
 
 			result.err = panicErr
 			if writer != nil {
-				if err := writer.CloseWithError(panicErr); err != nil {
-					t.logger.Printf("ERROR (Abort failed): %s", err)
-					result.err = multierror.Append(result.err, err)
+				if closeErr := writer.CloseWithError(panicErr); closeErr != nil {
+					logger.With("error_code", HandlerError).Error("Abort failed", closeErr)
+					result.err = multierror.Append(result.err, closeErr)
 				}
-				if err := wait(); err != nil {
-					t.logger.Printf("ERROR (Upload abort failed): %s", err)
-					result.err = multierror.Append(result.err, NewTaskError(HandlerError, "handler could not abort artifact upload: %s", err))
+				upload, waitErr := wait(handler.AbortUpload)
+				result.upload = upload
+				if waitErr != nil {
+					logger.With("error_code", HandlerError).Error("Upload abort failed", waitErr)
+					result.err = multierror.Append(result.err, NewTaskError(HandlerError, "handler could not abort artifact upload: %s", waitErr))
 				}
 			}
 		}
 	}()
 
-	if err := t.execCommand(writer, logsWriter); err != nil {
-		panic(err)
+	stages, cmdErr := t.execCommand(output, logsWriter)
+	result.stages = stages
+	if cmdErr != nil {
+		panic(cmdErr)
 	}
 
 	writer.Close()
 	writer = nil
 
-	if err := wait(); err != nil {
-		t.logger.Printf("ERROR (Upload failed): %s", err)
+	completion := handler.CompleteUpload
+	suspicion := t.guards.check(output.Count(), previous)
+	if suspicion != nil {
+		logger.With("error_code", SuspiciousArtifactError).Warning("SUSPICIOUS", suspicion.Error())
+		completion = t.guards.completion()
+	}
+
+	upload, err := wait(completion)
+	result.upload = upload
+	if err != nil {
+		logger := logger.With("error_code", HandlerError)
+		if partErr := new(handler.PartError); errors.As(err, &partErr) {
+			logger = logger.With("part", partErr.Part)
+		}
+		logger.Error("Upload failed", err)
 		panic(NewTaskError(HandlerError, "handler could not complete artifact upload: %s", err))
 	}
 
-	t.logger.Print("DONE")
 	result.status = StatusSuccess
+	if suspicion != nil {
+		result.status, result.err = StatusSuspicious, NewTaskError(SuspiciousArtifactError, "%s", suspicion)
+	}
+}
 
-	return
+// Runs a hook command, if defined. Both its stdout and stderr are collected in the task logs.
+func (t Task) runHook(label string, command []string, logsWriter io.Writer) error {
+	if len(command) == 0 {
+		return nil
+	}
+
+	t.logger = t.logger.With("phase", "hook")
+	if _, err := t.exec(label, config.Command{command}, processOptions{}, logsWriter, logsWriter); err != nil {
+		return NewTaskError(HookError, "%s", err)
+	}
+
+	return nil
 }
 
-func (t Task) execCommand(stdout io.Writer, stderr io.Writer) error {
-	cmd := exec.Command(t.command[0], t.command[1:]...)
-	cmd.Dir = t.cwd
-	cmd.Env = t.env
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
+func (t Task) execCommand(stdout io.Writer, stderr io.Writer) ([]Stage, error) {
+	t.logger = t.logger.With("phase", "command")
+
+	return t.exec("Command", t.command, t.process, stdout, stderr)
+}
 
-	if err := cmd.Start(); err != nil {
-		t.logger.Printf("ERROR (Command start): %s", err)
+// Runs all the stages of a command, connecting the stdout of each one to the stdin of the next. The stdout
+// of the last stage is written to stdout, while the stderr of all stages is written line by line to stderr.
+func (t Task) exec(label string, command config.Command, options processOptions, stdout io.Writer, stderr io.Writer) ([]Stage, error) {
+	name := strings.ToLower(label)
+	if len(command) == 0 {
+		command = config.Command{nil}
+	}
 
-		return NewTaskError(CommandStartError, "command could not be started: %s", err)
+	stages := make([]Stage, len(command))
+	prefix := make([]string, len(command))
+	loggers := make([]*utils.Logger, len(command))
+	for i, argv := range command {
+		stages[i] = Stage{command: shellescape.QuoteCommand(argv), exitCode: -1}
+		loggers[i] = t.logger
+		if len(command) > 1 {
+			prefix[i] = fmt.Sprintf("stage %d: ", i+1)
+			loggers[i] = t.logger.With("stage", i+1)
+		}
+	}
+	logError := func(i int, code ErrorCode, message string, err error) {
+		loggers[i].With("error_code", code).Error(message, fmt.Errorf("%s%w", prefix[i], err))
 	}
 
-	res := make(chan error)
-	go func() {
-		defer close(res)
-		res <- cmd.Wait()
+	for i, argv := range command {
+		if len(argv) == 0 {
+			logError(i, CommandStartError, label+" start", ErrEmptyCommand)
+			stages[i].err = ErrEmptyCommand
+
+			return stages, NewTaskError(CommandStartError, name+" could not be started: "+prefix[i]+"%s", ErrEmptyCommand)
+		}
+	}
+
+	env, err := t.environment()
+	if err != nil {
+		t.logger.With("error_code", CommandStartError).Error(label+" environment", err)
+
+		return stages, NewTaskError(CommandStartError, name+" environment could not be prepared: %s", err)
+	}
+
+	// Lines of all stages are logged and forwarded to stderr as soon as they are complete, one at a time.
+	var stderrMutex sync.Mutex
+	forwardStderr := func(logger *utils.Logger) func(string) {
+		logger = logger.With("stream", "stderr")
+
+		return func(line string) {
+			stderrMutex.Lock()
+			defer stderrMutex.Unlock()
+
+			logger.Info(line)
+			io.WriteString(stderr, line+"\n")
+		}
+	}
+	cmds := make([]*exec.Cmd, len(command))
+	writers := make([]*utils.LogWriter, len(command))
+	pipes := []*os.File{}
+	defer func() {
+		for _, pipe := range pipes {
+			pipe.Close()
+		}
 	}()
 
-	select {
-	case err := <-res:
-		if err == nil {
-			return nil
+	var stdin io.Reader
+	for i, argv := range command {
+		cmd := exec.Command(argv[0], argv[1:]...)
+		cmd.Dir = t.cwd
+		cmd.Env = env
+		cmd.Stdin = stdin
+		setProcessGroup(cmd)
+		if err := setProcessCredential(cmd, options); err != nil {
+			logError(i, CommandStartError, label+" start", err)
+			stages[i].err = err
+
+			return stages, NewTaskError(CommandStartError, name+" could not be started: "+prefix[i]+"%s", err)
 		}
 
-		t.logger.Printf("ERROR (Command failed): %s", err)
+		writers[i] = utils.NewLogWriter(forwardStderr(loggers[i]))
+		cmd.Stderr = writers[i]
+		if i < len(command)-1 {
+			reader, writer, err := os.Pipe()
+			if err != nil {
+				logError(i, CommandStartError, label+" start", err)
+				stages[i].err = err
 
-		return NewTaskError(CommandFailedError, "command failed: %s", err)
-	case <-time.After(t.Timeout()):
-		t.logger.Printf("TIMEOUT (Command took more than %s)", t.Timeout())
-		var err error
-		err = NewTaskError(CommandTimeoutError, fmt.Sprintf("command timed out after %s", t.Timeout()), nil)
-		if killErr := cmd.Process.Kill(); killErr != nil {
-			t.logger.Printf("ERROR (Command kill): %s", killErr)
-			err = multierror.Append(err, NewTaskError(CommandKillError, "command could not be killed: %s", killErr))
-		} else if waitErr := <-res; waitErr != nil {
-			err = multierror.Append(err, waitErr)
+				return stages, NewTaskError(CommandStartError, name+" could not be started: "+prefix[i]+"%s", err)
+			}
+			pipes = append(pipes, reader, writer)
+			cmd.Stdout, stdin = writer, reader
+		} else if stdout == stderr {
+			cmd.Stdout = writers[i]
+		} else {
+			cmd.Stdout = stdout
 		}
+		cmds[i] = cmd
+	}
+
+	for i, cmd := range cmds {
+		if err := startProcess(cmd, options); err != nil {
+			logError(i, CommandStartError, label+" start", err)
+			stages[i].err = err
+			for _, started := range cmds[:i] {
+				if started.Process.Kill() == nil {
+					started.Wait()
+				}
+			}
+
+			return stages, NewTaskError(CommandStartError, name+" could not be started: "+prefix[i]+"%s", err)
+		}
+	}
+	for _, pipe := range pipes {
+		pipe.Close()
+	}
+	pipes = nil
+
+	type exit struct {
+		index int
+		err   error
+	}
+	res := make(chan exit, len(cmds))
+	for i, cmd := range cmds {
+		go func(i int, cmd *exec.Cmd) {
+			res <- exit{index: i, err: cmd.Wait()}
+		}(i, cmd)
+	}
+
+	var (
+		timedOut bool
+		signals  []string
+		killErrs *multierror.Error
+		grace    <-chan time.Time
+	)
+	timeout := time.After(t.Timeout())
+	exited := make([]bool, len(cmds))
+	signal := func(sig syscall.Signal, sigName string) {
+		signals = append(signals, sigName)
+		for i, cmd := range cmds {
+			if exited[i] {
+				continue
+			} else if killErr := signalProcessGroup(cmd.Process, sig); killErr != nil {
+				logError(i, CommandKillError, label+" kill", killErr)
+				killErrs = multierror.Append(killErrs, NewTaskError(CommandKillError, name+" could not be killed: "+prefix[i]+"%s", killErr))
+			}
+		}
+	}
+	for remaining := len(cmds); remaining > 0; {
+		select {
+		case exit := <-res:
+			remaining--
+			exited[exit.index] = true
+			stages[exit.index].err = exit.err
+		case <-timeout:
+			timeout, timedOut = nil, true
+			t.logger.With("error_code", CommandTimeoutError).Warning("TIMEOUT", fmt.Sprintf("%s took more than %s", label, t.Timeout()))
+			signal(syscall.SIGTERM, "SIGTERM")
+			grace = time.After(t.KillGrace())
+		case <-grace:
+			grace = nil
+			t.logger.With("error_code", CommandTimeoutError).Warning("TIMEOUT", fmt.Sprintf("%s still running after %s grace period", label, t.KillGrace()))
+			signal(syscall.SIGKILL, "SIGKILL")
+		}
+	}
 
-		return err
+	var timeoutErr error
+	if timedOut {
+		message := fmt.Sprintf("%s timed out after %s, sent %s", name, t.Timeout(), signals[0])
+		if len(signals) > 1 {
+			message += fmt.Sprintf(", then %s after %s", signals[1], t.KillGrace())
+		}
+		timeoutErr = multierror.Append(NewTaskError(CommandTimeoutError, message, nil), killErrs.WrappedErrors()...)
 	}
+
+	var errors *multierror.Error
+	for i, cmd := range cmds {
+		writers[i].Close()
+		stages[i].logs = writers[i].Lines()
+		if cmd.ProcessState != nil {
+			stages[i].exitCode = cmd.ProcessState.ExitCode()
+		}
+
+		if stages[i].err != nil && timeoutErr != nil {
+			timeoutErr = multierror.Append(timeoutErr, stages[i].err)
+		} else if stages[i].err != nil {
+			logError(i, CommandFailedError, label+" failed", stages[i].err)
+			errors = multierror.Append(errors, NewTaskError(CommandFailedError, name+" failed: "+prefix[i]+"%s", stages[i].err))
+		}
+	}
+
+	if timeoutErr != nil {
+		return stages, timeoutErr
+	} else if errors != nil && len(errors.Errors) == 1 {
+		return stages, errors.Errors[0]
+	}
+
+	return stages, errors.ErrorOrNil()
 }
@@ -2,31 +2,38 @@ package backup
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/chialab/streamlined-backup/config"
 	"github.com/chialab/streamlined-backup/handler"
 	"github.com/chialab/streamlined-backup/utils"
+	"github.com/hashicorp/go-multierror"
 )
 
-func newTestLogger() (*log.Logger, func() []string) {
+// Returns a text logger, and a function listing the logged lines without their timestamp.
+func newTestLogger() (*utils.Logger, func() []string) {
 	var buf bytes.Buffer
-	logger := log.New(&buf, "", 0)
+	logger := utils.NewLogger(&buf, utils.LogFormatText)
 
 	lines := func() []string {
 		lines := strings.Split(buf.String(), "\n")
 		if lines[len(lines)-1] == "" {
 			lines = lines[:len(lines)-1]
 		}
+		for i, line := range lines {
+			lines[i] = line[len("2006/01/02 15:04:05 "):]
+		}
 
 		return lines
 	}
@@ -39,7 +46,10 @@ var testChunkSize = 256 << 10 // 256 KiB
 type testHandler struct {
 	chunkSize  int
 	lastRun    time.Time
+	lastSize   int64
+	suspicious bool
 	chunks     [][]byte
+	completion handler.Completion
 	lastRunErr error
 	initErr    error
 	err        error
@@ -53,11 +63,19 @@ func (h testHandler) size() int {
 	return h.chunkSize
 }
 
-func (r *testHandler) LastRun() (time.Time, error) {
-	return r.lastRun, r.lastRunErr
+func (r *testHandler) LastArtifact() (handler.Artifact, error) {
+	return handler.Artifact{Timestamp: r.lastRun, Size: r.lastSize}, r.lastRunErr
+}
+
+func (r *testHandler) LastTrustedArtifact() (handler.Artifact, error) {
+	if r.suspicious {
+		return handler.Artifact{}, r.lastRunErr
+	}
+
+	return r.LastArtifact()
 }
 
-func (h *testHandler) Handler(reader *io.PipeReader, now time.Time) (func() error, error) {
+func (h *testHandler) Handler(reader *io.PipeReader, now time.Time) (func(handler.Completion) (handler.Upload, error), error) {
 	if h.initErr != nil {
 		return nil, h.initErr
 	}
@@ -87,10 +105,19 @@ func (h *testHandler) Handler(reader *io.PipeReader, now time.Time) (func() erro
 		done <- nil
 	}()
 
-	return func() error {
-		<-done
+	return func(completion handler.Completion) (handler.Upload, error) {
+		err := <-done
+		h.completion = completion
 
-		return h.err
+		upload := handler.Upload{Parts: len(h.chunks)}
+		for _, chunk := range h.chunks {
+			upload.Bytes += int64(len(chunk))
+		}
+		if err == nil && h.err == nil && completion != handler.AbortUpload {
+			upload.Location = "test://" + now.Format(time.RFC3339)
+		}
+
+		return upload, h.err
 	}, nil
 }
 
@@ -98,8 +125,12 @@ func TestNewTasks(t *testing.T) {
 	t.Parallel()
 
 	cfg := config.Task{
-		Command: []string{"echo", "foo bar"},
+		Command: config.Command{{"echo", "foo bar"}},
 		Env:     []string{"FOO=bar"},
+		Before:  []string{"echo", "before"},
+		After:   []string{"echo", "after"},
+		User:    "postgres",
+		IONice:  &config.IONice{Class: config.IONiceIdle},
 		Destination: config.Destination{
 			Type: "s3",
 		},
@@ -112,17 +143,23 @@ func TestNewTasks(t *testing.T) {
 	if task.name != "foo" {
 		t.Errorf("expected foo, got %s", task.name)
 	}
-	if !reflect.DeepEqual(task.command, []string{"echo", "foo bar"}) {
+	if !reflect.DeepEqual(task.command, config.Command{{"echo", "foo bar"}}) {
 		t.Errorf("expected task command 'echo foo bar', got %v", task.command)
 	}
 	if !reflect.DeepEqual(task.env, []string{"FOO=bar"}) {
 		t.Errorf("expected task env 'FOO=bar', got %v", task.env)
 	}
+	if expected := (hooks{before: []string{"echo", "before"}, after: []string{"echo", "after"}}); !reflect.DeepEqual(task.hooks, expected) {
+		t.Errorf("expected hooks %#v, got %#v", expected, task.hooks)
+	}
+	if expected := (processOptions{user: "postgres", ionice: cfg.IONice}); !reflect.DeepEqual(task.process, expected) {
+		t.Errorf("expected process options %#v, got %#v", expected, task.process)
+	}
 	if _, ok := task.handler.(*handler.S3Handler); !ok {
 		t.Errorf("expected S3Handler, got %T", task.handler)
 	}
-	if task.logger.Prefix() != "[foo] " {
-		t.Errorf("expected log prefix '[foo] ', got %s", task.logger.Prefix())
+	if name, _ := task.logger.Field("task"); name != "foo" {
+		t.Errorf("expected task field 'foo', got %v", name)
 	}
 }
 
@@ -130,7 +167,7 @@ func TestNewTasksInvalidDestination(t *testing.T) {
 	t.Parallel()
 
 	cfg := config.Task{
-		Command: []string{"echo", "bar foo"},
+		Command: config.Command{{"echo", "bar foo"}},
 		Env:     []string{"BAR=foo"},
 	}
 
@@ -145,7 +182,7 @@ func TestNewTasksInvalidTimeout(t *testing.T) {
 	t.Parallel()
 
 	cfg := config.Task{
-		Command: []string{"echo", "bar foo"},
+		Command: config.Command{{"echo", "bar foo"}},
 		Env:     []string{"BAR=foo"},
 		Timeout: "foo bar",
 		Destination: config.Destination{
@@ -161,6 +198,25 @@ func TestNewTasksInvalidTimeout(t *testing.T) {
 	}
 }
 
+func TestNewTasksInvalidInheritEnv(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Task{
+		Command:    config.Command{{"echo", "bar foo"}},
+		InheritEnv: "some",
+		Destination: config.Destination{
+			Type: "s3",
+		},
+	}
+
+	expectedErr := `unknown inherit_env mode "some"`
+	if tasks, err := NewTask("bar", cfg); err == nil {
+		t.Fatalf("expected error, got %v", tasks)
+	} else if err.Error() != expectedErr {
+		t.Fatalf("expected %s, got %s", expectedErr, err)
+	}
+}
+
 func TestTaskAccessors(t *testing.T) {
 	t.Parallel()
 
@@ -169,13 +225,14 @@ func TestTaskAccessors(t *testing.T) {
 
 		task := &Task{
 			name: "test",
-			command: []string{
+			command: [][]string{{
 				"bash",
 				"-c",
 				"echo 'hello world' \"${PWD:-/tmp}\" | bzip2",
-			},
-			cwd:     tmpDir,
-			timeout: 30 * time.Minute,
+			}},
+			cwd:       tmpDir,
+			timeout:   30 * time.Minute,
+			killGrace: time.Minute,
 		}
 
 		if name := task.Name(); name != "test" {
@@ -191,6 +248,9 @@ func TestTaskAccessors(t *testing.T) {
 		if timeout := task.Timeout(); timeout != 30*time.Minute {
 			t.Errorf("expected 30m, got %s", timeout)
 		}
+		if grace := task.KillGrace(); grace != time.Minute {
+			t.Errorf("expected 1m, got %s", grace)
+		}
 	})
 
 	t.Run("with_defaults", func(t *testing.T) {
@@ -201,7 +261,7 @@ func TestTaskAccessors(t *testing.T) {
 
 		task := &Task{
 			name:    "test",
-			command: []string{"echo", "hello world"},
+			command: [][]string{{"echo", "hello world"}},
 		}
 
 		if name := task.Name(); name != "test" {
@@ -217,6 +277,9 @@ func TestTaskAccessors(t *testing.T) {
 		if timeout := task.Timeout(); timeout != DEFAULT_TIMEOUT {
 			t.Errorf("expected default timeout (%s), got %s", DEFAULT_TIMEOUT, timeout)
 		}
+		if grace := task.KillGrace(); grace != DEFAULT_KILL_GRACE {
+			t.Errorf("expected default kill grace (%s), got %s", DEFAULT_KILL_GRACE, grace)
+		}
 	})
 }
 
@@ -289,6 +352,91 @@ func TestShouldRunError(t *testing.T) {
 	}
 }
 
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	lastRunErr := errors.New("test error")
+	type testCase struct {
+		lastRun    time.Time
+		lastRunErr error
+		force      bool
+		expected   Decision
+	}
+	now := time.Date(2021, 10, 6, 19, 10, 38, 0, time.UTC)
+	lastRun := time.Date(2021, 10, 3, 19, 10, 38, 0, time.UTC)
+	cases := map[string]testCase{
+		"due": {
+			lastRun: lastRun,
+			expected: Decision{
+				Name:    "foo",
+				LastRun: lastRun,
+				NextRun: time.Date(2021, 10, 4, 0, 0, 0, 0, time.UTC),
+				Run:     true,
+				Reason:  "next run was due at 2021-10-04T00:00:00Z",
+			},
+		},
+		"not_due": {
+			lastRun: time.Date(2021, 10, 6, 10, 0, 0, 0, time.UTC),
+			expected: Decision{
+				Name:    "foo",
+				LastRun: time.Date(2021, 10, 6, 10, 0, 0, 0, time.UTC),
+				NextRun: time.Date(2021, 10, 7, 0, 0, 0, 0, time.UTC),
+				Run:     false,
+				Reason:  "next run is due at 2021-10-07T00:00:00Z",
+			},
+		},
+		"not_due_forced": {
+			lastRun: time.Date(2021, 10, 6, 10, 0, 0, 0, time.UTC),
+			force:   true,
+			expected: Decision{
+				Name:    "foo",
+				LastRun: time.Date(2021, 10, 6, 10, 0, 0, 0, time.UTC),
+				NextRun: time.Date(2021, 10, 7, 0, 0, 0, 0, time.UTC),
+				Run:     true,
+				Reason:  "forced, although next run is due at 2021-10-07T00:00:00Z",
+			},
+		},
+		"never_run": {
+			lastRun: time.Time{},
+			expected: Decision{
+				Name:    "foo",
+				NextRun: now,
+				Run:     true,
+				Reason:  "no previous run found",
+			},
+		},
+		"error": {
+			lastRunErr: lastRunErr,
+			expected: Decision{
+				Name:   "foo",
+				Run:    false,
+				Reason: "could not find last run: test error",
+				Err:    lastRunErr,
+			},
+		},
+	}
+	schedule, err := utils.NewSchedule("@daily")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := &testHandler{lastRun: tc.lastRun, lastRunErr: tc.lastRunErr}
+			task := &Task{name: "foo", schedule: *schedule, handler: handler}
+
+			if decision := task.Explain(now, tc.force); !reflect.DeepEqual(decision, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, decision)
+			}
+			if len(handler.chunks) != 0 {
+				t.Errorf("expected 0 chunks, got %d", len(handler.chunks))
+			}
+		})
+	}
+}
+
 func TestRun(t *testing.T) {
 	t.Parallel()
 
@@ -302,7 +450,7 @@ func TestRun(t *testing.T) {
 	handler := &testHandler{}
 	logger, lines := newTestLogger()
 	task := &Task{
-		command: []string{"bash", "-c", "echo $FOO; pwd; echo logging >&2"},
+		command: [][]string{{"bash", "-c", "echo $FOO; pwd; echo logging >&2"}},
 		cwd:     tmpDir,
 		env:     []string{"FOO=barbaz"},
 		handler: handler,
@@ -311,7 +459,7 @@ func TestRun(t *testing.T) {
 	expectedData := fmt.Sprintf("barbaz\n%s\n", tmpDir)
 	expectedResultLogs := []string{"logging"}
 
-	if res := task.Run(time.Now()); res.Status() != StatusSuccess {
+	if res := task.Run(time.Now(), false); res.Status() != StatusSuccess {
 		t.Errorf("unexpected error: %+v", res)
 	} else if !reflect.DeepEqual(res.Logs(), expectedResultLogs) {
 		t.Errorf("expected %q, got %q", expectedResultLogs, res.Logs())
@@ -337,12 +485,12 @@ func TestRunLongOutput(t *testing.T) {
 	handler := &testHandler{}
 	logger, lines := newTestLogger()
 	task := &Task{
-		command: []string{"bash", "-c", fmt.Sprintf("yes | head -c %d", testChunkSize+extraSize)},
+		command: [][]string{{"bash", "-c", fmt.Sprintf("yes | head -c %d", testChunkSize+extraSize)}},
 		handler: handler,
 		logger:  logger,
 	}
 
-	if res := task.Run(time.Now()); res.Status() != StatusSuccess {
+	if res := task.Run(time.Now(), false); res.Status() != StatusSuccess {
 		t.Errorf("unexpected error: %+v", res)
 	}
 	if len(handler.chunks) != 2 {
@@ -362,6 +510,46 @@ func TestRunLongOutput(t *testing.T) {
 	}
 }
 
+func TestRunJSONLogs(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	task := &Task{
+		name:    "foo",
+		command: [][]string{{"bash", "-c", "echo logging >&2"}, {"false"}},
+		hooks:   hooks{before: []string{"echo", "preparing"}},
+		handler: &testHandler{},
+		logger:  utils.NewLogger(&buf, utils.LogFormatJSON).With("task", "foo"),
+	}
+
+	if res := task.Run(time.Now(), true); res.Status() != StatusFailed {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	records := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		delete(record, "time")
+		if runId, ok := record["run_id"].(string); !ok || len(runId) != 16 {
+			t.Errorf("expected run id, got %#v", record["run_id"])
+		}
+		delete(record, "run_id")
+		records = append(records, record)
+	}
+
+	expected := []map[string]interface{}{
+		{"level": "info", "msg": "preparing", "task": "foo", "phase": "hook", "stream": "stderr"},
+		{"level": "info", "msg": "logging", "task": "foo", "phase": "command", "stage": 1.0, "stream": "stderr"},
+		{"level": "error", "msg": "Command failed", "task": "foo", "phase": "command", "stage": 2.0, "error_code": "command_failed", "error": "stage 2: exit status 1"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected %#v, got %#v", expected, records)
+	}
+}
+
 func TestRunSkipped(t *testing.T) {
 	t.Parallel()
 
@@ -374,13 +562,13 @@ func TestRunSkipped(t *testing.T) {
 	logger, lines := newTestLogger()
 	task := &Task{
 		schedule: *schedule,
-		command:  []string{"echo", "hello world"},
+		command:  [][]string{{"echo", "hello world"}},
 		handler:  handler,
 		logger:   logger,
 	}
 
 	now := time.Date(2021, 10, 12, 10, 59, 38, 0, time.Local)
-	if res := task.Run(now); res.Status() != StatusSkipped {
+	if res := task.Run(now, false); res.Status() != StatusSkipped {
 		t.Errorf("unexpected result: %+v", res)
 	}
 
@@ -394,6 +582,38 @@ func TestRunSkipped(t *testing.T) {
 	}
 }
 
+func TestRunForced(t *testing.T) {
+	t.Parallel()
+
+	lastRun := time.Date(2021, 10, 12, 10, 30, 38, 0, time.Local)
+	handler := &testHandler{lastRun: lastRun, lastRunErr: errors.New("should not be called")}
+	schedule, err := utils.NewSchedule("0,30 * * * *")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	logger, lines := newTestLogger()
+	task := &Task{
+		schedule: *schedule,
+		command:  [][]string{{"echo", "hello world"}},
+		handler:  handler,
+		logger:   logger,
+	}
+
+	now := time.Date(2021, 10, 12, 10, 59, 38, 0, time.Local)
+	if res := task.Run(now, true); res.Status() != StatusSuccess {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	if len(handler.chunks) != 1 {
+		t.Errorf("expected 1 chunk, got %d", len(handler.chunks))
+	}
+
+	expectedLogs := []string{"DONE"}
+	if logs := lines(); !reflect.DeepEqual(logs, expectedLogs) {
+		t.Errorf("expected %q, got %q", expectedLogs, logs)
+	}
+}
+
 func TestRunHandlerInitError(t *testing.T) {
 	t.Parallel()
 
@@ -401,12 +621,12 @@ func TestRunHandlerInitError(t *testing.T) {
 	handler := &testHandler{initErr: initErr}
 	logger, lines := newTestLogger()
 	task := &Task{
-		command: []string{"echo", "hello world"},
+		command: [][]string{{"echo", "hello world"}},
 		handler: handler,
 		logger:  logger,
 	}
 
-	if res := task.Run(time.Now()); res.Status() != StatusFailed {
+	if res := task.Run(time.Now(), false); res.Status() != StatusFailed {
 		t.Errorf("unexpected result: %+v", res)
 	} else if !errors.Is(res.Error(), initErr) {
 		t.Errorf("expected %v, got %v", initErr, res.Error())
@@ -429,12 +649,12 @@ func TestRunLastRunError(t *testing.T) {
 	handler := &testHandler{lastRunErr: lastRunErr}
 	logger, lines := newTestLogger()
 	task := &Task{
-		command: []string{"echo", "hello world"},
+		command: [][]string{{"echo", "hello world"}},
 		handler: handler,
 		logger:  logger,
 	}
 
-	if res := task.Run(time.Now()); res.Status() != StatusFailed {
+	if res := task.Run(time.Now(), false); res.Status() != StatusFailed {
 		t.Errorf("unexpected result: %+v", res)
 	} else if res.Error() != lastRunErr {
 		t.Errorf("expected %v, got %v", lastRunErr, res.Error())
@@ -454,41 +674,44 @@ func TestTaskRunner(t *testing.T) {
 	t.Parallel()
 
 	type testCase struct {
-		handler  *testHandler
-		command  []string
-		status   Status
-		errCodes []ErrorCode
-		logs     []string
-		chunks   []string
+		handler   *testHandler
+		command   [][]string
+		status    Status
+		errCodes  []ErrorCode
+		logs      []string
+		chunks    []string
+		bytesRead int64
 	}
 	testCases := map[string]testCase{
 		"ok": {
-			handler:  &testHandler{},
-			command:  []string{"echo", "foo bar"},
-			status:   StatusSuccess,
-			errCodes: nil,
-			logs:     []string{"DONE"},
-			chunks:   []string{"foo bar\n"},
+			handler:   &testHandler{},
+			command:   [][]string{{"echo", "foo bar"}},
+			status:    StatusSuccess,
+			errCodes:  nil,
+			logs:      []string{"DONE"},
+			chunks:    []string{"foo bar\n"},
+			bytesRead: 8,
 		},
 		"handler_init_error": {
 			handler:  &testHandler{initErr: errors.New("test error")},
-			command:  []string{"echo", "foo bar"},
+			command:  [][]string{{"echo", "foo bar"}},
 			status:   StatusFailed,
 			errCodes: []ErrorCode{HandlerError},
 			logs:     []string{"ERROR (Initialization failed): test error"},
 			chunks:   []string{},
 		},
 		"handler_upload_error": {
-			handler:  &testHandler{err: errors.New("test error")},
-			command:  []string{"echo", "foo bar"},
-			status:   StatusFailed,
-			errCodes: []ErrorCode{HandlerError},
-			logs:     []string{"ERROR (Upload failed): test error"},
-			chunks:   []string{"foo bar\n"},
+			handler:   &testHandler{err: errors.New("test error")},
+			command:   [][]string{{"echo", "foo bar"}},
+			status:    StatusFailed,
+			errCodes:  []ErrorCode{HandlerError},
+			logs:      []string{"ERROR (Upload failed): test error"},
+			chunks:    []string{"foo bar\n"},
+			bytesRead: 8,
 		},
 		"handler_abort_error": {
 			handler:  &testHandler{err: errors.New("test error")},
-			command:  []string{"false"},
+			command:  [][]string{{"false"}},
 			status:   StatusFailed,
 			errCodes: []ErrorCode{CommandFailedError, HandlerError},
 			logs:     []string{"ERROR (Command failed): exit status 1", "ERROR (Upload abort failed): test error"},
@@ -496,23 +719,24 @@ func TestTaskRunner(t *testing.T) {
 		},
 		"start_error": {
 			handler:  &testHandler{},
-			command:  []string{"this-cmd-does-not-exist"},
+			command:  [][]string{{"this-cmd-does-not-exist"}},
 			status:   StatusFailed,
 			errCodes: []ErrorCode{CommandStartError},
 			logs:     []string{"ERROR (Command start): exec: \"this-cmd-does-not-exist\": executable file not found in $PATH"},
 			chunks:   []string{},
 		},
 		"non_zero_exit_code": {
-			handler:  &testHandler{chunkSize: 7},
-			command:  []string{"bash", "-c", "echo output && echo error >&2 && exit 42"},
-			status:   StatusFailed,
-			errCodes: []ErrorCode{CommandFailedError},
-			logs:     []string{"error", "ERROR (Command failed): exit status 42"},
-			chunks:   []string{"output\n"},
+			handler:   &testHandler{chunkSize: 7},
+			command:   [][]string{{"bash", "-c", "echo output && echo error >&2 && exit 42"}},
+			status:    StatusFailed,
+			errCodes:  []ErrorCode{CommandFailedError},
+			logs:      []string{"error", "ERROR (Command failed): exit status 42"},
+			chunks:    []string{"output\n"},
+			bytesRead: 7,
 		},
 		"timeout": {
 			handler:  &testHandler{},
-			command:  []string{"bash", "-c", "sleep 1 && echo output && echo error >&2 && exit 42"},
+			command:  [][]string{{"bash", "-c", "sleep 1 && echo output && echo error >&2 && exit 42"}},
 			status:   StatusTimeout,
 			errCodes: []ErrorCode{CommandTimeoutError},
 			logs:     []string{"TIMEOUT (Command took more than 30ms)"},
@@ -529,7 +753,8 @@ func TestTaskRunner(t *testing.T) {
 				logger:  logger,
 			}
 
-			result := task.runner(time.Now())
+			start := time.Now()
+			result := task.runner(start)
 			if result.Status() != tc.status {
 				t.Errorf("expected status %+v, got %+v", tc.status, result.Status())
 			}
@@ -557,6 +782,259 @@ func TestTaskRunner(t *testing.T) {
 			if !reflect.DeepEqual(chunks, tc.chunks) {
 				t.Errorf("expected data %#v, got %#v", tc.chunks, chunks)
 			}
+
+			if bytesRead := result.BytesRead(); bytesRead != tc.bytesRead {
+				t.Errorf("expected %d bytes read, got %d", tc.bytesRead, bytesRead)
+			}
+			if uploaded := result.BytesUploaded(); uploaded != int64(len(strings.Join(tc.chunks, ""))) {
+				t.Errorf("expected %d bytes uploaded, got %d", len(strings.Join(tc.chunks, "")), uploaded)
+			}
+			if parts := result.Parts(); parts != len(tc.chunks) {
+				t.Errorf("expected %d parts, got %d", len(tc.chunks), parts)
+			}
+			if result.StartTime().Before(start) || result.EndTime().Before(result.StartTime()) || result.Duration() != result.EndTime().Sub(result.StartTime()) {
+				t.Errorf("expected timing to be recorded, got %s - %s", result.StartTime(), result.EndTime())
+			}
+		})
+	}
+}
+
+func TestTaskRunnerSizeGuards(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		guards      sizeGuards
+		handler     *testHandler
+		status      Status
+		errCodes    []ErrorCode
+		logs        []string
+		completion  handler.Completion
+		destination string
+	}
+	testCases := map[string]testCase{
+		"ok": {
+			guards:      sizeGuards{minSize: 4, maxSize: 1 << 10},
+			handler:     &testHandler{},
+			status:      StatusSuccess,
+			logs:        []string{"DONE"},
+			completion:  handler.CompleteUpload,
+			destination: "test://2021-10-08T18:09:17Z",
+		},
+		"keep": {
+			guards:      sizeGuards{minSize: 1 << 10},
+			handler:     &testHandler{},
+			status:      StatusSuspicious,
+			errCodes:    []ErrorCode{SuspiciousArtifactError},
+			logs:        []string{"SUSPICIOUS (artifact size 8 B is below min_size 1.0 KiB)", "failure hook"},
+			completion:  handler.CompleteUpload,
+			destination: "test://2021-10-08T18:09:17Z",
+		},
+		"tag": {
+			guards:      sizeGuards{maxSize: 4, action: config.SuspiciousTag},
+			handler:     &testHandler{},
+			status:      StatusSuspicious,
+			errCodes:    []ErrorCode{SuspiciousArtifactError},
+			logs:        []string{"SUSPICIOUS (artifact size 8 B is above max_size 4 B)", "failure hook"},
+			completion:  handler.CompleteUploadTagged,
+			destination: "test://2021-10-08T18:09:17Z",
+		},
+		"abort": {
+			guards:     sizeGuards{changePercent: 50, action: config.SuspiciousAbort},
+			handler:    &testHandler{lastSize: 8 << 30},
+			status:     StatusSuspicious,
+			errCodes:   []ErrorCode{SuspiciousArtifactError},
+			logs:       []string{"SUSPICIOUS (artifact size 8 B differs by 100.0% from the previous artifact (8.0 GiB), more than max_size_change_percent 50%)", "failure hook"},
+			completion: handler.AbortUpload,
+		},
+		"previous_suspicious": {
+			guards:      sizeGuards{changePercent: 50},
+			handler:     &testHandler{lastSize: 8 << 30, suspicious: true},
+			status:      StatusSuccess,
+			logs:        []string{"DONE"},
+			completion:  handler.CompleteUpload,
+			destination: "test://2021-10-08T18:09:17Z",
+		},
+		"previous_error": {
+			guards:   sizeGuards{changePercent: 50},
+			handler:  &testHandler{lastRunErr: errors.New("test error")},
+			status:   StatusFailed,
+			errCodes: []ErrorCode{HandlerError},
+			logs:     []string{"ERROR (Previous artifact lookup failed): test error", "failure hook"},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			logger, lines := newTestLogger()
+			task := &Task{
+				command: [][]string{{"echo", "foo bar"}},
+				hooks:   hooks{onFailure: []string{"echo", "failure hook"}},
+				guards:  tc.guards,
+				handler: tc.handler,
+				logger:  logger,
+			}
+
+			result := task.runner(time.Date(2021, 10, 8, 18, 9, 17, 0, time.UTC))
+			if status := result.Status(); status != tc.status {
+				t.Errorf("expected status %s, got %s", tc.status, status)
+			}
+			if tc.errCodes == nil && result.Error() != nil {
+				t.Errorf("unexpected error: %s", result.Error())
+			}
+			for _, code := range tc.errCodes {
+				if err := result.Error(); !IsTaskError(err, code) {
+					t.Errorf("expected error code %+v, got %+v", code, err)
+				}
+			}
+			if logs := lines(); !reflect.DeepEqual(logs, tc.logs) {
+				t.Errorf("expected logs %q, got %q", tc.logs, logs)
+			}
+			if tc.handler.completion != tc.completion {
+				t.Errorf("expected completion %d, got %d", tc.completion, tc.handler.completion)
+			}
+			if destination := result.Destination(); destination != tc.destination {
+				t.Errorf("expected destination %q, got %q", tc.destination, destination)
+			}
+		})
+	}
+}
+
+func TestTaskRunnerHooks(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		command    [][]string
+		before     []string
+		after      []string
+		onSuccess  []string
+		onFailure  []string
+		status     Status
+		errCodes   []ErrorCode
+		noCodes    []ErrorCode
+		logs       []string
+		resultLogs []string
+		chunks     []string
+	}
+	testCases := map[string]testCase{
+		"success": {
+			command:    [][]string{{"echo", "foo bar"}},
+			before:     []string{"echo", "before"},
+			after:      []string{"bash", "-c", "echo after >&2"},
+			onSuccess:  []string{"echo", "success"},
+			onFailure:  []string{"echo", "failure"},
+			status:     StatusSuccess,
+			logs:       []string{"before", "after", "success", "DONE"},
+			resultLogs: []string{"before", "after", "success"},
+			chunks:     []string{"foo bar\n"},
+		},
+		"before_failed": {
+			command:    [][]string{{"echo", "foo bar"}},
+			before:     []string{"bash", "-c", "echo locking && exit 3"},
+			after:      []string{"echo", "after"},
+			onSuccess:  []string{"echo", "success"},
+			onFailure:  []string{"echo", "failure"},
+			status:     StatusFailed,
+			errCodes:   []ErrorCode{HookError},
+			noCodes:    []ErrorCode{CommandFailedError},
+			logs:       []string{"locking", "ERROR (Before hook failed): exit status 3", "after", "failure"},
+			resultLogs: []string{"locking", "after", "failure"},
+			chunks:     []string{},
+		},
+		"command_failed": {
+			command:   [][]string{{"false"}},
+			before:    []string{"echo", "before"},
+			after:     []string{"echo", "after"},
+			onSuccess: []string{"echo", "success"},
+			onFailure: []string{"echo", "failure"},
+			status:    StatusFailed,
+			errCodes:  []ErrorCode{CommandFailedError},
+			noCodes:   []ErrorCode{HookError},
+			logs:      []string{"before", "ERROR (Command failed): exit status 1", "after", "failure"},
+			chunks:    []string{},
+		},
+		"command_timeout": {
+			command:  [][]string{{"sleep", "1"}},
+			after:    []string{"echo", "after"},
+			status:   StatusTimeout,
+			errCodes: []ErrorCode{CommandTimeoutError},
+			noCodes:  []ErrorCode{HookError},
+			logs:     []string{"TIMEOUT (Command took more than 100ms)", "after"},
+			chunks:   []string{},
+		},
+		"after_failed": {
+			command:   [][]string{{"echo", "foo bar"}},
+			after:     []string{"this-cmd-does-not-exist"},
+			onSuccess: []string{"echo", "success"},
+			onFailure: []string{"echo", "failure"},
+			status:    StatusFailed,
+			errCodes:  []ErrorCode{HookError},
+			logs:      []string{"ERROR (After hook start): exec: \"this-cmd-does-not-exist\": executable file not found in $PATH", "failure"},
+			chunks:    []string{"foo bar\n"},
+		},
+		"hook_timeout": {
+			command:   [][]string{{"echo", "foo bar"}},
+			onSuccess: []string{"sleep", "1"},
+			status:    StatusFailed,
+			errCodes:  []ErrorCode{HookError},
+			noCodes:   []ErrorCode{CommandTimeoutError},
+			logs:      []string{"TIMEOUT (Success hook took more than 100ms)"},
+			chunks:    []string{"foo bar\n"},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := &testHandler{}
+			logger, lines := newTestLogger()
+			task := &Task{
+				command: tc.command,
+				hooks: hooks{
+					before:    tc.before,
+					after:     tc.after,
+					onSuccess: tc.onSuccess,
+					onFailure: tc.onFailure,
+				},
+				timeout: 100 * time.Millisecond,
+				handler: handler,
+				logger:  logger,
+			}
+
+			result := task.runner(time.Now())
+			if result.Status() != tc.status {
+				t.Errorf("expected status %+v, got %+v", tc.status, result.Status())
+			}
+			if tc.status == StatusSuccess && result.Error() != nil {
+				t.Errorf("unexpected error, got %+v", result.Error())
+			}
+			for _, code := range tc.errCodes {
+				if err := result.Error(); !IsTaskError(err, code) {
+					t.Errorf("expected error code %+v, got %+v", code, err)
+				}
+			}
+			for _, code := range tc.noCodes {
+				if err := result.Error(); IsTaskError(err, code) {
+					t.Errorf("unexpected error code %+v, got %+v", code, err)
+				}
+			}
+
+			if logs := lines(); !reflect.DeepEqual(logs, tc.logs) {
+				t.Errorf("expected logs %q, got %q", tc.logs, logs)
+			}
+			if tc.resultLogs != nil && !reflect.DeepEqual(result.Logs(), tc.resultLogs) {
+				t.Errorf("expected result logs %q, got %q", tc.resultLogs, result.Logs())
+			}
+
+			chunks := []string{}
+			for _, chunk := range handler.chunks {
+				chunks = append(chunks, string(chunk))
+			}
+			if !reflect.DeepEqual(chunks, tc.chunks) {
+				t.Errorf("expected data %#v, got %#v", tc.chunks, chunks)
+			}
 		})
 	}
 }
@@ -565,7 +1043,7 @@ func TestTaskExecCommand(t *testing.T) {
 	t.Parallel()
 
 	type testCase struct {
-		command  []string
+		command  [][]string
 		errCodes []ErrorCode
 		logs     []string
 		stdout   string
@@ -573,28 +1051,35 @@ func TestTaskExecCommand(t *testing.T) {
 	}
 	testCases := map[string]testCase{
 		"ok": {
-			command:  []string{"echo", "foo bar"},
+			command:  [][]string{{"echo", "foo bar"}},
 			errCodes: nil,
 			logs:     []string{},
 			stdout:   "foo bar\n",
 			stderr:   "",
 		},
 		"start_error": {
-			command:  []string{"this-cmd-does-not-exist"},
+			command:  [][]string{{"this-cmd-does-not-exist"}},
 			errCodes: []ErrorCode{CommandStartError},
 			logs:     []string{"ERROR (Command start): exec: \"this-cmd-does-not-exist\": executable file not found in $PATH"},
 			stdout:   "",
 			stderr:   "",
 		},
+		"empty_command": {
+			command:  [][]string{{}},
+			errCodes: []ErrorCode{CommandStartError},
+			logs:     []string{"ERROR (Command start): command is empty"},
+			stdout:   "",
+			stderr:   "",
+		},
 		"non_zero_exit_code": {
-			command:  []string{"bash", "-c", "echo output && echo error >&2 && exit 42"},
+			command:  [][]string{{"bash", "-c", "echo output && echo error >&2 && exit 42"}},
 			errCodes: []ErrorCode{CommandFailedError},
-			logs:     []string{"ERROR (Command failed): exit status 42"},
+			logs:     []string{"error", "ERROR (Command failed): exit status 42"},
 			stdout:   "output\n",
 			stderr:   "error\n",
 		},
 		"timeout": {
-			command:  []string{"bash", "-c", "sleep 1 && echo output && echo error >&2 && exit 42"},
+			command:  [][]string{{"bash", "-c", "sleep 1 && echo output && echo error >&2 && exit 42"}},
 			errCodes: []ErrorCode{CommandTimeoutError},
 			logs:     []string{"TIMEOUT (Command took more than 30ms)"},
 			stdout:   "",
@@ -612,7 +1097,7 @@ func TestTaskExecCommand(t *testing.T) {
 			stdout := bytes.NewBuffer(nil)
 			stderr := bytes.NewBuffer(nil)
 
-			if err := task.execCommand(stdout, stderr); tc.errCodes == nil {
+			if _, err := task.execCommand(stdout, stderr); tc.errCodes == nil {
 				if err != nil {
 					t.Errorf("unexpected error, got %+v", err)
 				}
@@ -636,3 +1121,218 @@ func TestTaskExecCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskExecTimeoutSignals(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		command [][]string
+		errMsg  string
+		logs    []string
+	}
+	testCases := map[string]testCase{
+		"terminated": {
+			command: [][]string{{"bash", "-c", "sleep 5; echo done"}},
+			errMsg:  "command timed out after 50ms, sent SIGTERM",
+			logs:    []string{"TIMEOUT (Command took more than 50ms)"},
+		},
+		"killed_after_grace": {
+			command: [][]string{{"bash", "-c", "trap '' TERM; sleep 5 & wait; wait"}},
+			errMsg:  "command timed out after 50ms, sent SIGTERM, then SIGKILL after 100ms",
+			logs:    []string{"TIMEOUT (Command took more than 50ms)", "TIMEOUT (Command still running after 100ms grace period)"},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			logger, lines := newTestLogger()
+			task := &Task{
+				command:   tc.command,
+				timeout:   50 * time.Millisecond,
+				killGrace: 100 * time.Millisecond,
+				logger:    logger,
+			}
+
+			start := time.Now()
+			_, err := task.execCommand(bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("expected process group to be signaled, command took %s", elapsed)
+			}
+
+			merr := new(multierror.Error)
+			if !IsTaskError(err, CommandTimeoutError) {
+				t.Fatalf("expected timeout error, got %+v", err)
+			} else if !errors.As(err, &merr) {
+				t.Fatalf("expected %T, got %#v", merr, err)
+			} else if msg := merr.Errors[0].Error(); msg != tc.errMsg {
+				t.Errorf("expected %s, got %s", tc.errMsg, msg)
+			}
+			if logs := lines(); !reflect.DeepEqual(logs, tc.logs) {
+				t.Errorf("expected logs %q, got %q", tc.logs, logs)
+			}
+		})
+	}
+}
+
+func TestTaskExecPipeline(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		command   [][]string
+		errCodes  []ErrorCode
+		errMsg    string
+		logs      []string
+		stdout    string
+		exitCodes []int
+		stderr    [][]string
+	}
+	testCases := map[string]testCase{
+		"ok": {
+			command:   [][]string{{"bash", "-c", "echo foo bar; echo first >&2"}, {"tr", "a-z", "A-Z"}, {"bash", "-c", "cat; echo last >&2"}},
+			logs:      []string{"first", "last"},
+			stdout:    "FOO BAR\n",
+			exitCodes: []int{0, 0, 0},
+			stderr:    [][]string{{"first"}, {}, {"last"}},
+		},
+		"first_stage_failed": {
+			command:   [][]string{{"bash", "-c", "echo partial; echo dump failed >&2; exit 2"}, {"cat"}},
+			errCodes:  []ErrorCode{CommandFailedError},
+			errMsg:    "command failed: stage 1: exit status 2",
+			logs:      []string{"dump failed", "ERROR (Command failed): stage 1: exit status 2"},
+			stdout:    "partial\n",
+			exitCodes: []int{2, 0},
+			stderr:    [][]string{{"dump failed"}, {}},
+		},
+		"all_stages_failed": {
+			command:   [][]string{{"false"}, {"bash", "-c", "cat; exit 3"}},
+			errCodes:  []ErrorCode{CommandFailedError},
+			errMsg:    "2 errors occurred:\n\t* command failed: stage 1: exit status 1\n\t* command failed: stage 2: exit status 3\n\n",
+			logs:      []string{"ERROR (Command failed): stage 1: exit status 1", "ERROR (Command failed): stage 2: exit status 3"},
+			stdout:    "",
+			exitCodes: []int{1, 3},
+			stderr:    [][]string{{}, {}},
+		},
+		"start_error": {
+			command:   [][]string{{"echo", "foo"}, {"this-cmd-does-not-exist"}},
+			errCodes:  []ErrorCode{CommandStartError},
+			errMsg:    "command could not be started: stage 2: exec: \"this-cmd-does-not-exist\": executable file not found in $PATH",
+			logs:      []string{"ERROR (Command start): stage 2: exec: \"this-cmd-does-not-exist\": executable file not found in $PATH"},
+			stdout:    "",
+			exitCodes: []int{-1, -1},
+			stderr:    [][]string{nil, nil},
+		},
+		"empty_stage": {
+			command:   [][]string{{"echo", "foo"}, {}},
+			errCodes:  []ErrorCode{CommandStartError},
+			errMsg:    "command could not be started: stage 2: command is empty",
+			logs:      []string{"ERROR (Command start): stage 2: command is empty"},
+			stdout:    "",
+			exitCodes: []int{-1, -1},
+			stderr:    [][]string{nil, nil},
+		},
+		"timeout": {
+			command:   [][]string{{"yes"}, {"sleep", "1"}},
+			errCodes:  []ErrorCode{CommandTimeoutError},
+			logs:      []string{"TIMEOUT (Command took more than 100ms)"},
+			stdout:    "",
+			exitCodes: []int{-1, -1},
+			stderr:    [][]string{{}, {}},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			logger, lines := newTestLogger()
+			task := &Task{
+				command: tc.command,
+				timeout: 100 * time.Millisecond,
+				logger:  logger,
+			}
+			stdout := bytes.NewBuffer(nil)
+			stderr := bytes.NewBuffer(nil)
+
+			stages, err := task.execCommand(stdout, stderr)
+			if tc.errCodes == nil && err != nil {
+				t.Errorf("unexpected error, got %+v", err)
+			}
+			for _, code := range tc.errCodes {
+				if !IsTaskError(err, code) {
+					t.Errorf("expected error code %+v, got %+v", code, err)
+				}
+			}
+			if tc.errMsg != "" && (err == nil || err.Error() != tc.errMsg) {
+				t.Errorf("expected error %q, got %q", tc.errMsg, err)
+			}
+
+			if logs := lines(); !reflect.DeepEqual(logs, tc.logs) {
+				t.Errorf("expected logs %q, got %q", tc.logs, logs)
+			}
+			if data := stdout.String(); data != tc.stdout {
+				t.Errorf("expected stdout %q, got %q", tc.stdout, data)
+			}
+
+			if len(stages) != len(tc.command) {
+				t.Fatalf("expected %d stages, got %d", len(tc.command), len(stages))
+			}
+			for i, stage := range stages {
+				if expected := shellescape.QuoteCommand(tc.command[i]); stage.Command() != expected {
+					t.Errorf("stage %d: expected command %s, got %s", i+1, expected, stage.Command())
+				}
+				if stage.ExitCode() != tc.exitCodes[i] {
+					t.Errorf("stage %d: expected exit code %d, got %d", i+1, tc.exitCodes[i], stage.ExitCode())
+				}
+				if stage.ExitCode() >= 0 && (stage.ExitCode() == 0) != (stage.Error() == nil) {
+					t.Errorf("stage %d: unexpected error %v for exit code %d", i+1, stage.Error(), stage.ExitCode())
+				}
+				if !reflect.DeepEqual(stage.Logs(), tc.stderr[i]) {
+					t.Errorf("stage %d: expected stderr %q, got %q", i+1, tc.stderr[i], stage.Logs())
+				}
+			}
+		})
+	}
+}
+
+func TestRunPipelineStages(t *testing.T) {
+	t.Parallel()
+
+	handler := &testHandler{}
+	logger, _ := newTestLogger()
+	task := &Task{
+		command: [][]string{{"bash", "-c", "echo foo; echo dumping >&2"}, {"bash", "-c", "cat; echo compressing >&2"}},
+		handler: handler,
+		logger:  logger,
+	}
+
+	res := task.Run(time.Now(), true)
+	if res.Status() != StatusSuccess {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if expected := []string{"dumping", "compressing"}; !reflect.DeepEqual(sortedCopy(res.Logs()), sortedCopy(expected)) {
+		t.Errorf("expected %q, got %q", expected, res.Logs())
+	}
+	if expected := "bash -c 'echo foo; echo dumping >&2' | bash -c 'cat; echo compressing >&2'"; res.Command() != expected {
+		t.Errorf("expected %s, got %s", expected, res.Command())
+	}
+
+	stages := res.Stages()
+	if len(stages) != 2 {
+		t.Fatalf("expected 2 stages, got %d", len(stages))
+	}
+	if expected := []string{"dumping"}; !reflect.DeepEqual(stages[0].Logs(), expected) {
+		t.Errorf("expected %q, got %q", expected, stages[0].Logs())
+	}
+	if expected := []string{"compressing"}; !reflect.DeepEqual(stages[1].Logs(), expected) {
+		t.Errorf("expected %q, got %q", expected, stages[1].Logs())
+	}
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+
+	return sorted
+}
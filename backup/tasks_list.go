@@ -22,7 +22,7 @@ func NewTasksList(tasks map[string]config.Task) (TasksList, error) {
 	return list, nil
 }
 
-func (t TasksList) Run(now time.Time, parallel uint) Results {
+func (t TasksList) Run(now time.Time, parallel uint, force bool) Results {
 	pool := make(chan bool, parallel)
 	results := Results{}
 	mutex := &sync.Mutex{}
@@ -31,7 +31,7 @@ func (t TasksList) Run(now time.Time, parallel uint) Results {
 		go func(task TaskInterface) {
 			defer func() { <-pool }()
 
-			result := task.Run(now)
+			result := task.Run(now, force)
 
 			mutex.Lock()
 			defer mutex.Unlock()
@@ -44,3 +44,12 @@ func (t TasksList) Run(now time.Time, parallel uint) Results {
 
 	return results
 }
+
+func (t TasksList) Explain(now time.Time, force bool) Decisions {
+	decisions := Decisions{}
+	for _, task := range t {
+		decisions = append(decisions, task.Explain(now, force))
+	}
+
+	return decisions
+}
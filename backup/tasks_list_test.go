@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -46,29 +47,42 @@ type testTask struct {
 	result      Result
 	delay       time.Duration
 	concurrence *concurrenceCounter
+	forced      *int32
 }
 
-func (t testTask) Run(now time.Time) Result {
+func (t testTask) Run(now time.Time, force bool) Result {
 	t.concurrence.Start()
 	defer t.concurrence.Done()
 	time.Sleep(t.delay)
 
+	if force && t.forced != nil {
+		atomic.AddInt32(t.forced, 1)
+	}
+
 	return t.result
 }
 
+func (t testTask) Name() string {
+	return t.result.Name()
+}
+
+func (t testTask) Explain(now time.Time, force bool) Decision {
+	return Decision{Name: t.result.Name(), Run: force}
+}
+
 func TestNewTasksList(t *testing.T) {
 	t.Parallel()
 
 	cfg := map[string]config.Task{
 		"foo": {
-			Command: []string{"echo", "foo bar"},
+			Command: config.Command{{"echo", "foo bar"}},
 			Env:     []string{"FOO=bar"},
 			Destination: config.Destination{
 				Type: "s3",
 			},
 		},
 		"bar": {
-			Command: []string{"echo", "bar foo"},
+			Command: config.Command{{"echo", "bar foo"}},
 			Env:     []string{"BAR=foo"},
 			Destination: config.Destination{
 				Type: "s3",
@@ -94,7 +108,7 @@ func TestNewTasksList(t *testing.T) {
 		names = append(names, task.name)
 		switch task.name {
 		case "foo":
-			if !reflect.DeepEqual(task.command, []string{"echo", "foo bar"}) {
+			if !reflect.DeepEqual(task.command, config.Command{{"echo", "foo bar"}}) {
 				t.Errorf("expected task command 'echo foo bar', got %v", task.command)
 			}
 			if !reflect.DeepEqual(task.env, []string{"FOO=bar"}) {
@@ -103,11 +117,11 @@ func TestNewTasksList(t *testing.T) {
 			if _, ok := task.handler.(*handler.S3Handler); !ok {
 				t.Errorf("expected S3Handler, got %T", task.handler)
 			}
-			if task.logger.Prefix() != "[foo] " {
-				t.Errorf("expected log prefix '[foo] ', got %s", task.logger.Prefix())
+			if name, _ := task.logger.Field("task"); name != "foo" {
+				t.Errorf("expected task field 'foo', got %v", name)
 			}
 		case "bar":
-			if !reflect.DeepEqual(task.command, []string{"echo", "bar foo"}) {
+			if !reflect.DeepEqual(task.command, config.Command{{"echo", "bar foo"}}) {
 				t.Errorf("expected task command 'echo bar foo', got %v", task.command)
 			}
 			if !reflect.DeepEqual(task.env, []string{"BAR=foo"}) {
@@ -116,8 +130,8 @@ func TestNewTasksList(t *testing.T) {
 			if _, ok := task.handler.(*handler.S3Handler); !ok {
 				t.Errorf("expected S3Handler, got %T", task.handler)
 			}
-			if task.logger.Prefix() != "[bar] " {
-				t.Errorf("expected log prefix '[bar] ', got %s", task.logger.Prefix())
+			if name, _ := task.logger.Field("task"); name != "bar" {
+				t.Errorf("expected task field 'bar', got %v", name)
 			}
 		}
 	}
@@ -133,14 +147,14 @@ func TestNewTasksListError(t *testing.T) {
 
 	cfg := map[string]config.Task{
 		"foo": {
-			Command: []string{"echo", "foo bar"},
+			Command: config.Command{{"echo", "foo bar"}},
 			Env:     []string{"FOO=bar"},
 			Destination: config.Destination{
 				Type: "s3",
 			},
 		},
 		"bar": {
-			Command: []string{"echo", "bar foo"},
+			Command: config.Command{{"echo", "bar foo"}},
 			Env:     []string{"BAR=foo"},
 		},
 	}
@@ -188,7 +202,7 @@ func TestRunTasks(t *testing.T) {
 			concurrence: meter,
 		},
 	}
-	results := tasks.Run(time.Now(), 2)
+	results := tasks.Run(time.Now(), 2, false)
 	if max := meter.Max(); max != 2 {
 		t.Errorf("expected 2 concurrent tasks, got %d", max)
 	}
@@ -207,3 +221,43 @@ func TestRunTasks(t *testing.T) {
 		t.Errorf("expected 1 skipped task, got %d", count[StatusSkipped])
 	}
 }
+
+func TestRunTasksForced(t *testing.T) {
+	t.Parallel()
+
+	meter := newConcurrenceCounter()
+	forced := int32(0)
+	tasks := TasksList{
+		testTask{
+			result:      NewResultSuccess(nil, []string{"success 1"}),
+			concurrence: meter,
+			forced:      &forced,
+		},
+		testTask{
+			result:      NewResultSuccess(nil, []string{"success 2"}),
+			concurrence: meter,
+			forced:      &forced,
+		},
+	}
+
+	if results := tasks.Run(time.Now(), 2, true); len(results) != 2 {
+		t.Errorf("expected 2 results, got %d", len(results))
+	}
+	if forced != 2 {
+		t.Errorf("expected 2 forced tasks, got %d", forced)
+	}
+}
+
+func TestExplainTasks(t *testing.T) {
+	t.Parallel()
+
+	tasks := TasksList{
+		testTask{result: NewResultSuccess(&Task{name: "foo"}, []string{})},
+		testTask{result: NewResultSuccess(&Task{name: "bar"}, []string{})},
+	}
+
+	expected := Decisions{{Name: "foo", Run: true}, {Name: "bar", Run: true}}
+	if decisions := tasks.Explain(time.Now(), true); !reflect.DeepEqual(decisions, expected) {
+		t.Errorf("expected %#v, got %#v", expected, decisions)
+	}
+}
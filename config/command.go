@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidCommand = errors.New("command must be a list of strings, or a list of lists of strings")
+
+// Command is a pipeline of one or more stages, each one being the argv of a process whose stdout is connected
+// to the stdin of the next one. In configuration files a single stage can be written as a plain list of strings.
+type Command [][]string
+
+func (c Command) String() string {
+	stages := make([]string, len(c))
+	for i, stage := range c {
+		stages[i] = shellescape.QuoteCommand(stage)
+	}
+
+	return strings.Join(stages, " | ")
+}
+
+func (c Command) clone() Command {
+	if c == nil {
+		return nil
+	}
+
+	clone := make(Command, len(c))
+	for i, stage := range c {
+		clone[i] = append([]string(nil), stage...)
+	}
+
+	return clone
+}
+
+func (c *Command) UnmarshalTOML(data interface{}) error {
+	return c.fromValue(data)
+}
+
+func (c *Command) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	return c.fromValue(value)
+}
+
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+
+	return c.fromValue(value)
+}
+
+func (c *Command) fromValue(value interface{}) error {
+	if value == nil {
+		*c = nil
+
+		return nil
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		return ErrInvalidCommand
+	} else if len(items) == 0 {
+		*c = Command{}
+
+		return nil
+	}
+
+	if _, ok := items[0].(string); ok {
+		stage, err := stringsFromValues(items)
+		if err != nil {
+			return err
+		}
+		*c = Command{stage}
+
+		return nil
+	}
+
+	command := make(Command, len(items))
+	for i, item := range items {
+		values, ok := item.([]interface{})
+		if !ok {
+			return ErrInvalidCommand
+		}
+
+		stage, err := stringsFromValues(values)
+		if err != nil {
+			return err
+		}
+		command[i] = stage
+	}
+	*c = command
+
+	return nil
+}
+
+func stringsFromValues(values []interface{}) ([]string, error) {
+	strings := make([]string, len(values))
+	for i, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			return nil, ErrInvalidCommand
+		}
+		strings[i] = str
+	}
+
+	return strings, nil
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestCommandString(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]Command{
+		"":                                   nil,
+		"echo 'foo bar'":                     {{"echo", "foo bar"}},
+		"pg_dump my_database | zstd -19":     {{"pg_dump", "my_database"}, {"zstd", "-19"}},
+		"tar -cf- /srv | gzip | split -b 1G": {{"tar", "-cf-", "/srv"}, {"gzip"}, {"split", "-b", "1G"}},
+	}
+	for expected, command := range testCases {
+		if actual := command.String(); actual != expected {
+			t.Errorf("expected %s, got %s", expected, actual)
+		}
+	}
+}
+
+func TestLoadConfigurationCommand(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		file     string
+		data     string
+		expected map[string]Command
+	}
+	testCases := map[string]testCase{
+		"toml": {
+			file: "config.toml",
+			data: `
+[single]
+command = ["echo", "foo bar"]
+[pipeline]
+command = [["pg_dump", "my_database"], ["zstd", "-19"]]
+[empty]
+command = []
+`,
+			expected: map[string]Command{
+				"single":   {{"echo", "foo bar"}},
+				"pipeline": {{"pg_dump", "my_database"}, {"zstd", "-19"}},
+				"empty":    {},
+			},
+		},
+		"json": {
+			file: "config.json",
+			data: `{
+				"single": {"command": ["echo", "foo bar"]},
+				"pipeline": {"command": [["pg_dump", "my_database"], ["zstd", "-19"]]},
+				"empty": {"command": []},
+				"missing": {}
+			}`,
+			expected: map[string]Command{
+				"single":   {{"echo", "foo bar"}},
+				"pipeline": {{"pg_dump", "my_database"}, {"zstd", "-19"}},
+				"empty":    {},
+				"missing":  nil,
+			},
+		},
+		"yaml": {
+			file: "config.yaml",
+			data: `
+single:
+  command: [echo, foo bar]
+pipeline:
+  command:
+    - [pg_dump, my_database]
+    - [zstd, "-19"]
+`,
+			expected: map[string]Command{
+				"single":   {{"echo", "foo bar"}},
+				"pipeline": {{"pg_dump", "my_database"}, {"zstd", "-19"}},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			filePath := path.Join(t.TempDir(), tc.file)
+			if err := os.WriteFile(filePath, []byte(tc.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := LoadConfiguration(filePath)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			actual := map[string]Command{}
+			for name, task := range config {
+				actual[name] = task.Command
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLoadConfigurationCommandError(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]string{
+		"string.toml":      "[foo]\ncommand = \"echo foo\"\n",
+		"nested.toml":      "[foo]\ncommand = [[\"echo\", [\"foo\"]]]\n",
+		"number.json":      `{"foo": {"command": ["echo", 42]}}`,
+		"mixed.json":       `{"foo": {"command": [["echo", "foo"], "cat"]}}`,
+		"object.yaml":      "foo:\n  command:\n    bin: echo\n",
+		"mixed_first.yaml": "foo:\n  command: [[echo], [cat], true]\n",
+	}
+	for name, data := range testCases {
+		name, data := name, data
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			filePath := path.Join(t.TempDir(), name)
+			if err := os.WriteFile(filePath, []byte(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if config, err := LoadConfiguration(filePath); err == nil {
+				t.Errorf("expected error, got %#v", config)
+			} else if !errors.Is(err, ErrInvalidCommand) {
+				t.Errorf("expected %#v, got %#v", ErrInvalidCommand, err)
+			}
+		})
+	}
+}
@@ -21,23 +21,31 @@ const (
 )
 
 type Destination struct {
-	Type DestinationType         `json:"type" toml:"type"`
-	S3   S3DestinationDefinition `json:"s3" toml:"s3"`
+	Type DestinationType         `json:"type" toml:"type" yaml:"type"`
+	S3   S3DestinationDefinition `json:"s3" toml:"s3" yaml:"s3"`
 }
 
 type S3DestinationDefinition struct {
-	Bucket      string         `json:"bucket" toml:"bucket"`
-	Prefix      string         `json:"prefix" toml:"prefix"`
-	Suffix      string         `json:"suffix" toml:"suffix"`
-	Region      string         `json:"region" toml:"region"`
-	Credentials *S3Credentials `json:"credentials" toml:"credentials"`
-	Profile     *string        `json:"profile" toml:"profile"`
+	Bucket      string         `json:"bucket" toml:"bucket" yaml:"bucket"`
+	Prefix      string         `json:"prefix" toml:"prefix" yaml:"prefix"`
+	Suffix      string         `json:"suffix" toml:"suffix" yaml:"suffix"`
+	Region      string         `json:"region" toml:"region" yaml:"region"`
+	Credentials *S3Credentials `json:"credentials" toml:"credentials" yaml:"credentials"`
+	Profile     *string        `json:"profile" toml:"profile" yaml:"profile"`
 }
 
 type S3Credentials struct {
-	AccessKeyId     string `json:"access_key_id" toml:"access_key_id"`
-	SecretAccessKey string `json:"secret_access_key" toml:"secret_access_key"`
-	SessionToken    string `json:"session_token,omitempty" toml:"session_token,omitempty"`
+	AccessKeyId     string `json:"access_key_id" toml:"access_key_id" yaml:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key" toml:"secret_access_key" yaml:"secret_access_key"`
+	SessionToken    string `json:"session_token,omitempty" toml:"session_token,omitempty" yaml:"session_token,omitempty"`
+}
+
+func (c S3Credentials) String() string {
+	return fmt.Sprintf("{AccessKeyId:%s SecretAccessKey:[REDACTED]}", c.AccessKeyId)
+}
+
+func (c S3Credentials) GoString() string {
+	return fmt.Sprintf("config.S3Credentials{AccessKeyId:%q, SecretAccessKey:\"[REDACTED]\", SessionToken:\"[REDACTED]\"}", c.AccessKeyId)
 }
 
 func (d S3DestinationDefinition) credentials() *credentials.Credentials {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 )
@@ -268,3 +269,20 @@ func TestParseTimestamp(t *testing.T) {
 		})
 	}
 }
+
+func TestCredentialsRedacted(t *testing.T) {
+	t.Parallel()
+
+	credentials := &S3Credentials{
+		AccessKeyId:     testAwsAccessKeyId,
+		SecretAccessKey: testAwsSecretAccessKey,
+		SessionToken:    testAwsSessionToken,
+	}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if actual := fmt.Sprintf(format, credentials); strings.Contains(actual, testAwsSecretAccessKey) || strings.Contains(actual, testAwsSessionToken) {
+			t.Errorf("expected secrets to be redacted with format %s, got %s", format, actual)
+		} else if !strings.Contains(actual, testAwsAccessKeyId) {
+			t.Errorf("expected access key id to be included with format %s, got %s", format, actual)
+		}
+	}
+}
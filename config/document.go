@@ -0,0 +1,183 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+type document interface {
+	Keys() []string
+	Decode(key string, target interface{}) error
+	UnknownKeys() []string
+}
+
+func isSupportedFile(path string) bool {
+	for _, ext := range []string{".toml", ".json", ".yaml", ".yml"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func loadDocument(path string) (document, error) {
+	switch {
+	case strings.HasSuffix(path, ".toml"):
+		return loadTomlDocument(path)
+	case strings.HasSuffix(path, ".json"):
+		return loadJsonDocument(path)
+	case strings.HasSuffix(path, ".yaml"), strings.HasSuffix(path, ".yml"):
+		return loadYamlDocument(path)
+	}
+
+	return nil, ErrUnsupportedConfigFile
+}
+
+type tomlDocument struct {
+	md     toml.MetaData
+	values map[string]toml.Primitive
+}
+
+func loadTomlDocument(path string) (*tomlDocument, error) {
+	doc := &tomlDocument{}
+	md, err := toml.DecodeFile(path, &doc.values)
+	if err != nil {
+		return nil, err
+	}
+	doc.md = md
+
+	return doc, nil
+}
+
+func (d *tomlDocument) Keys() []string {
+	keys := make([]string, 0, len(d.values))
+	for key := range d.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (d *tomlDocument) Decode(key string, target interface{}) error {
+	return d.md.PrimitiveDecode(d.values[key], target)
+}
+
+func (d *tomlDocument) UnknownKeys() []string {
+	undecoded := d.md.Undecoded()
+	keys := make([]string, len(undecoded))
+	for i, key := range undecoded {
+		keys[i] = key.String()
+	}
+
+	return keys
+}
+
+type jsonDocument struct {
+	values  map[string]json.RawMessage
+	unknown []string
+}
+
+func loadJsonDocument(path string) (*jsonDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &jsonDocument{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&doc.values); err != nil {
+		return nil, err
+	} else if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%s: unexpected data after configuration", path)
+	}
+
+	return doc, nil
+}
+
+func (d *jsonDocument) Keys() []string {
+	keys := make([]string, 0, len(d.values))
+	for key := range d.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (d *jsonDocument) Decode(key string, target interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(d.values[key]))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err == nil {
+		return nil
+	} else if !strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(d.values[key], &value); err != nil {
+		return err
+	}
+	d.unknown = append(d.unknown, unknownKeys(value, reflect.TypeOf(target), "json", true, key)...)
+
+	return json.Unmarshal(d.values[key], target)
+}
+
+func (d *jsonDocument) UnknownKeys() []string {
+	return d.unknown
+}
+
+type yamlDocument struct {
+	values  map[string]yaml.Node
+	unknown []string
+}
+
+func loadYamlDocument(path string) (*yamlDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &yamlDocument{values: map[string]yaml.Node{}}
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&doc.values); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+func (d *yamlDocument) Keys() []string {
+	keys := make([]string, 0, len(d.values))
+	for key := range d.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (d *yamlDocument) Decode(key string, target interface{}) error {
+	node := d.values[key]
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	d.unknown = append(d.unknown, unknownKeys(value, reflect.TypeOf(target), "yaml", false, key)...)
+
+	return node.Decode(target)
+}
+
+func (d *yamlDocument) UnknownKeys() []string {
+	return d.unknown
+}
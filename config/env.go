@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+type InheritEnvMode string
+
+const (
+	InheritEnvAll       InheritEnvMode = "all"
+	InheritEnvNone      InheritEnvMode = "none"
+	InheritEnvAllowlist InheritEnvMode = "allowlist"
+)
+
+func (m InheritEnvMode) IsValid() bool {
+	switch m {
+	case InheritEnvAll, InheritEnvNone, InheritEnvAllowlist, "":
+		return true
+	}
+
+	return false
+}
+
+// Reports whether the variable name should be inherited from the environment of the backup process.
+func (m InheritEnvMode) Inherits(name string, allowlist []string) bool {
+	switch m {
+	case InheritEnvAll, "":
+		return true
+	case InheritEnvAllowlist:
+		for _, pattern := range allowlist {
+			if matched, err := path.Match(pattern, name); err == nil && matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (t Task) validateEnv() []string {
+	messages := []string{}
+	if !t.InheritEnv.IsValid() {
+		messages = append(messages, fmt.Sprintf("unknown inherit_env mode %q", t.InheritEnv))
+	}
+	if len(t.EnvAllowlist) > 0 && t.InheritEnv != InheritEnvAllowlist {
+		messages = append(messages, fmt.Sprintf("env_allowlist requires inherit_env to be %q", InheritEnvAllowlist))
+	}
+	for _, pattern := range t.EnvAllowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			messages = append(messages, fmt.Sprintf("invalid env_allowlist pattern %q: %s", pattern, err))
+		}
+	}
+
+	return messages
+}
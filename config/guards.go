@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/chialab/streamlined-backup/utils"
+)
+
+// What to do with an artifact that failed one of the size guards of its task.
+type SuspiciousAction string
+
+const (
+	SuspiciousKeep  SuspiciousAction = "keep"
+	SuspiciousTag   SuspiciousAction = "tag"
+	SuspiciousAbort SuspiciousAction = "abort"
+)
+
+func (a SuspiciousAction) IsValid() bool {
+	switch a {
+	case SuspiciousKeep, SuspiciousTag, SuspiciousAbort, "":
+		return true
+	}
+
+	return false
+}
+
+func (t Task) validateGuards() []string {
+	messages := []string{}
+	sizes := map[string]int64{}
+	for _, size := range []struct{ name, value string }{{"min_size", t.MinSize}, {"max_size", t.MaxSize}} {
+		if size.value == "" {
+			continue
+		} else if value, err := utils.ParseBytes(size.value); err != nil {
+			messages = append(messages, fmt.Sprintf("invalid %s: %s", size.name, err))
+		} else if value <= 0 {
+			messages = append(messages, fmt.Sprintf("invalid %s: %s is not positive", size.name, size.value))
+		} else {
+			sizes[size.name] = value
+		}
+	}
+	if minSize, maxSize := sizes["min_size"], sizes["max_size"]; minSize > 0 && maxSize > 0 && minSize > maxSize {
+		messages = append(messages, "min_size is greater than max_size")
+	}
+	if t.MaxSizeChangePercent < 0 {
+		messages = append(messages, fmt.Sprintf("invalid max_size_change_percent: %d is not positive", t.MaxSizeChangePercent))
+	}
+	if !t.OnSuspicious.IsValid() {
+		messages = append(messages, fmt.Sprintf("unknown on_suspicious action %q", t.OnSuspicious))
+	}
+
+	return messages
+}
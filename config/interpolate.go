@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrUnterminatedReference = errors.New("unterminated variable reference")
+
+// Expands `${VAR}` and `${VAR:-default}` references to environment variables. `$$` is an escaped `$`.
+func expand(value string) (string, error) {
+	var builder strings.Builder
+	for {
+		pos := strings.IndexByte(value, '$')
+		if pos == -1 || pos == len(value)-1 {
+			builder.WriteString(value)
+
+			return builder.String(), nil
+		}
+
+		builder.WriteString(value[:pos])
+		switch value[pos+1] {
+		case '$':
+			builder.WriteByte('$')
+			value = value[pos+2:]
+		case '{':
+			end := strings.IndexByte(value[pos:], '}')
+			if end == -1 {
+				return "", ErrUnterminatedReference
+			}
+
+			name, fallback, hasFallback := value[pos+2:pos+end], "", false
+			if sep := strings.Index(name, ":-"); sep != -1 {
+				name, fallback, hasFallback = name[:sep], name[sep+2:], true
+			}
+
+			if env, ok := os.LookupEnv(name); ok && (env != "" || !hasFallback) {
+				builder.WriteString(env)
+			} else if hasFallback {
+				builder.WriteString(fallback)
+			} else {
+				return "", fmt.Errorf("environment variable %q is not set", name)
+			}
+			value = value[pos+end+1:]
+		default:
+			builder.WriteByte('$')
+			value = value[pos+1:]
+		}
+	}
+}
+
+// Resolves `env:VAR` and `file:/path/to/secret` references, or expands variables in any other value.
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		if env, ok := os.LookupEnv(name); ok {
+			return env, nil
+		}
+
+		return "", fmt.Errorf("environment variable %q is not set", name)
+	case strings.HasPrefix(value, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	return expand(value)
+}
+
+func (t *Task) interpolate() error {
+	var err error
+	if t.Cwd, err = expand(t.Cwd); err != nil {
+		return fmt.Errorf("cwd: %w", err)
+	}
+	if t.User, err = expand(t.User); err != nil {
+		return fmt.Errorf("user: %w", err)
+	}
+	if t.Group, err = expand(t.Group); err != nil {
+		return fmt.Errorf("group: %w", err)
+	}
+	if t.Timeout, err = expand(t.Timeout); err != nil {
+		return fmt.Errorf("timeout: %w", err)
+	}
+	if t.KillGrace, err = expand(t.KillGrace); err != nil {
+		return fmt.Errorf("kill_grace: %w", err)
+	}
+	if t.EnvFile, err = expand(t.EnvFile); err != nil {
+		return fmt.Errorf("env_file: %w", err)
+	}
+
+	env := make([]string, len(t.Env))
+	for i, entry := range t.Env {
+		sep := strings.IndexByte(entry, '=')
+		if sep == -1 {
+			env[i] = entry
+			continue
+		}
+
+		name := entry[:sep]
+		if value, err := resolveSecret(entry[sep+1:]); err != nil {
+			return fmt.Errorf("env %s: %w", name, err)
+		} else {
+			env[i] = name + "=" + value
+		}
+	}
+	if t.Env != nil {
+		t.Env = env
+	}
+
+	if t.Heartbeat, err = resolveSecrets(t.Heartbeat); err != nil {
+		return fmt.Errorf("heartbeat: %w", err)
+	}
+
+	if err := t.Destination.S3.interpolate(); err != nil {
+		return fmt.Errorf("destination.s3.%w", err)
+	}
+
+	return nil
+}
+
+func (d *S3DestinationDefinition) interpolate() error {
+	if d.Profile != nil {
+		profile := *d.Profile
+		d.Profile = &profile
+	}
+
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"bucket", &d.Bucket},
+		{"prefix", &d.Prefix},
+		{"suffix", &d.Suffix},
+		{"region", &d.Region},
+		{"profile", d.Profile},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		} else if value, err := expand(*field.value); err != nil {
+			return fmt.Errorf("%s: %w", field.name, err)
+		} else {
+			*field.value = value
+		}
+	}
+
+	if d.Credentials != nil {
+		credentials := *d.Credentials
+		if err := credentials.interpolate(); err != nil {
+			return fmt.Errorf("credentials.%w", err)
+		}
+		d.Credentials = &credentials
+	}
+
+	return nil
+}
+
+func (c *S3Credentials) interpolate() error {
+	var err error
+	if c.AccessKeyId, err = resolveSecret(c.AccessKeyId); err != nil {
+		return fmt.Errorf("access_key_id: %w", err)
+	}
+	if c.SecretAccessKey, err = resolveSecret(c.SecretAccessKey); err != nil {
+		return fmt.Errorf("secret_access_key: %w", err)
+	}
+	if c.SessionToken, err = resolveSecret(c.SessionToken); err != nil {
+		return fmt.Errorf("session_token: %w", err)
+	}
+
+	return nil
+}
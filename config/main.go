@@ -1,43 +1,287 @@
 package config
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
+	"sort"
 
-	"github.com/BurntSushi/toml"
 	"github.com/chialab/streamlined-backup/utils"
+	"github.com/hashicorp/go-multierror"
 )
 
 var ErrUnsupportedConfigFile = errors.New("unsupported config file")
 
+const (
+	includeKey  = "include"
+	defaultsKey = "defaults"
+)
+
 type Task struct {
-	Schedule    utils.ScheduleExpression `json:"schedule" toml:"schedule"`
-	Command     []string                 `json:"command" toml:"command"`
-	Cwd         string                   `json:"cwd" toml:"cwd"`
-	Env         []string                 `json:"env" toml:"env"`
-	Timeout     string                   `json:"timeout" toml:"timeout"`
-	Destination Destination              `json:"destination" toml:"destination"`
+	Schedule             utils.ScheduleExpression `json:"schedule" toml:"schedule" yaml:"schedule"`
+	Command              Command                  `json:"command" toml:"command" yaml:"command"`
+	Cwd                  string                   `json:"cwd" toml:"cwd" yaml:"cwd"`
+	Env                  []string                 `json:"env" toml:"env" yaml:"env"`
+	EnvFile              string                   `json:"env_file" toml:"env_file" yaml:"env_file"`
+	InheritEnv           InheritEnvMode           `json:"inherit_env" toml:"inherit_env" yaml:"inherit_env"`
+	EnvAllowlist         []string                 `json:"env_allowlist" toml:"env_allowlist" yaml:"env_allowlist"`
+	Before               []string                 `json:"before" toml:"before" yaml:"before"`
+	After                []string                 `json:"after" toml:"after" yaml:"after"`
+	OnSuccess            []string                 `json:"on_success" toml:"on_success" yaml:"on_success"`
+	OnFailure            []string                 `json:"on_failure" toml:"on_failure" yaml:"on_failure"`
+	User                 string                   `json:"user" toml:"user" yaml:"user"`
+	Group                string                   `json:"group" toml:"group" yaml:"group"`
+	Nice                 *int                     `json:"nice" toml:"nice" yaml:"nice"`
+	IONice               *IONice                  `json:"ionice" toml:"ionice" yaml:"ionice"`
+	Rlimits              *Rlimits                 `json:"rlimits" toml:"rlimits" yaml:"rlimits"`
+	Timeout              string                   `json:"timeout" toml:"timeout" yaml:"timeout"`
+	KillGrace            string                   `json:"kill_grace" toml:"kill_grace" yaml:"kill_grace"`
+	MinSize              string                   `json:"min_size" toml:"min_size" yaml:"min_size"`
+	MaxSize              string                   `json:"max_size" toml:"max_size" yaml:"max_size"`
+	MaxSizeChangePercent int                      `json:"max_size_change_percent" toml:"max_size_change_percent" yaml:"max_size_change_percent"`
+	OnSuspicious         SuspiciousAction         `json:"on_suspicious" toml:"on_suspicious" yaml:"on_suspicious"`
+	Notify               []string                 `json:"notify" toml:"notify" yaml:"notify"`
+	Heartbeat            []string                 `json:"heartbeat" toml:"heartbeat" yaml:"heartbeat"`
+	Destination          Destination              `json:"destination" toml:"destination" yaml:"destination"`
+}
+
+func (t Task) clone() Task {
+	clone := t
+	clone.Command = t.Command.clone()
+	clone.Env = append([]string(nil), t.Env...)
+	clone.EnvAllowlist = append([]string(nil), t.EnvAllowlist...)
+	clone.Before = append([]string(nil), t.Before...)
+	clone.After = append([]string(nil), t.After...)
+	clone.OnSuccess = append([]string(nil), t.OnSuccess...)
+	clone.OnFailure = append([]string(nil), t.OnFailure...)
+	clone.Notify = append([]string(nil), t.Notify...)
+	clone.Heartbeat = append([]string(nil), t.Heartbeat...)
+	if t.Nice != nil {
+		nice := *t.Nice
+		clone.Nice = &nice
+	}
+	clone.IONice = t.IONice.clone()
+	clone.Rlimits = t.Rlimits.clone()
+	if t.Destination.S3.Profile != nil {
+		profile := *t.Destination.S3.Profile
+		clone.Destination.S3.Profile = &profile
+	}
+	if t.Destination.S3.Credentials != nil {
+		credentials := *t.Destination.S3.Credentials
+		clone.Destination.S3.Credentials = &credentials
+	}
+
+	return clone
+}
+
+func (t *Task) inherit(defaults Task) {
+	// Credentials and profile are mutually exclusive: setting one of them replaces the inherited other.
+	s3, inherited := &t.Destination.S3, defaults.Destination.S3
+	if inherited.Credentials == nil && s3.Credentials != nil && inherited.Profile != nil {
+		s3.Profile = nil
+	} else if inherited.Profile == nil && s3.Profile != nil && inherited.Credentials != nil {
+		s3.Credentials = nil
+	}
+}
+
+type source struct {
+	path string
+	doc  document
+}
+
+// Tasks and notifiers defined in a configuration file and its includes.
+type Configuration struct {
+	Tasks     map[string]Task
+	Notifiers map[string]Notifier
+}
+
+// Loads both tasks and notifiers, reading each file of the configuration only once.
+func Load(path string) (*Configuration, error) {
+	sources, err := loadSources(path, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := tasksFromSources(sources)
+	if err != nil {
+		return nil, err
+	}
+	notifiers, err := notifiersFromSources(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Configuration{Tasks: tasks, Notifiers: notifiers}, nil
 }
 
 func LoadConfiguration(path string) (map[string]Task, error) {
-	var config map[string]Task
-	switch {
-	case strings.HasSuffix(path, ".toml"):
-		if _, err := toml.DecodeFile(path, &config); err != nil {
-			return nil, err
+	sources, err := loadSources(path, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	return tasksFromSources(sources)
+}
+
+func tasksFromSources(sources []source) (map[string]Task, error) {
+	defaults, defaultsPath := Task{}, ""
+	for _, src := range sources {
+		for _, key := range src.doc.Keys() {
+			if key != defaultsKey {
+				continue
+			} else if defaultsPath != "" {
+				return nil, fmt.Errorf("%s: defaults already defined in %s", src.path, defaultsPath)
+			} else if err := src.doc.Decode(key, &defaults); err != nil {
+				return nil, fmt.Errorf("%s: %w", src.path, err)
+			}
+			defaultsPath = src.path
 		}
-		return config, nil
-	case strings.HasSuffix(path, ".json"):
-		if data, err := os.ReadFile(path); err != nil {
-			return nil, err
-		} else if err := json.Unmarshal(data, &config); err != nil {
-			return nil, err
+	}
+
+	config, origins := map[string]Task{}, map[string]string{}
+	for _, src := range sources {
+		for _, name := range src.doc.Keys() {
+			if name == includeKey || name == defaultsKey {
+				continue
+			} else if name == notifiersKey {
+				// Notifiers are read by notifiersFromSources, but they are decoded here too so that LoadConfiguration
+				// reports their unknown keys.
+				if err := src.doc.Decode(name, &map[string]Notifier{}); err != nil {
+					return nil, fmt.Errorf("%s: %w", src.path, err)
+				}
+				continue
+			} else if origin, ok := origins[name]; ok {
+				return nil, fmt.Errorf("%s: task %q already defined in %s", src.path, name, origin)
+			}
+
+			task := defaults.clone()
+			if err := src.doc.Decode(name, &task); err != nil {
+				return nil, fmt.Errorf("%s: %w", src.path, err)
+			}
+			task.inherit(defaults)
+
+			config[name], origins[name] = task, src.path
+		}
+	}
+
+	var unknownKeysErr *multierror.Error
+	for _, src := range sources {
+		if err := newUnknownKeysError(src.path, src.doc.UnknownKeys()); err != nil {
+			unknownKeysErr = multierror.Append(unknownKeysErr, err)
+		}
+	}
+	if err := unknownKeysErr.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		task := config[name]
+		if err := task.interpolate(); err != nil {
+			return nil, fmt.Errorf("%s: task %q: %w", origins[name], name, err)
 		}
+		config[name] = task
+	}
+
+	return config, nil
+}
+
+// Lists the files the configuration at path is made of, including those read from directories and includes.
+func ConfigurationFiles(path string) ([]string, error) {
+	sources, err := loadSources(path, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, len(sources))
+	for i, src := range sources {
+		files[i] = src.path
+	}
+
+	return files, nil
+}
+
+func loadSources(path string, seen map[string]bool) ([]source, error) {
+	if abs, err := filepath.Abs(path); err != nil {
+		return nil, err
+	} else if seen[abs] {
+		return []source{}, nil
+	} else {
+		seen[abs] = true
+	}
+
+	if !isSupportedFile(path) {
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			return nil, ErrUnsupportedConfigFile
+		}
+
+		return loadDirectory(path, seen)
+	}
 
-		return config, nil
+	doc, err := loadDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	sources := []source{{path: path, doc: doc}}
+
+	for _, key := range doc.Keys() {
+		if key != includeKey {
+			continue
+		}
+
+		var patterns []string
+		if err := doc.Decode(key, &patterns); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, pattern := range patterns {
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid include pattern %q: %w", path, pattern, err)
+			}
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && !info.IsDir() && !isSupportedFile(match) {
+					continue
+				}
+
+				included, err := loadSources(match, seen)
+				if err != nil {
+					return nil, fmt.Errorf("%s: could not include %s: %w", path, match, err)
+				}
+				sources = append(sources, included...)
+			}
+		}
+	}
+
+	return sources, nil
+}
+
+func loadDirectory(path string, seen map[string]bool) ([]source, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []source{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isSupportedFile(entry.Name()) {
+			continue
+		}
+
+		loaded, err := loadSources(filepath.Join(path, entry.Name()), seen)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, loaded...)
 	}
 
-	return nil, ErrUnsupportedConfigFile
+	return sources, nil
 }
@@ -0,0 +1,353 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const notifiersKey = "notifiers"
+
+type NotifierType string
+
+const (
+	SlackNotifier     NotifierType = "slack"
+	TeamsNotifier     NotifierType = "teams"
+	DiscordNotifier   NotifierType = "discord"
+	WebhookNotifier   NotifierType = "webhook"
+	EmailNotifier     NotifierType = "email"
+	PagerDutyNotifier NotifierType = "pagerduty"
+	OpsgenieNotifier  NotifierType = "opsgenie"
+)
+
+type NotificationPolicy string
+
+const (
+	PolicyAlways       NotificationPolicy = "always"
+	PolicyFailuresOnly NotificationPolicy = "failures_only"
+	PolicyOnChange     NotificationPolicy = "on_change"
+	PolicyDailyDigest  NotificationPolicy = "daily_digest"
+	PolicyWeeklyDigest NotificationPolicy = "weekly_digest"
+)
+
+type Notifier struct {
+	Type      NotifierType       `json:"type" toml:"type" yaml:"type"`
+	Policy    NotificationPolicy `json:"policy" toml:"policy" yaml:"policy"`
+	StateFile string             `json:"state_file" toml:"state_file" yaml:"state_file"`
+	Slack     ChatNotifier       `json:"slack" toml:"slack" yaml:"slack"`
+	Teams     ChatNotifier       `json:"teams" toml:"teams" yaml:"teams"`
+	Discord   ChatNotifier       `json:"discord" toml:"discord" yaml:"discord"`
+	Webhook   WebhookDefinition  `json:"webhook" toml:"webhook" yaml:"webhook"`
+	Email     EmailDefinition    `json:"email" toml:"email" yaml:"email"`
+	PagerDuty IncidentDefinition `json:"pagerduty" toml:"pagerduty" yaml:"pagerduty"`
+	Opsgenie  IncidentDefinition `json:"opsgenie" toml:"opsgenie" yaml:"opsgenie"`
+}
+
+type ChatNotifier struct {
+	Webhooks []string `json:"webhooks" toml:"webhooks" yaml:"webhooks"`
+}
+
+type WebhookDefinition struct {
+	URLs            []string          `json:"urls" toml:"urls" yaml:"urls"`
+	Payload         string            `json:"payload" toml:"payload" yaml:"payload"`
+	PayloadFile     string            `json:"payload_file" toml:"payload_file" yaml:"payload_file"`
+	Headers         map[string]string `json:"headers" toml:"headers" yaml:"headers"`
+	Secret          string            `json:"secret" toml:"secret" yaml:"secret"`
+	SignatureHeader string            `json:"signature_header" toml:"signature_header" yaml:"signature_header"`
+	Aggregate       bool              `json:"aggregate" toml:"aggregate" yaml:"aggregate"`
+}
+
+type EmailDefinition struct {
+	Host     string   `json:"host" toml:"host" yaml:"host"`
+	Port     int      `json:"port" toml:"port" yaml:"port"`
+	Security string   `json:"security" toml:"security" yaml:"security"`
+	Auth     string   `json:"auth" toml:"auth" yaml:"auth"`
+	Username string   `json:"username" toml:"username" yaml:"username"`
+	Password string   `json:"password" toml:"password" yaml:"password"`
+	From     string   `json:"from" toml:"from" yaml:"from"`
+	To       []string `json:"to" toml:"to" yaml:"to"`
+}
+
+type IncidentDefinition struct {
+	// PagerDuty integration routing key, or Opsgenie API key.
+	Key    string `json:"key" toml:"key" yaml:"key"`
+	URL    string `json:"url" toml:"url" yaml:"url"`
+	Source string `json:"source" toml:"source" yaml:"source"`
+}
+
+type NotifierValidationError struct {
+	Notifier string
+	Message  string
+}
+
+func (e NotifierValidationError) Error() string {
+	return fmt.Sprintf("notifier %q: %s", e.Notifier, e.Message)
+}
+
+// Reads the notifiers defined in the `notifiers` section of the configuration files.
+func notifiersFromSources(sources []source) (map[string]Notifier, error) {
+	notifiers, origins := map[string]Notifier{}, map[string]string{}
+	for _, src := range sources {
+		for _, key := range src.doc.Keys() {
+			if key != notifiersKey {
+				continue
+			}
+
+			defined := map[string]Notifier{}
+			if err := src.doc.Decode(key, &defined); err != nil {
+				return nil, fmt.Errorf("%s: %w", src.path, err)
+			}
+			for name, notifier := range defined {
+				if origin, ok := origins[name]; ok {
+					return nil, fmt.Errorf("%s: notifier %q already defined in %s", src.path, name, origin)
+				} else if err := notifier.interpolate(filepath.Dir(src.path)); err != nil {
+					return nil, fmt.Errorf("%s: notifier %q: %w", src.path, name, err)
+				}
+				notifiers[name], origins[name] = notifier, src.path
+			}
+		}
+	}
+
+	// Tasks are not decoded here, so only keys within notifiers are reported.
+	var unknownKeysErr *multierror.Error
+	for _, src := range sources {
+		unknown := []string{}
+		for _, key := range src.doc.UnknownKeys() {
+			if strings.HasPrefix(key, notifiersKey+".") {
+				unknown = append(unknown, key)
+			}
+		}
+		if err := newUnknownKeysError(src.path, unknown); err != nil {
+			unknownKeysErr = multierror.Append(unknownKeysErr, err)
+		}
+	}
+	if err := unknownKeysErr.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	return notifiers, nil
+}
+
+// Checks notifier definitions, and that tasks only reference notifiers that are defined.
+func ValidateNotifiers(notifiers map[string]Notifier, tasks map[string]Task) error {
+	names := make([]string, 0, len(notifiers))
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errors *multierror.Error
+	// Notifiers sharing a state file would overwrite each other's state.
+	stateFiles := map[string]string{}
+	for _, name := range names {
+		for _, message := range notifiers[name].validate() {
+			errors = multierror.Append(errors, &NotifierValidationError{Notifier: name, Message: message})
+		}
+		if stateFile := notifiers[name].StateFile; stateFile != "" {
+			if other, ok := stateFiles[filepath.Clean(stateFile)]; ok {
+				message := fmt.Sprintf("state_file %q is also used by notifier %q", stateFile, other)
+				errors = multierror.Append(errors, &NotifierValidationError{Notifier: name, Message: message})
+			} else {
+				stateFiles[filepath.Clean(stateFile)] = name
+			}
+		}
+	}
+
+	taskNames := make([]string, 0, len(tasks))
+	for name := range tasks {
+		taskNames = append(taskNames, name)
+	}
+	sort.Strings(taskNames)
+	for _, name := range taskNames {
+		for _, notifier := range tasks[name].Notify {
+			if _, ok := notifiers[notifier]; !ok {
+				errors = multierror.Append(errors, &ValidationError{Task: name, Message: fmt.Sprintf("unknown notifier %q", notifier)})
+			}
+		}
+	}
+
+	return errors.ErrorOrNil()
+}
+
+func (n Notifier) validate() []string {
+	messages := []string{}
+	switch n.Policy {
+	case "", PolicyAlways, PolicyFailuresOnly:
+	case PolicyOnChange, PolicyDailyDigest, PolicyWeeklyDigest:
+		// The daemon needs the file too, as its notifiers are built again when the configuration is reloaded.
+		if n.StateFile == "" {
+			messages = append(messages, fmt.Sprintf("state_file is required by policy %q", n.Policy))
+		}
+	default:
+		messages = append(messages, fmt.Sprintf("unknown policy %q", n.Policy))
+	}
+
+	switch n.Type {
+	case SlackNotifier:
+		return append(messages, n.Slack.validate("slack")...)
+	case TeamsNotifier:
+		return append(messages, n.Teams.validate("teams")...)
+	case DiscordNotifier:
+		return append(messages, n.Discord.validate("discord")...)
+	case WebhookNotifier:
+		return append(messages, n.Webhook.validate()...)
+	case EmailNotifier:
+		return append(messages, n.Email.validate()...)
+	case PagerDutyNotifier:
+		return append(messages, n.PagerDuty.validate("pagerduty", n.Policy)...)
+	case OpsgenieNotifier:
+		return append(messages, n.Opsgenie.validate("opsgenie", n.Policy)...)
+	case "":
+		return append(messages, "type is required")
+	}
+
+	return append(messages, fmt.Sprintf("unknown notifier type %q", n.Type))
+}
+
+func (c ChatNotifier) validate(prefix string) []string {
+	if len(c.Webhooks) == 0 {
+		return []string{prefix + ".webhooks is required"}
+	}
+
+	return []string{}
+}
+
+func (d WebhookDefinition) validate() []string {
+	messages := []string{}
+	if len(d.URLs) == 0 {
+		messages = append(messages, "webhook.urls is required")
+	}
+	if d.Payload != "" && d.PayloadFile != "" {
+		messages = append(messages, "webhook.payload and webhook.payload_file are mutually exclusive")
+	}
+
+	return messages
+}
+
+func (d EmailDefinition) validate() []string {
+	messages := []string{}
+	if d.Host == "" {
+		messages = append(messages, "email.host is required")
+	}
+	if d.From == "" {
+		messages = append(messages, "email.from is required")
+	}
+	if len(d.To) == 0 {
+		messages = append(messages, "email.to is required")
+	}
+	switch d.Security {
+	case "", "none", "starttls", "tls":
+	default:
+		messages = append(messages, fmt.Sprintf("unknown email.security %q", d.Security))
+	}
+	switch d.Auth {
+	case "":
+	case "plain", "login":
+		if d.Username == "" {
+			messages = append(messages, "email.username is required by email.auth")
+		}
+	default:
+		messages = append(messages, fmt.Sprintf("unknown email.auth %q", d.Auth))
+	}
+
+	return messages
+}
+
+// Incidents are resolved by successful runs, so policies that hold successes back would leave them open.
+func (d IncidentDefinition) validate(prefix string, policy NotificationPolicy) []string {
+	messages := []string{}
+	if d.Key == "" {
+		messages = append(messages, prefix+".key is required")
+	}
+	switch policy {
+	case "", PolicyAlways, PolicyOnChange:
+	default:
+		messages = append(messages, fmt.Sprintf("policy %q is not supported by %s notifiers, which need successful runs to resolve incidents", policy, prefix))
+	}
+
+	return messages
+}
+
+// Relative payload files are resolved against dir, the directory of the file defining the notifier.
+func (n *Notifier) interpolate(dir string) error {
+	var err error
+	if n.StateFile, err = expand(n.StateFile); err != nil {
+		return fmt.Errorf("state_file: %w", err)
+	}
+
+	for _, chat := range []struct {
+		name       string
+		definition *ChatNotifier
+	}{{"slack", &n.Slack}, {"teams", &n.Teams}, {"discord", &n.Discord}} {
+		if chat.definition.Webhooks, err = resolveSecrets(chat.definition.Webhooks); err != nil {
+			return fmt.Errorf("%s.webhooks: %w", chat.name, err)
+		}
+	}
+
+	if n.Webhook.URLs, err = resolveSecrets(n.Webhook.URLs); err != nil {
+		return fmt.Errorf("webhook.urls: %w", err)
+	}
+	if n.Webhook.Secret, err = resolveSecret(n.Webhook.Secret); err != nil {
+		return fmt.Errorf("webhook.secret: %w", err)
+	}
+	if n.Webhook.PayloadFile, err = expand(n.Webhook.PayloadFile); err != nil {
+		return fmt.Errorf("webhook.payload_file: %w", err)
+	} else if n.Webhook.PayloadFile != "" {
+		if !filepath.IsAbs(n.Webhook.PayloadFile) {
+			n.Webhook.PayloadFile = filepath.Join(dir, n.Webhook.PayloadFile)
+		}
+		data, err := os.ReadFile(n.Webhook.PayloadFile)
+		if err != nil {
+			return fmt.Errorf("webhook.payload_file: %w", err)
+		}
+		n.Webhook.Payload = string(data)
+	}
+	headers := make(map[string]string, len(n.Webhook.Headers))
+	for name, value := range n.Webhook.Headers {
+		if headers[name], err = resolveSecret(value); err != nil {
+			return fmt.Errorf("webhook.headers.%s: %w", name, err)
+		}
+	}
+	if n.Webhook.Headers != nil {
+		n.Webhook.Headers = headers
+	}
+
+	if n.Email.Host, err = expand(n.Email.Host); err != nil {
+		return fmt.Errorf("email.host: %w", err)
+	}
+	if n.Email.Username, err = resolveSecret(n.Email.Username); err != nil {
+		return fmt.Errorf("email.username: %w", err)
+	}
+	if n.Email.Password, err = resolveSecret(n.Email.Password); err != nil {
+		return fmt.Errorf("email.password: %w", err)
+	}
+
+	if n.PagerDuty.Key, err = resolveSecret(n.PagerDuty.Key); err != nil {
+		return fmt.Errorf("pagerduty.key: %w", err)
+	}
+	if n.Opsgenie.Key, err = resolveSecret(n.Opsgenie.Key); err != nil {
+		return fmt.Errorf("opsgenie.key: %w", err)
+	}
+
+	return nil
+}
+
+func resolveSecrets(values []string) ([]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	resolved := make([]string, len(values))
+	for i, value := range values {
+		var err error
+		if resolved[i], err = resolveSecret(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+func TestLoadNotifiers(t *testing.T) {
+	tmpDir := writeConfigFiles(t, map[string]string{
+		"config.toml": `
+include = ["notifiers.yaml"]
+
+[notifiers.dba-slack]
+type = "slack"
+policy = "on_change"
+state_file = "${STATE_DIR}/dba-slack.json"
+    [notifiers.dba-slack.slack]
+    webhooks = ["env:TEST_SLACK_WEBHOOK"]
+
+[notifiers.n8n]
+type = "webhook"
+    [notifiers.n8n.webhook]
+    urls = ["https://n8n.example.com/webhook/backup"]
+    payload_file = "payload.tmpl"
+    secret = "env:TEST_WEBHOOK_SECRET"
+    headers = { Authorization = "Bearer ${TEST_WEBHOOK_TOKEN}" }
+
+[foo]
+command = ["echo", "foo"]
+notify = ["dba-slack", "pagerduty"]
+`,
+		"notifiers.yaml": `
+notifiers:
+  pagerduty:
+    type: pagerduty
+    pagerduty:
+      key: env:TEST_ROUTING_KEY
+`,
+		"payload.tmpl": `{"results": {{ len .Results }}}`,
+	})
+	t.Setenv("TEST_ROUTING_KEY", "R0UT1NG")
+	t.Setenv("STATE_DIR", "/var/lib/streamlined-backup")
+	t.Setenv("TEST_SLACK_WEBHOOK", "https://hooks.slack.com/services/T000/B000/XXXX")
+	t.Setenv("TEST_WEBHOOK_SECRET", "s3cr3t")
+	t.Setenv("TEST_WEBHOOK_TOKEN", "t0k3n")
+
+	cfg, err := Load(path.Join(tmpDir, "config.toml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]Notifier{
+		"dba-slack": {
+			Type:      SlackNotifier,
+			Policy:    PolicyOnChange,
+			StateFile: "/var/lib/streamlined-backup/dba-slack.json",
+			Slack:     ChatNotifier{Webhooks: []string{"https://hooks.slack.com/services/T000/B000/XXXX"}},
+		},
+		"n8n": {
+			Type: WebhookNotifier,
+			Webhook: WebhookDefinition{
+				URLs:        []string{"https://n8n.example.com/webhook/backup"},
+				Payload:     `{"results": {{ len .Results }}}`,
+				PayloadFile: path.Join(tmpDir, "payload.tmpl"),
+				Headers:     map[string]string{"Authorization": "Bearer t0k3n"},
+				Secret:      "s3cr3t",
+			},
+		},
+		"pagerduty": {
+			Type:      PagerDutyNotifier,
+			PagerDuty: IncidentDefinition{Key: "R0UT1NG"},
+		},
+	}
+	if !reflect.DeepEqual(cfg.Notifiers, expected) {
+		t.Errorf("expected %#v, got %#v", expected, cfg.Notifiers)
+	}
+
+	tasks, err := LoadConfiguration(path.Join(tmpDir, "config.toml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tasks) != 1 {
+		t.Errorf("expected notifiers not to be loaded as tasks, got %d tasks", len(tasks))
+	} else if notify := tasks["foo"].Notify; !reflect.DeepEqual(notify, []string{"dba-slack", "pagerduty"}) {
+		t.Errorf("expected [dba-slack pagerduty], got %v", notify)
+	}
+	if !reflect.DeepEqual(cfg.Tasks, tasks) {
+		t.Errorf("expected %#v, got %#v", tasks, cfg.Tasks)
+	}
+}
+
+func TestLoadNotifiersErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		files    map[string]string
+		expected string
+	}{
+		"duplicate": {
+			files: map[string]string{
+				"config.toml": `
+include = ["more.toml"]
+[notifiers.slack]
+type = "slack"
+`,
+				"more.toml": `
+[notifiers.slack]
+type = "teams"
+`,
+			},
+			expected: "more.toml: notifier \"slack\" already defined in ",
+		},
+		"unknown_key": {
+			files: map[string]string{
+				"config.toml": `
+[notifiers.slack]
+type = "slack"
+webhooks = ["https://hooks.slack.com/services/T000/B000/XXXX"]
+`,
+			},
+			expected: "config.toml: unknown configuration key \"notifiers.slack.webhooks\"",
+		},
+		"missing_payload_file": {
+			files: map[string]string{
+				"config.toml": `
+[notifiers.hook]
+type = "webhook"
+webhook = { urls = ["https://example.com"], payload_file = "missing.tmpl" }
+`,
+			},
+			expected: "config.toml: notifier \"hook\": webhook.payload_file: open ",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpDir := writeConfigFiles(t, tc.files)
+			if _, err := Load(path.Join(tmpDir, "config.toml")); err == nil {
+				t.Fatal("expected error, got nil")
+			} else if !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected error containing %q, got %q", tc.expected, err)
+			}
+		})
+	}
+
+	tmpDir := writeConfigFiles(t, testCases["unknown_key"].files)
+	if _, err := LoadConfiguration(path.Join(tmpDir, "config.toml")); err == nil {
+		t.Error("expected unknown notifier keys to be reported when loading tasks, got nil")
+	}
+}
+
+func TestValidateNotifiers(t *testing.T) {
+	t.Parallel()
+
+	notifiers := map[string]Notifier{
+		"slack":     {Type: SlackNotifier, Slack: ChatNotifier{Webhooks: []string{"https://hooks.slack.com"}}},
+		"empty":     {Type: DiscordNotifier, Policy: "hourly"},
+		"untyped":   {},
+		"unknown":   {Type: "sms"},
+		"hook":      {Type: WebhookNotifier, Webhook: WebhookDefinition{Payload: "{}", PayloadFile: "payload.tmpl"}},
+		"email":     {Type: EmailNotifier, Email: EmailDefinition{Security: "ssl", Auth: "login"}},
+		"email-ok":  {Type: EmailNotifier, Email: EmailDefinition{Host: "localhost", From: "backup@example.com", To: []string{"ops@example.com"}}},
+		"opsgenie":  {Type: OpsgenieNotifier},
+		"pagerduty": {Type: PagerDutyNotifier, Policy: PolicyFailuresOnly, PagerDuty: IncidentDefinition{Key: "key"}},
+		"teams":     {Type: TeamsNotifier},
+		"digest":    {Type: SlackNotifier, Policy: PolicyDailyDigest, Slack: ChatNotifier{Webhooks: []string{"https://hooks.slack.com"}}},
+		"changes":   {Type: SlackNotifier, Policy: PolicyOnChange, StateFile: "/var/lib/streamlined-backup/changes.json", Slack: ChatNotifier{Webhooks: []string{"https://hooks.slack.com"}}},
+		"shared":    {Type: SlackNotifier, Policy: PolicyWeeklyDigest, StateFile: "/var/lib/streamlined-backup/./changes.json", Slack: ChatNotifier{Webhooks: []string{"https://hooks.slack.com"}}},
+	}
+	tasks := map[string]Task{
+		"foo": {Notify: []string{"slack", "pagerduty"}},
+		"bar": {Notify: []string{"dba-slack"}},
+		"baz": {},
+	}
+
+	err := ValidateNotifiers(notifiers, tasks)
+	merr := new(multierror.Error)
+	if !errors.As(err, &merr) {
+		t.Fatalf("expected %T, got %#v", merr, err)
+	}
+
+	expected := []string{
+		`notifier "digest": state_file is required by policy "daily_digest"`,
+		`notifier "email": email.host is required`,
+		`notifier "email": email.from is required`,
+		`notifier "email": email.to is required`,
+		`notifier "email": unknown email.security "ssl"`,
+		`notifier "email": email.username is required by email.auth`,
+		`notifier "empty": unknown policy "hourly"`,
+		`notifier "empty": discord.webhooks is required`,
+		`notifier "hook": webhook.urls is required`,
+		`notifier "hook": webhook.payload and webhook.payload_file are mutually exclusive`,
+		`notifier "opsgenie": opsgenie.key is required`,
+		`notifier "pagerduty": policy "failures_only" is not supported by pagerduty notifiers, which need successful runs to resolve incidents`,
+		`notifier "shared": state_file "/var/lib/streamlined-backup/./changes.json" is also used by notifier "changes"`,
+		`notifier "teams": teams.webhooks is required`,
+		`notifier "unknown": unknown notifier type "sms"`,
+		`notifier "untyped": type is required`,
+		`task "bar": unknown notifier "dba-slack"`,
+	}
+	actual := make([]string, len(merr.Errors))
+	for i, err := range merr.Errors {
+		actual[i] = err.Error()
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, got %#v", expected, actual)
+	}
+
+	if err := ValidateNotifiers(map[string]Notifier{"slack": notifiers["slack"]}, map[string]Task{"foo": {Notify: []string{"slack"}}}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
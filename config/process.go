@@ -0,0 +1,81 @@
+package config
+
+import "fmt"
+
+type IONiceClass string
+
+const (
+	IONiceRealtime   IONiceClass = "realtime"
+	IONiceBestEffort IONiceClass = "best-effort"
+	IONiceIdle       IONiceClass = "idle"
+)
+
+func (c IONiceClass) IsValid() bool {
+	switch c {
+	case IONiceRealtime, IONiceBestEffort, IONiceIdle:
+		return true
+	}
+
+	return false
+}
+
+type IONice struct {
+	Class    IONiceClass `json:"class" toml:"class" yaml:"class"`
+	Priority *int        `json:"priority" toml:"priority" yaml:"priority"`
+}
+
+func (i *IONice) clone() *IONice {
+	if i == nil {
+		return nil
+	}
+
+	clone := *i
+	if i.Priority != nil {
+		priority := *i.Priority
+		clone.Priority = &priority
+	}
+
+	return &clone
+}
+
+type Rlimits struct {
+	OpenFiles    *uint64 `json:"open_files" toml:"open_files" yaml:"open_files"`
+	AddressSpace *uint64 `json:"address_space" toml:"address_space" yaml:"address_space"`
+}
+
+func (r *Rlimits) clone() *Rlimits {
+	if r == nil {
+		return nil
+	}
+
+	clone := *r
+	if r.OpenFiles != nil {
+		openFiles := *r.OpenFiles
+		clone.OpenFiles = &openFiles
+	}
+	if r.AddressSpace != nil {
+		addressSpace := *r.AddressSpace
+		clone.AddressSpace = &addressSpace
+	}
+
+	return &clone
+}
+
+func (t Task) validateProcess() []string {
+	messages := []string{}
+	if t.Nice != nil && (*t.Nice < -20 || *t.Nice > 19) {
+		messages = append(messages, fmt.Sprintf("invalid nice: %d is not between -20 and 19", *t.Nice))
+	}
+	if t.IONice != nil {
+		if !t.IONice.Class.IsValid() {
+			messages = append(messages, fmt.Sprintf("unknown ionice.class %q", t.IONice.Class))
+		}
+		if priority := t.IONice.Priority; priority != nil && t.IONice.Class == IONiceIdle {
+			messages = append(messages, fmt.Sprintf("ionice.priority is not supported by the %q class", IONiceIdle))
+		} else if priority != nil && (*priority < 0 || *priority > 7) {
+			messages = append(messages, fmt.Sprintf("invalid ionice.priority: %d is not between 0 and 7", *priority))
+		}
+	}
+
+	return messages
+}
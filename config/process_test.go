@@ -0,0 +1,70 @@
+package config
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfigurationProcess(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := writeConfigFiles(t, map[string]string{
+		"config.toml": `
+include = ["tasks.yaml"]
+
+[defaults]
+user = "backup"
+nice = 10
+ionice = { class = "best-effort", priority = 6 }
+    [defaults.rlimits]
+    open_files = 1024
+
+[foo]
+command = ["echo", "foo"]
+`,
+		"tasks.yaml": `
+bar:
+  command: [echo, bar]
+  user: postgres
+  group: postgres
+  ionice:
+    class: idle
+  rlimits:
+    address_space: 4294967296
+`,
+	})
+
+	config, err := LoadConfiguration(path.Join(tmpDir, "config.toml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	nice, priority, openFiles, addressSpace := 10, 6, uint64(1024), uint64(4294967296)
+	expected := map[string]Task{
+		"foo": {
+			User:    "backup",
+			Nice:    &nice,
+			IONice:  &IONice{Class: IONiceBestEffort, Priority: &priority},
+			Rlimits: &Rlimits{OpenFiles: &openFiles},
+		},
+		"bar": {
+			User:    "postgres",
+			Group:   "postgres",
+			Nice:    &nice,
+			IONice:  &IONice{Class: IONiceIdle, Priority: &priority},
+			Rlimits: &Rlimits{OpenFiles: &openFiles, AddressSpace: &addressSpace},
+		},
+	}
+	for name, exp := range expected {
+		task := config[name]
+		task.Command = nil
+		if !reflect.DeepEqual(exp, task) {
+			t.Errorf("%s: expected %#v, got %#v", name, exp, task)
+		}
+	}
+
+	if config["foo"].IONice == config["bar"].IONice || config["foo"].Rlimits.OpenFiles == config["bar"].Rlimits.OpenFiles {
+		t.Errorf("expected tasks not to share process settings inherited from defaults")
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+type UnknownKeyError struct {
+	File string
+	Key  string
+}
+
+func (e UnknownKeyError) Error() string {
+	return fmt.Sprintf("%s: unknown configuration key %q", e.File, e.Key)
+}
+
+func newUnknownKeysError(file string, keys []string) error {
+	sort.Strings(keys)
+
+	var errors *multierror.Error
+	for _, key := range keys {
+		errors = multierror.Append(errors, &UnknownKeyError{File: file, Key: key})
+	}
+
+	return errors.ErrorOrNil()
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Lists keys in a generically decoded document that have no matching field in the target type.
+// When foldCase is set, field names are matched case-insensitively like encoding/json does.
+func unknownKeys(value interface{}, typ reflect.Type, tag string, foldCase bool, path string) []string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if reflect.PtrTo(typ).Implements(textUnmarshalerType) {
+		return nil
+	}
+
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+
+		return path + "." + key
+	}
+
+	keys := []string{}
+	switch typ.Kind() {
+	case reflect.Struct:
+		mapping, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		for _, key := range sortedKeys(mapping) {
+			if field, ok := fieldByTag(typ, tag, foldCase, key); !ok {
+				keys = append(keys, join(key))
+			} else {
+				keys = append(keys, unknownKeys(mapping[key], field.Type, tag, foldCase, join(key))...)
+			}
+		}
+
+	case reflect.Map:
+		mapping, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		for _, key := range sortedKeys(mapping) {
+			keys = append(keys, unknownKeys(mapping[key], typ.Elem(), tag, foldCase, join(key))...)
+		}
+
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+
+		for i, item := range items {
+			keys = append(keys, unknownKeys(item, typ.Elem(), tag, foldCase, join(strconv.Itoa(i)))...)
+		}
+	}
+
+	return keys
+}
+
+func fieldByTag(typ reflect.Type, tag string, foldCase bool, key string) (reflect.StructField, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = field.Name
+		}
+
+		if name == key || (foldCase && strings.EqualFold(name, key)) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func sortedKeys(mapping map[string]interface{}) []string {
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUnknownKeyError(t *testing.T) {
+	t.Parallel()
+
+	err := &UnknownKeyError{File: "config.toml", Key: "foo.timout"}
+	if expected := `config.toml: unknown configuration key "foo.timout"`; err.Error() != expected {
+		t.Errorf("expected %s, got %s", expected, err.Error())
+	}
+}
+
+func TestNewUnknownKeysError(t *testing.T) {
+	t.Parallel()
+
+	if err := newUnknownKeysError("config.toml", []string{}); err != nil {
+		t.Errorf("expected nil, got %#v", err)
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		expected []string
+		document string
+	}
+	testCases := map[string]testCase{
+		"valid": {
+			expected: []string{},
+			document: `{"foo": {"schedule": "@daily", "command": ["true"], "destination": {"type": "s3", "s3": {"credentials": {"access_key_id": "foo"}}}}}`,
+		},
+		"case_insensitive": {
+			expected: []string{},
+			document: `{"foo": {"Schedule": "@daily", "TIMEOUT": "1h"}}`,
+		},
+		"unknown": {
+			expected: []string{"bar.foo", "foo.destination.s3.credentials.secret_key", "foo.destination.s3.sufix", "foo.timout"},
+			document: `{"foo": {"timout": "1h", "destination": {"s3": {"sufix": ".sql", "credentials": {"secret_key": "foo"}}}}, "bar": {"foo": "bar"}}`,
+		},
+		"wrong_types": {
+			expected: []string{},
+			document: `{"foo": {"destination": "s3", "command": "true"}}`,
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var document interface{}
+			if err := json.Unmarshal([]byte(tc.document), &document); err != nil {
+				t.Fatal(err)
+			}
+
+			keys := unknownKeys(document, reflect.TypeOf(map[string]Task{}), "json", true, "")
+			if !reflect.DeepEqual(keys, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+type ValidationError struct {
+	Task    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("task %q: %s", e.Task, e.Message)
+}
+
+// Sample timestamp used to check whether keys generated by a task could be mistaken for keys of another task.
+var overlapTimestamp = time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+
+func Validate(tasks map[string]Task) error {
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errors *multierror.Error
+	for _, name := range names {
+		for _, message := range tasks[name].validate() {
+			errors = multierror.Append(errors, &ValidationError{Task: name, Message: message})
+		}
+	}
+
+	for i, name := range names {
+		for _, other := range names[i+1:] {
+			if tasks[name].Destination.overlaps(tasks[other].Destination) {
+				message := fmt.Sprintf("destination overlaps with task %q, last run would be ambiguous", other)
+				errors = multierror.Append(errors, &ValidationError{Task: name, Message: message})
+			}
+		}
+	}
+
+	return errors.ErrorOrNil()
+}
+
+func (t Task) validate() []string {
+	messages := []string{}
+	if t.Schedule.String() == "" {
+		messages = append(messages, "schedule is required")
+	}
+	if len(t.Command) == 0 || (len(t.Command) == 1 && (len(t.Command[0]) == 0 || t.Command[0][0] == "")) {
+		messages = append(messages, "command is required")
+	} else if len(t.Command) > 1 {
+		for i, stage := range t.Command {
+			if len(stage) == 0 || stage[0] == "" {
+				messages = append(messages, fmt.Sprintf("command stage %d is empty", i+1))
+			}
+		}
+	}
+	hooks := []struct {
+		name    string
+		command []string
+	}{
+		{"before", t.Before},
+		{"after", t.After},
+		{"on_success", t.OnSuccess},
+		{"on_failure", t.OnFailure},
+	}
+	for _, hook := range hooks {
+		if len(hook.command) > 0 && hook.command[0] == "" {
+			messages = append(messages, fmt.Sprintf("%s hook command is empty", hook.name))
+		}
+	}
+	for _, duration := range []struct{ name, value string }{{"timeout", t.Timeout}, {"kill_grace", t.KillGrace}} {
+		if duration.value == "" {
+			continue
+		} else if value, err := time.ParseDuration(duration.value); err != nil {
+			messages = append(messages, fmt.Sprintf("invalid %s: %s", duration.name, err))
+		} else if value <= 0 {
+			messages = append(messages, fmt.Sprintf("invalid %s: %s is not positive", duration.name, duration.value))
+		}
+	}
+
+	for _, heartbeat := range t.Heartbeat {
+		if u, err := url.Parse(heartbeat); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			messages = append(messages, fmt.Sprintf("invalid heartbeat URL %q", heartbeat))
+		}
+	}
+
+	messages = append(messages, t.validateEnv()...)
+	messages = append(messages, t.validateProcess()...)
+	messages = append(messages, t.validateGuards()...)
+
+	return append(messages, t.Destination.validate()...)
+}
+
+func (d Destination) validate() []string {
+	switch d.Type {
+	case S3Destination:
+		return d.S3.validate()
+	case "":
+		return []string{"destination.type is required"}
+	}
+
+	return []string{fmt.Sprintf("unknown destination type %q", d.Type)}
+}
+
+func (d S3DestinationDefinition) validate() []string {
+	messages := []string{}
+	if d.Bucket == "" {
+		messages = append(messages, "destination.s3.bucket is required")
+	}
+	if d.Region == "" {
+		messages = append(messages, "destination.s3.region is required")
+	}
+	if d.Credentials != nil && d.Profile != nil {
+		messages = append(messages, "destination.s3.credentials and destination.s3.profile are mutually exclusive")
+	}
+	if d.Credentials != nil && (d.Credentials.AccessKeyId == "" || d.Credentials.SecretAccessKey == "") {
+		messages = append(messages, "destination.s3.credentials require both access_key_id and secret_access_key")
+	}
+
+	return messages
+}
+
+func (d Destination) overlaps(other Destination) bool {
+	if d.Type != S3Destination || other.Type != S3Destination || d.S3.Bucket != other.S3.Bucket {
+		return false
+	}
+
+	if _, err := other.S3.ParseTimestamp(d.S3.Key(overlapTimestamp)); err == nil {
+		return true
+	} else if _, err := d.S3.ParseTimestamp(other.S3.Key(overlapTimestamp)); err == nil {
+		return true
+	}
+
+	return false
+}
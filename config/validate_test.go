@@ -0,0 +1,298 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/chialab/streamlined-backup/utils"
+	"github.com/hashicorp/go-multierror"
+)
+
+func validTask(t *testing.T, prefix string) Task {
+	schedule, err := utils.NewSchedule("30 4 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Task{
+		Schedule: *schedule,
+		Command:  Command{{"echo", "foo bar"}},
+		Timeout:  "2h",
+		Destination: Destination{
+			Type: S3Destination,
+			S3: S3DestinationDefinition{
+				Bucket:  "example-bucket",
+				Region:  "eu-west-1",
+				Prefix:  prefix,
+				Suffix:  ".sql.bz2",
+				Profile: &testAwsProfile,
+			},
+		},
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	t.Parallel()
+
+	err := &ValidationError{Task: "foo", Message: "command is required"}
+	if expected := `task "foo": command is required`; err.Error() != expected {
+		t.Errorf("expected %s, got %s", expected, err.Error())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tasks := map[string]Task{
+		"foo": validTask(t, "foo/"),
+		"bar": validTask(t, "bar/"),
+	}
+	if err := Validate(tasks); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	t.Parallel()
+
+	noSchedule := validTask(t, "no_schedule/")
+	noSchedule.Schedule = utils.ScheduleExpression{}
+
+	noCommand := validTask(t, "no_command/")
+	noCommand.Command = Command{}
+
+	emptyStage := validTask(t, "empty_stage/")
+	emptyStage.Command = Command{{"pg_dump", "db"}, {}}
+
+	invalidTimeout := validTask(t, "invalid_timeout/")
+	invalidTimeout.Timeout = "two hours"
+
+	negativeTimeout := validTask(t, "negative_timeout/")
+	negativeTimeout.Timeout = "-2h"
+
+	invalidKillGrace := validTask(t, "invalid_kill_grace/")
+	invalidKillGrace.KillGrace = "0s"
+
+	unknownInheritEnv := validTask(t, "unknown_inherit_env/")
+	unknownInheritEnv.InheritEnv = "some"
+
+	misplacedAllowlist := validTask(t, "misplaced_allowlist/")
+	misplacedAllowlist.EnvAllowlist = []string{"PATH"}
+
+	invalidAllowlist := validTask(t, "invalid_allowlist/")
+	invalidAllowlist.InheritEnv = InheritEnvAllowlist
+	invalidAllowlist.EnvAllowlist = []string{"PATH", "LC_["}
+
+	invalidNice := validTask(t, "invalid_nice/")
+	nice := 20
+	invalidNice.Nice = &nice
+
+	unknownIONiceClass := validTask(t, "unknown_ionice_class/")
+	unknownIONiceClass.IONice = &IONice{Class: "low"}
+
+	invalidIONicePriority := validTask(t, "invalid_ionice_priority/")
+	priority := 8
+	invalidIONicePriority.IONice = &IONice{Class: IONiceBestEffort, Priority: &priority}
+
+	idlePriority := validTask(t, "idle_priority/")
+	idlePriority.IONice = &IONice{Class: IONiceIdle, Priority: &priority}
+
+	invalidMinSize := validTask(t, "invalid_min_size/")
+	invalidMinSize.MinSize = "10 ten"
+
+	invertedSizes := validTask(t, "inverted_sizes/")
+	invertedSizes.MinSize, invertedSizes.MaxSize = "1 GiB", "1 MiB"
+
+	negativeSizeChange := validTask(t, "negative_size_change/")
+	negativeSizeChange.MaxSizeChangePercent = -10
+
+	unknownSuspiciousAction := validTask(t, "unknown_suspicious_action/")
+	unknownSuspiciousAction.OnSuspicious = "delete"
+
+	emptyHook := validTask(t, "empty_hook/")
+	emptyHook.After = []string{"", "unfreeze"}
+
+	invalidHeartbeat := validTask(t, "invalid_heartbeat/")
+	invalidHeartbeat.Heartbeat = []string{"https://hc-ping.com/uuid", "hc-ping.com/uuid"}
+
+	noDestination := validTask(t, "")
+	noDestination.Destination = Destination{}
+
+	unknownDestination := validTask(t, "")
+	unknownDestination.Destination.Type = "ftp"
+
+	missingBucket := validTask(t, "missing_bucket/")
+	missingBucket.Destination.S3.Bucket = ""
+	missingBucket.Destination.S3.Region = ""
+
+	conflictingCredentials := validTask(t, "conflicting_credentials/")
+	conflictingCredentials.Destination.S3.Credentials = &S3Credentials{AccessKeyId: testAwsAccessKeyId}
+
+	tasks := map[string]Task{
+		"no_schedule":               noSchedule,
+		"no_command":                noCommand,
+		"empty_stage":               emptyStage,
+		"invalid_timeout":           invalidTimeout,
+		"negative_timeout":          negativeTimeout,
+		"invalid_kill_grace":        invalidKillGrace,
+		"unknown_inherit_env":       unknownInheritEnv,
+		"misplaced_allowlist":       misplacedAllowlist,
+		"invalid_allowlist":         invalidAllowlist,
+		"invalid_nice":              invalidNice,
+		"unknown_ionice_class":      unknownIONiceClass,
+		"invalid_ionice_priority":   invalidIONicePriority,
+		"idle_priority":             idlePriority,
+		"invalid_min_size":          invalidMinSize,
+		"inverted_sizes":            invertedSizes,
+		"negative_size_change":      negativeSizeChange,
+		"unknown_suspicious_action": unknownSuspiciousAction,
+		"empty_hook":                emptyHook,
+		"invalid_heartbeat":         invalidHeartbeat,
+		"no_destination":            noDestination,
+		"unknown_destination":       unknownDestination,
+		"missing_bucket":            missingBucket,
+		"conflicting_credentials":   conflictingCredentials,
+		"overlap_a":                 validTask(t, "overlap/"),
+		"overlap_b":                 validTask(t, "overlap/"),
+	}
+
+	expected := []string{
+		`task "conflicting_credentials": destination.s3.credentials and destination.s3.profile are mutually exclusive`,
+		`task "conflicting_credentials": destination.s3.credentials require both access_key_id and secret_access_key`,
+		`task "empty_hook": after hook command is empty`,
+		`task "empty_stage": command stage 2 is empty`,
+		`task "idle_priority": ionice.priority is not supported by the "idle" class`,
+		`task "invalid_allowlist": invalid env_allowlist pattern "LC_[": syntax error in pattern`,
+		`task "invalid_heartbeat": invalid heartbeat URL "hc-ping.com/uuid"`,
+		`task "invalid_ionice_priority": invalid ionice.priority: 8 is not between 0 and 7`,
+		`task "invalid_kill_grace": invalid kill_grace: 0s is not positive`,
+		`task "invalid_min_size": invalid min_size: invalid size "10 ten": unknown unit`,
+		`task "invalid_nice": invalid nice: 20 is not between -20 and 19`,
+		`task "invalid_timeout": invalid timeout: time: invalid duration "two hours"`,
+		`task "inverted_sizes": min_size is greater than max_size`,
+		`task "misplaced_allowlist": env_allowlist requires inherit_env to be "allowlist"`,
+		`task "missing_bucket": destination.s3.bucket is required`,
+		`task "missing_bucket": destination.s3.region is required`,
+		`task "negative_size_change": invalid max_size_change_percent: -10 is not positive`,
+		`task "negative_timeout": invalid timeout: -2h is not positive`,
+		`task "no_command": command is required`,
+		`task "no_destination": destination.type is required`,
+		`task "no_schedule": schedule is required`,
+		`task "unknown_destination": unknown destination type "ftp"`,
+		`task "unknown_inherit_env": unknown inherit_env mode "some"`,
+		`task "unknown_ionice_class": unknown ionice.class "low"`,
+		`task "unknown_suspicious_action": unknown on_suspicious action "delete"`,
+		`task "overlap_a": destination overlaps with task "overlap_b", last run would be ambiguous`,
+	}
+
+	err := Validate(tasks)
+	merr := new(multierror.Error)
+	if !errors.As(err, &merr) {
+		t.Fatalf("expected %T, got %#v", merr, err)
+	}
+
+	actual := []string{}
+	for _, err := range merr.Errors {
+		if validationErr := new(ValidationError); !errors.As(err, &validationErr) {
+			t.Errorf("expected %T, got %#v", validationErr, err)
+		}
+		actual = append(actual, err.Error())
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, got %#v", expected, actual)
+	}
+}
+
+func TestDestinationOverlaps(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		expected bool
+		a, b     Destination
+	}
+	s3 := func(bucket, prefix, suffix string) Destination {
+		return Destination{Type: S3Destination, S3: S3DestinationDefinition{Bucket: bucket, Prefix: prefix, Suffix: suffix}}
+	}
+	testCases := map[string]testCase{
+		"same_prefix_suffix": {
+			expected: true,
+			a:        s3("example-bucket", "foo/", ".sql"),
+			b:        s3("example-bucket", "foo/", ".sql"),
+		},
+		"different_bucket": {
+			expected: false,
+			a:        s3("example-bucket", "foo/", ".sql"),
+			b:        s3("other-bucket", "foo/", ".sql"),
+		},
+		"different_prefix": {
+			expected: false,
+			a:        s3("example-bucket", "foo/", ".sql"),
+			b:        s3("example-bucket", "bar/", ".sql"),
+		},
+		"different_suffix": {
+			expected: false,
+			a:        s3("example-bucket", "foo/", "-foo.sql"),
+			b:        s3("example-bucket", "foo/", "-bar.sql"),
+		},
+		"nested_suffix": {
+			expected: false,
+			a:        s3("example-bucket", "foo/", ".sql"),
+			b:        s3("example-bucket", "foo/", ".sql.bz2"),
+		},
+		"empty_prefix": {
+			expected: true,
+			a:        s3("example-bucket", "", ".sql"),
+			b:        s3("example-bucket", "", ".sql"),
+		},
+		"unknown_type": {
+			expected: false,
+			a:        Destination{Type: "ftp"},
+			b:        Destination{Type: "ftp"},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := tc.a.overlaps(tc.b); actual != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, actual)
+			}
+			if actual := tc.b.overlaps(tc.a); actual != tc.expected {
+				t.Errorf("expected %t (reverse), got %t", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestInheritEnvModeInherits(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		expected  bool
+		mode      InheritEnvMode
+		allowlist []string
+	}
+	testCases := map[string]testCase{
+		"default":            {expected: true, mode: ""},
+		"all":                {expected: true, mode: InheritEnvAll},
+		"none":               {expected: false, mode: InheritEnvNone, allowlist: []string{"PATH"}},
+		"allowlist_match":    {expected: true, mode: InheritEnvAllowlist, allowlist: []string{"HOME", "PATH"}},
+		"allowlist_glob":     {expected: true, mode: InheritEnvAllowlist, allowlist: []string{"PA*"}},
+		"allowlist_no_match": {expected: false, mode: InheritEnvAllowlist, allowlist: []string{"HOME"}},
+		"allowlist_empty":    {expected: false, mode: InheritEnvAllowlist},
+		"allowlist_bad_glob": {expected: false, mode: InheritEnvAllowlist, allowlist: []string{"PA[TH"}},
+		"unknown_mode":       {expected: false, mode: "some"},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := tc.mode.Inherits("PATH", tc.allowlist); actual != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, actual)
+			}
+		})
+	}
+}
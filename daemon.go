@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+	"github.com/chialab/streamlined-backup/metrics"
+	"github.com/chialab/streamlined-backup/notifier"
+	"github.com/chialab/streamlined-backup/utils"
+)
+
+const CHECK_INTERVAL = time.Second * 15
+
+// Delay before a task is considered again after it failed, or after its last run could not be found. It doubles
+// with each consecutive failure of the task, up to MAX_RETRY_INTERVAL.
+const (
+	RETRY_INTERVAL     = time.Minute
+	MAX_RETRY_INTERVAL = time.Hour
+)
+
+type daemon struct {
+	opts     *cliOptions
+	notifier notifier.Notifier
+	logger   *utils.Logger
+	// When set, notifiers are rebuilt when the configuration is reloaded.
+	newNotifier func(*cliOptions, *config.Configuration) (notifier.Notifier, error)
+	metrics     *metrics.Registry
+
+	tasks       backup.TasksList
+	fingerprint string
+	nextRuns    map[string]time.Time
+	running     map[string]bool
+	pool        chan bool
+	done        chan finishedRun
+
+	// Earliest time tasks that did not succeed are retried, kept when the configuration is reloaded.
+	retries map[string]time.Time
+
+	// Notifications are sent one at a time, outside of the loop.
+	notifying   sync.WaitGroup
+	notifyMutex sync.Mutex
+}
+
+type finishedRun struct {
+	name   string
+	result backup.Result
+}
+
+func newDaemon(opts *cliOptions, cfg *config.Configuration, notifier notifier.Notifier) (*daemon, error) {
+	d := &daemon{
+		opts:     opts,
+		notifier: notifier,
+		logger:   utils.DefaultLogger().With("component", "daemon"),
+		metrics:  metrics.NewRegistry(),
+		nextRuns: map[string]time.Time{},
+		retries:  map[string]time.Time{},
+		running:  map[string]bool{},
+		pool:     make(chan bool, *opts.parallel),
+		done:     make(chan finishedRun),
+	}
+
+	d.fingerprint = configFingerprint(*opts.config)
+	tasks, err := validTasks(opts, cfg.Tasks)
+	if err != nil {
+		return nil, err
+	}
+	d.tasks = tasks
+
+	if textfile := metricsTextfile(opts); textfile != "" {
+		if err := d.metrics.ReadFile(textfile); err != nil {
+			d.logger.Error("Previous metrics not read", err)
+		}
+	}
+
+	return d, nil
+}
+
+func validTasks(opts *cliOptions, tasksDfn map[string]config.Task) (backup.TasksList, error) {
+	if err := config.Validate(tasksDfn); err != nil {
+		return nil, err
+	}
+
+	return loadTasks(opts, tasksDfn)
+}
+
+// Summarizes modification times and sizes of the configuration files and of the directories containing them,
+// so that edits, as well as files being added or removed, can be detected without parsing the configuration.
+func configFingerprint(path string) string {
+	files, err := config.ConfigurationFiles(path)
+	if err != nil {
+		files = []string{path}
+	}
+
+	paths := map[string]bool{path: true}
+	for _, file := range files {
+		paths[file] = true
+		paths[filepath.Dir(file)] = true
+	}
+
+	lines := []string{}
+	for path := range paths {
+		if info, err := os.Stat(path); err != nil {
+			lines = append(lines, fmt.Sprintf("%s missing", path))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s %d %d", path, info.ModTime().UnixNano(), info.Size()))
+		}
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n")
+}
+
+// Replaces the tasks with those from the current configuration. Tasks already running are not affected,
+// and if the new configuration is not valid the previous one is kept.
+func (d *daemon) reload() {
+	d.fingerprint = configFingerprint(*d.opts.config)
+
+	var tasks backup.TasksList
+	var notifiers notifier.Notifier
+	cfg, err := loadConfiguration(d.opts)
+	if err == nil {
+		tasks, err = validTasks(d.opts, cfg.Tasks)
+	}
+	if err == nil && d.newNotifier != nil {
+		notifiers, err = d.newNotifier(d.opts, cfg)
+	}
+	if err != nil {
+		d.logger.Error("Configuration reload", err)
+		d.notify(func(notifier notifier.Notifier) error {
+			return notifier.Error(fmt.Errorf("configuration could not be reloaded, previous configuration is kept: %w", err))
+		})
+
+		return
+	}
+
+	d.tasks = tasks
+	if notifiers != nil {
+		d.notifier = notifiers
+	}
+	// Schedules may have changed, but tasks that are still defined keep backing off.
+	d.nextRuns = map[string]time.Time{}
+	retries := map[string]time.Time{}
+	for _, task := range tasks {
+		if retry, ok := d.retries[task.Name()]; ok {
+			retries[task.Name()] = retry
+		}
+	}
+	d.retries = retries
+	d.logger.Infof("Configuration reloaded (%d tasks)", len(tasks))
+}
+
+func (d *daemon) checkConfig() {
+	if configFingerprint(*d.opts.config) != d.fingerprint {
+		d.logger.Info("Configuration changed")
+		d.reload()
+	}
+}
+
+// Starts the tasks that are due and not already running.
+func (d *daemon) schedule(now time.Time) {
+	for _, task := range d.tasks {
+		if d.running[task.Name()] {
+			continue
+		} else if next, ok := d.nextRuns[task.Name()]; ok && now.Before(next) {
+			continue
+		} else if retry, ok := d.retries[task.Name()]; ok && now.Before(retry) {
+			continue
+		}
+
+		if decision := task.Explain(now, false); decision.Err != nil {
+			// Without forcing it, the task looks up its last run again and reports a failed result if it still
+			// cannot be found, so that notifiers, metrics and heartbeats are told like for any other failure.
+			d.start(task, now, false)
+		} else if !decision.Run {
+			d.nextRuns[decision.Name] = decision.NextRun
+		} else {
+			d.start(task, now, true)
+		}
+	}
+}
+
+func (d *daemon) start(task backup.TaskInterface, now time.Time, force bool) {
+	d.running[task.Name()] = true
+	delete(d.nextRuns, task.Name())
+
+	go func() {
+		d.pool <- true
+		defer func() { <-d.pool }()
+
+		d.done <- finishedRun{name: task.Name(), result: task.Run(now, force)}
+	}()
+}
+
+func (d *daemon) finish(run finishedRun) {
+	delete(d.running, run.name)
+	// The attempt is counted from the recorded metrics, so that the backoff survives restarts of the daemon.
+	if run.result.Status() != backup.StatusSkipped {
+		run.result = run.result.WithAttempt(d.metrics.Attempt(run.result.Name()))
+	}
+	switch run.result.Status() {
+	case backup.StatusSuccess:
+		delete(d.retries, run.name)
+	case backup.StatusFailed, backup.StatusTimeout, backup.StatusSuspicious:
+		d.retries[run.name] = time.Now().Add(retryDelay(run.result.Attempt()))
+	}
+
+	d.metrics.Record(run.result)
+	if textfile := metricsTextfile(d.opts); textfile != "" {
+		if err := d.metrics.WriteFile(textfile); err != nil {
+			d.logger.Error("Metrics not written", err)
+		}
+	}
+
+	d.notify(func(notifier notifier.Notifier) error {
+		return notifier.Notify(run.result)
+	})
+}
+
+func retryDelay(failures int) time.Duration {
+	delay := RETRY_INTERVAL
+	for i := 1; i < failures && delay < MAX_RETRY_INTERVAL; i++ {
+		delay *= 2
+	}
+	if delay > MAX_RETRY_INTERVAL {
+		return MAX_RETRY_INTERVAL
+	}
+
+	return delay
+}
+
+// Sends a notification in the background, so that a notifier that hangs does not delay scheduling, reloads or
+// signals. The notification goes to the current notifier, even if the configuration is reloaded before it is sent.
+func (d *daemon) notify(send func(notifier.Notifier) error) {
+	notifier := d.notifier
+	d.notifying.Add(1)
+	go func() {
+		defer d.notifying.Done()
+		d.notifyMutex.Lock()
+		defer d.notifyMutex.Unlock()
+
+		if err := send(notifier); err != nil {
+			d.logger.With("phase", "notify").Error("Notification", err)
+		}
+	}()
+}
+
+func (d *daemon) loop(ticks <-chan time.Time, reload <-chan os.Signal, stop <-chan os.Signal) {
+	d.schedule(time.Now())
+
+	for {
+		select {
+		case now := <-ticks:
+			d.checkConfig()
+			d.schedule(now)
+		case <-reload:
+			d.logger.Info("Reloading configuration")
+			d.reload()
+			d.schedule(time.Now())
+		case run := <-d.done:
+			d.finish(run)
+		case sig := <-stop:
+			d.logger.Infof("Received %s, waiting for %d running tasks", sig, len(d.running))
+			for len(d.running) > 0 {
+				d.finish(<-d.done)
+			}
+			d.notifying.Wait()
+
+			return
+		}
+	}
+}
+
+func (d *daemon) metricsServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", d.metrics)
+
+	return &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+}
+
+func runDaemon(opts *cliOptions, cfg *config.Configuration, notifier notifier.Notifier) backup.Results {
+	d, err := newDaemon(opts, cfg, notifier)
+	if err != nil {
+		panic(configError{err})
+	}
+	d.newNotifier = newNotifier
+
+	pid := utils.NewPidFile(*opts.pidFile)
+	if err := pid.Acquire(); err != nil {
+		panic(err)
+	}
+	defer pid.MustRelease()
+
+	reload, stop := make(chan os.Signal, 1), make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(reload)
+	defer signal.Stop(stop)
+
+	if *opts.metricsAddr != "" {
+		listener, err := net.Listen("tcp", *opts.metricsAddr)
+		if err != nil {
+			panic(err)
+		}
+		server := d.metricsServer()
+		defer server.Close()
+		go func() {
+			if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				d.logger.Error("Metrics server", err)
+			}
+		}()
+		d.logger.Infof("Serving metrics on %s/metrics", listener.Addr())
+	}
+
+	ticker := time.NewTicker(*opts.interval)
+	defer ticker.Stop()
+
+	d.logger.Infof("Started (%d tasks)", len(d.tasks))
+	d.loop(ticker.C, reload, stop)
+
+	return backup.Results{}
+}
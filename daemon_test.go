@@ -0,0 +1,529 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+	"github.com/chialab/streamlined-backup/notifier"
+	"github.com/chialab/streamlined-backup/utils"
+)
+
+const testDaemonConfig = `
+[foo]
+schedule = "@daily"
+command = ["echo", "foo"]
+    [foo.destination]
+    type = "s3"
+        [foo.destination.s3]
+        region = "eu-west-1"
+        bucket = "example-bucket"
+        prefix = "foo/"
+`
+
+type testDaemonTask struct {
+	name     string
+	decision backup.Decision
+	result   backup.Result
+	release  chan bool
+	mutex    *sync.Mutex
+	explains int
+	runs     int
+}
+
+func newTestDaemonTask(name string, decision backup.Decision, result backup.Result) *testDaemonTask {
+	decision.Name = name
+
+	return &testDaemonTask{name: name, decision: decision, result: result, mutex: &sync.Mutex{}}
+}
+
+func (t *testDaemonTask) Name() string {
+	return t.name
+}
+
+func (t *testDaemonTask) Explain(now time.Time, force bool) backup.Decision {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.explains++
+
+	return t.decision
+}
+
+func (t *testDaemonTask) Run(now time.Time, force bool) backup.Result {
+	t.mutex.Lock()
+	t.runs++
+	t.mutex.Unlock()
+
+	if t.release != nil {
+		<-t.release
+	}
+
+	return t.result
+}
+
+func (t *testDaemonTask) counts() (int, int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.explains, t.runs
+}
+
+type testNotifier struct {
+	results []backup.Result
+	errors  []error
+}
+
+func (n *testNotifier) Notify(results ...backup.Result) error {
+	n.results = append(n.results, results...)
+
+	return nil
+}
+
+func (n *testNotifier) Error(err error) error {
+	n.errors = append(n.errors, err)
+
+	return nil
+}
+
+func newTestDaemon(t *testing.T, data string) (*daemon, *testNotifier, string) {
+	configFile := path.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(configFile, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	parallel := uint(2)
+	opts := &cliOptions{config: &configFile, parallel: &parallel, tasks: &listOfStrings{}}
+	cfg, err := loadConfiguration(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := &testNotifier{}
+	d, err := newDaemon(opts, cfg, notifier)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	d.logger = utils.NewLogger(io.Discard, utils.LogFormatText)
+
+	return d, notifier, configFile
+}
+
+func TestNewDaemonInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	configFile := path.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(configFile, []byte("[foo]\ncommand = [\"echo\"]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	parallel := uint(2)
+	opts := &cliOptions{config: &configFile, parallel: &parallel, tasks: &listOfStrings{}}
+	cfg, err := loadConfiguration(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := newDaemon(opts, cfg, &testNotifier{}); err == nil {
+		t.Errorf("expected error, got %#v", d)
+	} else if !strings.Contains(err.Error(), `task "foo": schedule is required`) {
+		t.Errorf("expected validation error, got %s", err)
+	}
+}
+
+func TestDaemonSchedule(t *testing.T) {
+	t.Parallel()
+
+	d, notifier, _ := newTestDaemon(t, testDaemonConfig)
+
+	now := time.Date(2021, 10, 12, 10, 30, 0, 0, time.UTC)
+	due := newTestDaemonTask("due", backup.Decision{Run: true}, backup.NewResultSuccess(&backup.Task{}, []string{}))
+	due.release = make(chan bool)
+	notDue := newTestDaemonTask("not_due", backup.Decision{NextRun: now.Add(time.Hour)}, backup.Result{})
+	d.tasks = backup.TasksList{due, notDue}
+
+	d.schedule(now)
+	d.schedule(now.Add(time.Second))
+	if explains, runs := due.counts(); explains != 1 {
+		t.Errorf("expected running task not to be explained again, got %d", explains)
+	} else if !d.running["due"] {
+		t.Errorf("expected task to be running, got %d runs", runs)
+	}
+	if explains, _ := notDue.counts(); explains != 1 {
+		t.Errorf("expected next run to be cached, got %d explains", explains)
+	}
+
+	d.schedule(now.Add(time.Hour + time.Second))
+	if explains, _ := notDue.counts(); explains != 2 {
+		t.Errorf("expected task to be explained again when due, got %d explains", explains)
+	}
+
+	due.release <- true
+	d.finish(<-d.done)
+	d.notifying.Wait()
+	if _, runs := due.counts(); runs != 1 {
+		t.Errorf("expected task to run once, got %d", runs)
+	} else if d.running["due"] {
+		t.Errorf("expected task not to be running")
+	} else if len(notifier.results) != 1 {
+		t.Errorf("expected 1 notification, got %d", len(notifier.results))
+	}
+}
+
+func TestDaemonLastRunError(t *testing.T) {
+	t.Parallel()
+
+	d, notifier, _ := newTestDaemon(t, testDaemonConfig)
+
+	testErr := errors.New("test error")
+	broken := newTestDaemonTask("broken", backup.Decision{Err: testErr}, backup.NewResultFailed(&backup.Task{}, testErr, []string{}))
+	d.tasks = backup.TasksList{broken}
+
+	d.schedule(time.Now())
+	d.finish(<-d.done)
+	d.notifying.Wait()
+	if _, runs := broken.counts(); runs != 1 {
+		t.Errorf("expected task to be run so that the failure is reported, got %d runs", runs)
+	}
+	if _, ok := d.retries["broken"]; !ok {
+		t.Errorf("expected retry to be delayed, got %#v", d.retries)
+	}
+	if len(notifier.results) != 1 || notifier.results[0].Error() != testErr {
+		t.Errorf("expected failure to be notified, got %#v", notifier.results)
+	}
+}
+
+func TestDaemonFailedTaskRetry(t *testing.T) {
+	t.Parallel()
+
+	d, notifier, _ := newTestDaemon(t, testDaemonConfig)
+
+	task, err := backup.NewTask("failing", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := newTestDaemonTask("failing", backup.Decision{Run: true}, backup.NewResultFailed(task, errors.New("test error"), []string{}))
+	d.tasks = backup.TasksList{failing}
+
+	delays := []time.Duration{}
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		d.schedule(start)
+		d.finish(<-d.done)
+		if next, ok := d.retries["failing"]; !ok {
+			t.Fatalf("expected failed task to be delayed, got %#v", d.retries)
+		} else {
+			delays = append(delays, next.Sub(start).Round(time.Minute))
+		}
+		delete(d.retries, "failing")
+	}
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Errorf("expected delays %v, got %v", expected, delays)
+	}
+
+	// The attempt is read back from the metrics textfile, so that the backoff survives a restart.
+	textfile := path.Join(t.TempDir(), "streamlined_backup.prom")
+	if err := d.metrics.WriteFile(textfile); err != nil {
+		t.Fatal(err)
+	}
+	restarted, restartedNotifier, _ := newTestDaemon(t, testDaemonConfig)
+	if err := restarted.metrics.ReadFile(textfile); err != nil {
+		t.Fatal(err)
+	}
+	restarted.tasks = backup.TasksList{failing}
+	start := time.Now()
+	restarted.schedule(start)
+	restarted.finish(<-restarted.done)
+	if delay := restarted.retries["failing"].Sub(start).Round(time.Minute); delay != 8*time.Minute {
+		t.Errorf("expected delay of 8m0s after a restart, got %s", delay)
+	}
+
+	failing.result = backup.NewResultSuccess(task, []string{})
+	d.schedule(time.Now())
+	d.finish(<-d.done)
+	failing.result = backup.NewResultFailed(task, errors.New("test error"), []string{})
+	start = time.Now()
+	d.schedule(start)
+	d.finish(<-d.done)
+	if delay := d.retries["failing"].Sub(start).Round(time.Minute); delay != time.Minute {
+		t.Errorf("expected delay to be reset by a success, got %s", delay)
+	}
+	d.notifying.Wait()
+	restarted.notifying.Wait()
+
+	attempts := []int{}
+	for _, result := range notifier.results {
+		attempts = append(attempts, result.Attempt())
+	}
+	sort.Ints(attempts)
+	if expected := []int{1, 1, 2, 3, 4}; !reflect.DeepEqual(attempts, expected) {
+		t.Errorf("expected attempts %v, got %v", expected, attempts)
+	}
+	if len(restartedNotifier.results) != 1 || restartedNotifier.results[0].Attempt() != 4 {
+		t.Errorf("expected attempt 4 to be notified after a restart, got %#v", restartedNotifier.results)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[int]time.Duration{
+		1:  RETRY_INTERVAL,
+		2:  2 * RETRY_INTERVAL,
+		5:  16 * RETRY_INTERVAL,
+		7:  MAX_RETRY_INTERVAL,
+		50: MAX_RETRY_INTERVAL,
+	}
+	for failures, expected := range testCases {
+		if delay := retryDelay(failures); delay != expected {
+			t.Errorf("expected %s after %d failures, got %s", expected, failures, delay)
+		}
+	}
+}
+
+func TestDaemonMetrics(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	configFile, textfile := path.Join(tmpDir, "config.toml"), path.Join(tmpDir, "streamlined_backup.prom")
+	if err := os.WriteFile(configFile, []byte(testDaemonConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	previous := "streamlined_backup_last_success_timestamp_seconds{task=\"bar\"} 1633716557\n"
+	if err := os.WriteFile(textfile, []byte(previous), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parallel := uint(2)
+	opts := &cliOptions{config: &configFile, parallel: &parallel, tasks: &listOfStrings{}, metricsTextfile: &textfile}
+	cfg, err := loadConfiguration(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := newDaemon(opts, cfg, &testNotifier{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	d.logger = utils.NewLogger(io.Discard, utils.LogFormatText)
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.running["foo"] = true
+	d.finish(finishedRun{name: "foo", result: backup.NewResultFailed(task, errors.New("test error"), []string{})})
+
+	ts := httptest.NewServer(d.metricsServer().Handler)
+	defer ts.Close()
+	response, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer response.Body.Close()
+	served, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{string(served), string(written)} {
+		for _, expected := range []string{
+			`streamlined_backup_last_success_timestamp_seconds{task="bar"} 1633716557`,
+			`streamlined_backup_status{task="foo",status="failed"} 1`,
+		} {
+			if !strings.Contains(data, expected) {
+				t.Errorf("expected %s, got %s", expected, data)
+			}
+		}
+	}
+}
+
+func TestDaemonReload(t *testing.T) {
+	t.Parallel()
+
+	d, notifier, configFile := newTestDaemon(t, testDaemonConfig)
+	if len(d.tasks) != 1 {
+		t.Fatalf("expected 1 task, got %d", len(d.tasks))
+	}
+	d.nextRuns["foo"] = time.Now().Add(time.Hour)
+	d.retries["foo"] = time.Now().Add(time.Hour)
+	d.retries["removed"] = time.Now().Add(time.Hour)
+
+	data := testDaemonConfig + strings.ReplaceAll(testDaemonConfig, "foo", "bar")
+	if err := os.WriteFile(configFile, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d.reload()
+	d.notifying.Wait()
+	if len(d.tasks) != 2 {
+		t.Errorf("expected 2 tasks, got %d", len(d.tasks))
+	}
+	if len(d.nextRuns) != 0 {
+		t.Errorf("expected cached runs to be cleared, got %#v", d.nextRuns)
+	}
+	if _, ok := d.retries["foo"]; !ok || len(d.retries) != 1 {
+		t.Errorf("expected retries to be kept only for defined tasks, got %#v", d.retries)
+	}
+	if len(notifier.errors) != 0 {
+		t.Errorf("expected no errors, got %#v", notifier.errors)
+	}
+}
+
+func TestDaemonReloadInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	d, notifier, configFile := newTestDaemon(t, testDaemonConfig)
+	previous := d.tasks
+
+	data := testDaemonConfig + "\n[bar]\ncommand = [\"echo\", \"bar\"]\n"
+	if err := os.WriteFile(configFile, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d.reload()
+	d.notifying.Wait()
+	if len(d.tasks) != 1 || d.tasks[0] != previous[0] {
+		t.Errorf("expected previous tasks to be kept, got %#v", d.tasks)
+	}
+	if len(notifier.errors) != 1 {
+		t.Fatalf("expected 1 error notification, got %d", len(notifier.errors))
+	}
+
+	expected := `configuration could not be reloaded, previous configuration is kept: `
+	if err := notifier.errors[0]; !strings.HasPrefix(err.Error(), expected) || !strings.Contains(err.Error(), `task "bar": schedule is required`) {
+		t.Errorf("expected %s..., got %s", expected, err)
+	}
+}
+
+func TestDaemonReloadNotifier(t *testing.T) {
+	t.Parallel()
+
+	d, previous, configFile := newTestDaemon(t, testDaemonConfig)
+	reloaded := &testNotifier{}
+	d.newNotifier = func(opts *cliOptions, cfg *config.Configuration) (notifier.Notifier, error) {
+		if data, err := os.ReadFile(*opts.config); err != nil {
+			return nil, err
+		} else if strings.Contains(string(data), "broken") {
+			return nil, errors.New("test error")
+		}
+
+		return reloaded, nil
+	}
+
+	d.reload()
+	if d.notifier != reloaded {
+		t.Errorf("expected notifier to be rebuilt, got %#v", d.notifier)
+	}
+
+	data := testDaemonConfig + "\n# broken notifier\n"
+	if err := os.WriteFile(configFile, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d.reload()
+	d.notifying.Wait()
+	if len(d.tasks) != 1 {
+		t.Errorf("expected previous tasks to be kept, got %d tasks", len(d.tasks))
+	}
+	if d.notifier != reloaded {
+		t.Errorf("expected previous notifier to be kept, got %#v", d.notifier)
+	}
+	if len(reloaded.errors) != 1 || len(previous.errors) != 0 {
+		t.Errorf("expected error to be sent to the previous notifier, got %#v", reloaded.errors)
+	}
+}
+
+func TestDaemonCheckConfig(t *testing.T) {
+	t.Parallel()
+
+	d, _, configFile := newTestDaemon(t, testDaemonConfig)
+
+	d.checkConfig()
+	if len(d.tasks) != 1 {
+		t.Fatalf("expected 1 task, got %d", len(d.tasks))
+	}
+
+	data := testDaemonConfig + strings.ReplaceAll(testDaemonConfig, "foo", "bar")
+	if err := os.WriteFile(configFile, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(configFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	d.checkConfig()
+	if len(d.tasks) != 2 {
+		t.Errorf("expected configuration to be reloaded, got %d tasks", len(d.tasks))
+	}
+}
+
+func TestConfigFingerprint(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	configFile := path.Join(tmpDir, "config.toml")
+	if err := os.WriteFile(configFile, []byte(testDaemonConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint := configFingerprint(tmpDir)
+	if again := configFingerprint(tmpDir); again != fingerprint {
+		t.Errorf("expected fingerprint to be stable, got %q and %q", fingerprint, again)
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(configFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed := configFingerprint(tmpDir); changed == fingerprint {
+		t.Errorf("expected fingerprint to change when a file is modified")
+	}
+
+	if err := os.Remove(configFile); err != nil {
+		t.Fatal(err)
+	}
+	if missing := configFingerprint(configFile); !strings.Contains(missing, configFile+" missing") {
+		t.Errorf("expected missing file to be reported, got %q", missing)
+	}
+}
+
+func TestDaemonLoopStop(t *testing.T) {
+	t.Parallel()
+
+	d, notifier, _ := newTestDaemon(t, testDaemonConfig)
+
+	task := newTestDaemonTask("slow", backup.Decision{Run: true}, backup.NewResultSuccess(&backup.Task{}, []string{}))
+	task.release = make(chan bool)
+	d.tasks = backup.TasksList{task}
+
+	stop := make(chan os.Signal, 1)
+	stop <- syscall.SIGTERM
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		task.release <- true
+	}()
+
+	d.loop(make(chan time.Time), make(chan os.Signal), stop)
+	if _, runs := task.counts(); runs != 1 {
+		t.Errorf("expected task to run once, got %d", runs)
+	}
+	if len(notifier.results) != 1 {
+		t.Errorf("expected running task to be waited for, got %d notifications", len(notifier.results))
+	}
+}
@@ -8,6 +8,7 @@ require (
 	github.com/aws/aws-sdk-go v1.40.55
 	github.com/hashicorp/go-multierror v1.1.1
 	github.com/robfig/cron/v3 v3.0.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -2,19 +2,62 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"time"
 
 	"github.com/chialab/streamlined-backup/config"
 )
 
+// Summary of an artifact upload. If the artifact was not stored, its location is empty and the other fields
+// describe what was uploaded before the upload was aborted.
+type Upload struct {
+	Location string
+	Parts    int
+	Bytes    int64
+}
+
+// Artifact stored by a previous run. It is the zero value if no previous run is found.
+type Artifact struct {
+	Timestamp time.Time
+	Size      int64
+}
+
+// How an upload is finalized once all data has been read.
+type Completion int
+
+const (
+	CompleteUpload Completion = iota
+	CompleteUploadTagged
+	AbortUpload
+)
+
+// Tag set on artifacts stored with CompleteUploadTagged.
+const SuspiciousTagKey, SuspiciousTagValue = "streamlined-backup-status", "suspicious"
+
 type Handler interface {
-	Handler(*io.PipeReader, time.Time) (func() error, error)
-	LastRun() (time.Time, error)
+	Handler(*io.PipeReader, time.Time) (func(Completion) (Upload, error), error)
+	LastArtifact() (Artifact, error)
+	// Most recent artifact that was not tagged as suspicious, to compare the size of new artifacts with.
+	LastTrustedArtifact() (Artifact, error)
 }
 
 var ErrUnknownDestination = errors.New("unknown destination type")
 
+// Error uploading one of the parts an artifact is split into.
+type PartError struct {
+	Part int64
+	Err  error
+}
+
+func (e PartError) Error() string {
+	return fmt.Sprintf("part %d: %s", e.Part, e.Err)
+}
+
+func (e PartError) Unwrap() error {
+	return e.Err
+}
+
 func NewHandler(destination config.Destination) (Handler, error) {
 	switch destination.Type {
 	case config.S3Destination:
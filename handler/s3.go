@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/md5"
 	"encoding/base64"
+	"fmt"
 	"io"
 	"sort"
 	"strings"
@@ -21,10 +22,24 @@ type s3UploadedPart struct {
 	PartNumber int64
 	Error      error
 	ETag       string
+	Size       int64
 }
 
 type s3UploadedParts []s3UploadedPart
 
+// Summarizes the parts that were uploaded successfully.
+func (p s3UploadedParts) upload() Upload {
+	upload := Upload{}
+	for _, part := range p {
+		if part.Error == nil {
+			upload.Parts++
+			upload.Bytes += part.Size
+		}
+	}
+
+	return upload
+}
+
 func (p s3UploadedParts) Len() int {
 	return len(p)
 }
@@ -58,7 +73,7 @@ type S3Handler struct {
 	destination config.S3DestinationDefinition
 }
 
-func (h S3Handler) Handler(reader *io.PipeReader, timestamp time.Time) (func() error, error) {
+func (h S3Handler) Handler(reader *io.PipeReader, timestamp time.Time) (func(Completion) (Upload, error), error) {
 	upload, err := h.initMultipartUpload(timestamp)
 	if err != nil {
 		return nil, err
@@ -97,12 +112,13 @@ func (h S3Handler) Handler(reader *io.PipeReader, timestamp time.Time) (func() e
 		close(upload.Parts)
 	}()
 
-	return func() (err error) {
+	return func(completion Completion) (summary Upload, err error) {
 		// Wait for all pending uploads to finish
 		parts := make(s3UploadedParts, 0)
 		for part := range upload.Parts {
 			parts = append(parts, part)
 		}
+		summary = parts.upload()
 
 		defer func() {
 			// Abort the upload if any error occurred
@@ -121,11 +137,18 @@ func (h S3Handler) Handler(reader *io.PipeReader, timestamp time.Time) (func() e
 
 		if upload.Error != nil {
 			panic(upload.Error)
+		} else if completion == AbortUpload {
+			return summary, h.abortMultipartUpload(upload)
 		} else if err := h.completeMultipartUpload(upload, parts); err != nil {
 			panic(err)
 		}
+		summary.Location = fmt.Sprintf("s3://%s/%s", upload.Bucket, upload.Key)
 
-		return nil
+		if completion == CompleteUploadTagged {
+			return summary, h.tagObject(upload.Bucket, upload.Key, SuspiciousTagKey, SuspiciousTagValue)
+		}
+
+		return summary, nil
 	}, nil
 }
 
@@ -162,9 +185,9 @@ func (h S3Handler) uploadPart(upload *s3MultipartUpload, partNumber int64, chunk
 		ContentMD5:    aws.String(md5sum),
 	}
 	if result, err := h.client.UploadPart(input); err != nil {
-		return s3UploadedPart{Error: err, PartNumber: partNumber}
+		return s3UploadedPart{Error: &PartError{Part: partNumber, Err: err}, PartNumber: partNumber}
 	} else {
-		return s3UploadedPart{PartNumber: partNumber, ETag: *result.ETag}
+		return s3UploadedPart{PartNumber: partNumber, ETag: *result.ETag, Size: int64(len(chunk))}
 	}
 
 }
@@ -209,9 +232,30 @@ func (h S3Handler) completeMultipartUpload(upload *s3MultipartUpload, uploadedPa
 	return nil
 }
 
-func (h S3Handler) LastRun() (time.Time, error) {
+func (h S3Handler) tagObject(bucket string, key string, tagKey string, tagValue string) error {
+	input := &s3.PutObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Tagging: &s3.Tagging{
+			TagSet: []*s3.Tag{{Key: aws.String(tagKey), Value: aws.String(tagValue)}},
+		},
+	}
+	if _, err := h.client.PutObjectTagging(input); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type s3Artifact struct {
+	key string
+	Artifact
+}
+
+// Lists the artifacts stored in the destination, most recent first.
+func (h S3Handler) listArtifacts() ([]s3Artifact, error) {
 	var marker *string
-	var lastRun time.Time
+	artifacts := []s3Artifact{}
 	for {
 		result, err := h.client.ListObjects(&s3.ListObjectsInput{
 			Bucket: aws.String(h.destination.Bucket),
@@ -219,7 +263,7 @@ func (h S3Handler) LastRun() (time.Time, error) {
 			Marker: marker,
 		})
 		if err != nil {
-			return time.Time{}, err
+			return nil, err
 		}
 
 		for _, object := range result.Contents {
@@ -227,10 +271,8 @@ func (h S3Handler) LastRun() (time.Time, error) {
 				continue
 			}
 
-			if run, err := h.destination.ParseTimestamp(*object.Key); err != nil {
-				continue
-			} else if run.After(lastRun) {
-				lastRun = run
+			if run, err := h.destination.ParseTimestamp(*object.Key); err == nil {
+				artifacts = append(artifacts, s3Artifact{key: *object.Key, Artifact: Artifact{Timestamp: run, Size: aws.Int64Value(object.Size)}})
 			}
 		}
 
@@ -240,5 +282,47 @@ func (h S3Handler) LastRun() (time.Time, error) {
 		}
 	}
 
-	return lastRun, nil
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		return artifacts[i].Timestamp.After(artifacts[j].Timestamp)
+	})
+
+	return artifacts, nil
+}
+
+func (h S3Handler) LastArtifact() (Artifact, error) {
+	artifacts, err := h.listArtifacts()
+	if err != nil || len(artifacts) == 0 {
+		return Artifact{}, err
+	}
+
+	return artifacts[0].Artifact, nil
+}
+
+func (h S3Handler) LastTrustedArtifact() (Artifact, error) {
+	artifacts, err := h.listArtifacts()
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	for _, artifact := range artifacts {
+		result, err := h.client.GetObjectTagging(&s3.GetObjectTaggingInput{
+			Bucket: aws.String(h.destination.Bucket),
+			Key:    aws.String(artifact.key),
+		})
+		if err != nil {
+			return Artifact{}, err
+		}
+
+		suspicious := false
+		for _, tag := range result.TagSet {
+			if aws.StringValue(tag.Key) == SuspiciousTagKey && aws.StringValue(tag.Value) == SuspiciousTagValue {
+				suspicious = true
+			}
+		}
+		if !suspicious {
+			return artifact.Artifact, nil
+		}
+	}
+
+	return Artifact{}, nil
 }
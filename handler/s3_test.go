@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"io"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -65,7 +66,9 @@ type mockedClientS3Upload struct {
 		UploadPart              uint32
 		CompleteMultipartUpload uint32
 		AbortMultipartUpload    uint32
+		PutObjectTagging        uint32
 	}
+	tags map[string][]*s3.Tag
 }
 
 func (c *mockedClientS3Upload) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
@@ -176,6 +179,19 @@ func (c *mockedClientS3Upload) AbortMultipartUpload(input *s3.AbortMultipartUplo
 	return &s3.AbortMultipartUploadOutput{}, nil
 }
 
+func (c *mockedClientS3Upload) PutObjectTagging(input *s3.PutObjectTaggingInput) (*s3.PutObjectTaggingOutput, error) {
+	atomic.AddUint32(&c.CalledApis.PutObjectTagging, 1)
+	if input.Bucket == nil || *input.Bucket != "example-bucket" {
+		return nil, awserr.New(s3.ErrCodeNoSuchBucket, "", nil)
+	} else if c.objects[*input.Key] == nil {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "", nil)
+	}
+
+	c.tags[*input.Key] = input.Tagging.TagSet
+
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
 func TestS3Handler(t *testing.T) {
 	t.Parallel()
 
@@ -205,9 +221,14 @@ func TestS3Handler(t *testing.T) {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
-	if err := wait(); err != nil {
+	summary, err := wait(CompleteUpload)
+	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
 	}
+	expected := Upload{Location: "s3://example-bucket/foo/20211008180917", Parts: 3, Bytes: 3 * s3ChunkMinSize}
+	if summary != expected {
+		t.Errorf("expected %#v, got %#v", expected, summary)
+	}
 	key := "foo/20211008180917"
 	if client.objects[key] == nil {
 		t.Errorf("expected object %s, got nil", key)
@@ -229,6 +250,74 @@ func TestS3Handler(t *testing.T) {
 	}
 }
 
+func TestS3HandlerCompletion(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		completion Completion
+		expected   Upload
+		stored     bool
+		tags       []*s3.Tag
+	}
+	testCases := map[string]testCase{
+		"tagged": {
+			completion: CompleteUploadTagged,
+			expected:   Upload{Location: "s3://example-bucket/foo/20211008180917", Parts: 1, Bytes: s3ChunkMinSize},
+			stored:     true,
+			tags:       []*s3.Tag{{Key: aws.String(SuspiciousTagKey), Value: aws.String(SuspiciousTagValue)}},
+		},
+		"abort": {
+			completion: AbortUpload,
+			expected:   Upload{Parts: 1, Bytes: s3ChunkMinSize},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &mockedClientS3Upload{
+				objects: make(map[string][]byte),
+				tags:    make(map[string][]*s3.Tag),
+			}
+			dest := config.S3DestinationDefinition{
+				Bucket: "example-bucket",
+				Prefix: "foo/",
+			}
+			handler := &S3Handler{client: client, destination: dest}
+
+			reader, writer := io.Pipe()
+			now := time.Date(2021, 10, 8, 18, 9, 17, 0, time.Local)
+			wait, initErr := handler.Handler(reader, now)
+			if initErr != nil {
+				t.Fatalf("unexpected error: %s", initErr)
+			}
+			if _, err := writer.Write(padPart([]byte("1ms"))); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if summary, err := wait(tc.completion); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			} else if summary != tc.expected {
+				t.Errorf("expected %#v, got %#v", tc.expected, summary)
+			}
+			key := "foo/20211008180917"
+			if stored := client.objects[key] != nil; stored != tc.stored {
+				t.Errorf("expected object %s to be stored: %t, got %t", key, tc.stored, stored)
+			}
+			if tags := client.tags[key]; !reflect.DeepEqual(tags, tc.tags) {
+				t.Errorf("expected tags %v, got %v", tc.tags, tags)
+			}
+			if aborted := client.CalledApis.AbortMultipartUpload == 1; aborted == tc.stored {
+				t.Errorf("expected upload to be aborted: %t, got %t", !tc.stored, aborted)
+			}
+		})
+	}
+}
+
 func TestS3HandlerInitError(t *testing.T) {
 	t.Parallel()
 
@@ -292,8 +381,14 @@ func TestS3HandlerUploadError(t *testing.T) {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
-	if err := wait(); err == nil {
+	if summary, err := wait(CompleteUpload); err == nil {
 		t.Error("expected error, got nil")
+	} else if expected := (Upload{Parts: 2, Bytes: 2 * s3ChunkMinSize}); summary != expected {
+		t.Errorf("expected %#v, got %#v", expected, summary)
+	} else if partErr := new(PartError); !errors.As(err, &partErr) {
+		t.Errorf("expected PartError, got %#v", err)
+	} else if partErr.Part != 2 {
+		t.Errorf("expected part 2, got %d", partErr.Part)
 	}
 	key := "foo/20211008180917"
 	if client.objects[key] != nil {
@@ -342,7 +437,7 @@ func TestS3HandlerChunkError(t *testing.T) {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
-	if err := wait(); err == nil {
+	if _, err := wait(CompleteUpload); err == nil {
 		t.Error("expected error, got nil")
 	}
 	key := "foo/20211008180917"
@@ -393,7 +488,7 @@ func TestS3HandlerCompleteError(t *testing.T) {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
-	if err := wait(); err == nil {
+	if _, err := wait(CompleteUpload); err == nil {
 		t.Error("expected error, got nil")
 	}
 	key := "complete-error/20211008180917"
@@ -444,7 +539,7 @@ func TestS3HandlerAbortError(t *testing.T) {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
-	if err := wait(); err == nil {
+	if _, err := wait(CompleteUpload); err == nil {
 		t.Error("expected error, got nil")
 	} else if mErr, ok := err.(*multierror.Error); !ok {
 		t.Errorf("expected multierror, got %T", err)
@@ -472,11 +567,23 @@ func TestS3HandlerAbortError(t *testing.T) {
 
 type mockedClientS3LastRun struct {
 	s3iface.S3API
+	tags       map[string][]*s3.Tag
+	taggingErr error
 	CalledApis struct {
-		ListObjects uint32
+		ListObjects      uint32
+		GetObjectTagging uint32
 	}
 }
 
+func (c *mockedClientS3LastRun) GetObjectTagging(req *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+	atomic.AddUint32(&c.CalledApis.GetObjectTagging, 1)
+	if c.taggingErr != nil {
+		return nil, c.taggingErr
+	}
+
+	return &s3.GetObjectTaggingOutput{TagSet: c.tags[*req.Key]}, nil
+}
+
 func (c *mockedClientS3LastRun) ListObjects(req *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
 	atomic.AddUint32(&c.CalledApis.ListObjects, 1)
 	if req.Bucket == nil || *req.Bucket != "example-bucket" {
@@ -502,7 +609,7 @@ func (c *mockedClientS3LastRun) ListObjects(req *s3.ListObjectsInput) (*s3.ListO
 				{Key: aws.String("foo/20210819093000-barbaz.tgz")},
 				{Key: aws.String("foo/invaliddate-bar.sql")},
 				{Key: aws.String("foo/20210816093000-bar.sql")},
-				{Key: aws.String("foo/20210817093000-bar.sql")},
+				{Key: aws.String("foo/20210817093000-bar.sql"), Size: aws.Int64(42 << 20)},
 				{Key: aws.String("foo/20210815093000-bar.sql")},
 			},
 		},
@@ -518,7 +625,7 @@ func (c *mockedClientS3LastRun) ListObjects(req *s3.ListObjectsInput) (*s3.ListO
 	return pages[*marker], nil
 }
 
-func TestS3LastRun(t *testing.T) {
+func TestS3LastArtifact(t *testing.T) {
 	t.Parallel()
 
 	bucket, prefix, suffix := "example-bucket", "foo/", "-bar.sql"
@@ -535,21 +642,22 @@ func TestS3LastRun(t *testing.T) {
 		client:      s3Client,
 		destination: *dest,
 	}
-	if lastRun, err := s3Handler.LastRun(); err != nil {
+	if last, err := s3Handler.LastArtifact(); err != nil {
 		t.Errorf("expected no error, got %s", err)
-	} else if !expectedLastRun.Equal(lastRun) {
-		t.Errorf("expected %s, got %s", expectedLastRun, lastRun)
+	} else if !expectedLastRun.Equal(last.Timestamp) {
+		t.Errorf("expected %s, got %s", expectedLastRun, last.Timestamp)
+	} else if last.Size != 42<<20 {
+		t.Errorf("expected size %d, got %d", 42<<20, last.Size)
 	}
 	if s3Client.CalledApis.ListObjects != 2 {
 		t.Errorf("expected ListObjects to be called twice, got %d", s3Client.CalledApis.ListObjects)
 	}
 }
 
-func TestS3LastRunEmpty(t *testing.T) {
+func TestS3LastArtifactEmpty(t *testing.T) {
 	t.Parallel()
 
 	bucket, prefix, suffix := "example-bucket", "bar/", "-bar.sql"
-	expectedLastRun := time.Time{}
 
 	dest := &config.S3DestinationDefinition{
 		Region: "us-east-1",
@@ -562,17 +670,17 @@ func TestS3LastRunEmpty(t *testing.T) {
 		client:      s3Client,
 		destination: *dest,
 	}
-	if lastRun, err := s3Handler.LastRun(); err != nil {
+	if last, err := s3Handler.LastArtifact(); err != nil {
 		t.Errorf("expected no error, got %s", err)
-	} else if !expectedLastRun.Equal(lastRun) {
-		t.Errorf("expected %s, got %s", expectedLastRun, lastRun)
+	} else if last != (Artifact{}) {
+		t.Errorf("expected no artifact, got %#v", last)
 	}
 	if s3Client.CalledApis.ListObjects != 1 {
 		t.Errorf("expected ListObjects to be called once, got %d", s3Client.CalledApis.ListObjects)
 	}
 }
 
-func TestS3LastRunError(t *testing.T) {
+func TestS3LastArtifactError(t *testing.T) {
 	t.Parallel()
 
 	bucket, prefix, suffix := "wrong-bucket", "foo/", "-bar.sql"
@@ -588,12 +696,52 @@ func TestS3LastRunError(t *testing.T) {
 		client:      s3Client,
 		destination: *dest,
 	}
-	if lastRun, err := s3Handler.LastRun(); err == nil {
-		t.Errorf("expected error, got %s", lastRun)
-	} else if !lastRun.IsZero() {
-		t.Errorf("expected zero time, got %s", lastRun)
+	if last, err := s3Handler.LastArtifact(); err == nil {
+		t.Errorf("expected error, got %#v", last)
+	} else if last != (Artifact{}) {
+		t.Errorf("expected no artifact, got %#v", last)
 	}
 	if s3Client.CalledApis.ListObjects != 1 {
 		t.Errorf("expected ListObjects to be called once, got %d", s3Client.CalledApis.ListObjects)
 	}
 }
+
+func TestS3LastTrustedArtifact(t *testing.T) {
+	t.Parallel()
+
+	expectedLastRun := time.Date(2021, 8, 16, 9, 30, 0, 0, time.Local)
+
+	s3Client := &mockedClientS3LastRun{
+		tags: map[string][]*s3.Tag{
+			"foo/20210817093000-bar.sql": {{Key: aws.String(SuspiciousTagKey), Value: aws.String(SuspiciousTagValue)}},
+			"foo/20210816093000-bar.sql": {{Key: aws.String("environment"), Value: aws.String("production")}},
+		},
+	}
+	s3Handler := &S3Handler{
+		client:      s3Client,
+		destination: config.S3DestinationDefinition{Bucket: "example-bucket", Prefix: "foo/", Suffix: "-bar.sql"},
+	}
+	if last, err := s3Handler.LastTrustedArtifact(); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	} else if !expectedLastRun.Equal(last.Timestamp) {
+		t.Errorf("expected %s, got %s", expectedLastRun, last.Timestamp)
+	}
+	if s3Client.CalledApis.GetObjectTagging != 2 {
+		t.Errorf("expected GetObjectTagging to be called twice, got %d", s3Client.CalledApis.GetObjectTagging)
+	}
+}
+
+func TestS3LastTrustedArtifactError(t *testing.T) {
+	t.Parallel()
+
+	s3Client := &mockedClientS3LastRun{taggingErr: errors.New("access denied")}
+	s3Handler := &S3Handler{
+		client:      s3Client,
+		destination: config.S3DestinationDefinition{Bucket: "example-bucket", Prefix: "foo/", Suffix: "-bar.sql"},
+	}
+	if last, err := s3Handler.LastTrustedArtifact(); err == nil || err.Error() != "access denied" {
+		t.Errorf("expected access denied error, got %v", err)
+	} else if last != (Artifact{}) {
+		t.Errorf("expected no artifact, got %#v", last)
+	}
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"os"
+	"path"
 	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/chialab/streamlined-backup/backup"
 	"github.com/chialab/streamlined-backup/config"
+	"github.com/chialab/streamlined-backup/metrics"
 	"github.com/chialab/streamlined-backup/notifier"
 	"github.com/chialab/streamlined-backup/utils"
 	"github.com/hashicorp/go-multierror"
@@ -16,6 +23,28 @@ import (
 
 const PARALLEL_TASKS = 2
 
+// Exit codes, so that schedulers such as Kubernetes CronJobs can tell why a run did not succeed. When tasks end
+// differently, failures take precedence over timeouts.
+const (
+	EXIT_FAILURE = 1
+	EXIT_USAGE   = 2
+	EXIT_CONFIG  = 3
+	EXIT_TIMEOUT = 4
+)
+
+// Error loading the configuration, which makes the process exit with EXIT_CONFIG.
+type configError struct {
+	err error
+}
+
+func (e configError) Error() string {
+	return e.err.Error()
+}
+
+func (e configError) Unwrap() error {
+	return e.err
+}
+
 type listOfStrings []string
 
 func (list *listOfStrings) Set(value string) error {
@@ -28,55 +57,276 @@ func (list listOfStrings) String() string {
 }
 
 type cliOptions struct {
-	config        *string
-	pidFile       *string
-	parallel      *uint
-	slackWebhooks *listOfStrings
+	config          *string
+	pidFile         *string
+	parallel        *uint
+	slackWebhooks   *listOfStrings
+	tasks           *listOfStrings
+	force           *bool
+	dryRun          *bool
+	daemon          *bool
+	interval        *time.Duration
+	metricsAddr     *string
+	metricsTextfile *string
+	report          *string
+	logFormat       utils.LogFormat
+	validate        bool
 }
 
 func parseOptions(name string, arguments []string) (*cliOptions, error) {
-	opts := &cliOptions{slackWebhooks: new(listOfStrings)}
+	opts := &cliOptions{slackWebhooks: new(listOfStrings), tasks: new(listOfStrings)}
 	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	if len(arguments) > 0 && arguments[0] == "validate" {
+		opts.validate = true
+		arguments = arguments[1:]
+	}
 
-	flags.Var(opts.slackWebhooks, "slack-webhook", "Slack webhook URL (can be specified multiple times).")
-	opts.config = flags.String("config", "", "Path to configuration file (TOML/JSON).")
+	flags.Var(opts.slackWebhooks, "slack-webhook", "Slack webhook URL notified of all tasks (can be specified multiple times). Deprecated: define notifiers in the configuration file instead.")
+	flags.Var(opts.tasks, "task", "Name of the task to run, glob patterns are accepted (can be specified multiple times).")
+	opts.force = flags.Bool("force", false, "Run tasks immediately, regardless of their schedule.")
+	opts.dryRun = flags.Bool("dry-run", false, "Explain which tasks would run, without running them.")
+	opts.daemon = flags.Bool("daemon", false, "Keep running and start tasks when they are due. Configuration is reloaded on SIGHUP or when it changes.")
+	opts.interval = flags.Duration("interval", CHECK_INTERVAL, "How often schedules and configuration changes are checked in daemon mode.")
+	opts.metricsAddr = flags.String("metrics-address", "", "Address to serve Prometheus metrics on at /metrics in daemon mode, such as \":9090\".")
+	opts.metricsTextfile = flags.String("metrics-textfile", "", "Path of a node_exporter textfile to write Prometheus metrics to after each run.")
+	opts.report = flags.String("report", "", "Path of a JSON file to write the results of the tasks to.")
+	opts.config = flags.String("config", "", "Path to configuration file (TOML/JSON/YAML).")
 	opts.pidFile = flags.String("pid-file", "/var/run/streamlined-backup.pid", "Path to PID file.")
 	opts.parallel = flags.Uint("parallel", PARALLEL_TASKS, "Number of tasks to run in parallel.")
+	logFormat := flags.String("log-format", string(utils.LogFormatText), "Format of the logs written to stderr, either \"text\" or \"json\".")
 	if err := flags.Parse(arguments); err != nil {
 		return nil, err
 	}
+	if format, err := utils.ParseLogFormat(*logFormat); err != nil {
+		fmt.Fprintln(flags.Output(), err)
+		flags.Usage()
+
+		return nil, err
+	} else {
+		opts.logFormat = format
+	}
+	if !opts.validate && flags.NArg() == 1 && flags.Arg(0) == "validate" {
+		opts.validate = true
+	} else if flags.NArg() > 0 {
+		err := fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+		fmt.Fprintln(flags.Output(), err)
+		flags.Usage()
+
+		return nil, err
+	}
 
 	return opts, nil
 }
 
-func withNotifier(opts *cliOptions, callback func(*cliOptions) backup.Results) {
-	slack := notifier.NewSlackNotifier(*opts.slackWebhooks...)
+// Loads the configuration once, so that tasks and notifiers are built from the same files. Without a
+// configuration file, nil is returned.
+func loadConfiguration(opts *cliOptions) (*config.Configuration, error) {
+	if opts.config == nil {
+		return nil, nil
+	}
+
+	cfg, err := config.Load(*opts.config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.ValidateNotifiers(cfg.Notifiers, cfg.Tasks); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Builds the notifiers defined in the configuration. Slack webhooks passed on the command line are notified of
+// all tasks, and are returned even if there is no valid configuration, so that the error can be reported.
+func newNotifier(opts *cliOptions, cfg *config.Configuration) (notifier.Notifier, error) {
+	notifiers := notifier.NewMultiNotifier()
+	if len(*opts.slackWebhooks) > 0 {
+		notifiers = append(notifiers, notifier.NewSlackNotifier(*opts.slackWebhooks...))
+	}
+	if cfg == nil {
+		return notifiers, nil
+	}
+
+	router, err := notifier.NewRouterFromConfig(cfg.Notifiers, cfg.Tasks)
+	if err != nil {
+		return notifiers, err
+	}
+
+	return append(notifiers, router), nil
+}
+
+// Loads the configuration and passes it to the callback, along with the notifiers built from it, which are then
+// notified of the results.
+func withNotifier(opts *cliOptions, callback func(*cliOptions, *config.Configuration, notifier.Notifier) backup.Results) backup.Results {
+	cfg, err := loadConfiguration(opts)
+	notifiers, notifierErr := newNotifier(opts, cfg)
 	defer func() {
 		if panicked := recover(); panicked != nil {
 			err := utils.ToError(panicked)
-			if notifyErr := slack.Error(err); notifyErr != nil {
+			if notifyErr := notifiers.Error(err); notifyErr != nil {
 				panic(multierror.Append(err, notifyErr))
 			}
 
 			panic(err)
 		}
 	}()
+	if err == nil {
+		err = notifierErr
+	}
+	if err != nil {
+		panic(configError{err})
+	}
 
-	results := callback(opts)
-	if err := slack.Notify(results...); err != nil {
+	results := callback(opts, cfg, notifiers)
+	if err := notifiers.Notify(results...); err != nil {
 		panic(err)
 	}
+
+	return results
+}
+
+// Runs the tasks and returns the exit code. Errors are reported without a stack trace: if tasks ran before the
+// error, such as a notification that could not be delivered, the exit code still reflects their results.
+func runTasks(opts *cliOptions, callback func(*cliOptions, *config.Configuration, notifier.Notifier) backup.Results) (code int) {
+	var results backup.Results
+	defer func() {
+		if panicked := recover(); panicked != nil {
+			err := utils.ToError(panicked)
+			fmt.Fprintln(os.Stderr, err)
+
+			if errors.As(err, &configError{}) {
+				code = EXIT_CONFIG
+			} else if code = exitCode(results); code == 0 {
+				code = EXIT_FAILURE
+			}
+		}
+	}()
+
+	withNotifier(opts, func(opts *cliOptions, cfg *config.Configuration, notifiers notifier.Notifier) backup.Results {
+		results = callback(opts, cfg, notifiers)
+
+		return results
+	})
+
+	return exitCode(results)
+}
+
+func exitCode(results backup.Results) int {
+	code := 0
+	for _, result := range results {
+		switch result.Status() {
+		case backup.StatusFailed, backup.StatusSuspicious:
+			return EXIT_FAILURE
+		case backup.StatusTimeout:
+			code = EXIT_TIMEOUT
+		}
+	}
+
+	return code
+}
+
+func selectTasks(tasks map[string]config.Task, patterns ...string) (map[string]config.Task, error) {
+	if len(patterns) == 0 {
+		return tasks, nil
+	}
+
+	selected := map[string]config.Task{}
+	for _, pattern := range patterns {
+		matched := false
+		for name, task := range tasks {
+			if ok, err := path.Match(pattern, name); err != nil {
+				return nil, fmt.Errorf("invalid task pattern %q: %w", pattern, err)
+			} else if ok {
+				selected[name] = task
+				matched = true
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("no task matches %q", pattern)
+		}
+	}
+
+	return selected, nil
 }
 
-func run(opts *cliOptions) backup.Results {
+func loadTasks(opts *cliOptions, tasksDfn map[string]config.Task) (backup.TasksList, error) {
+	tasksDfn, err := selectTasks(tasksDfn, *opts.tasks...)
+	if err != nil {
+		return nil, err
+	}
+
+	return backup.NewTasksList(tasksDfn)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func explain(opts *cliOptions, out io.Writer) error {
 	tasksDfn, err := config.LoadConfiguration(*opts.config)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	tasks, err := backup.NewTasksList(tasksDfn)
+	tasks, err := loadTasks(opts, tasksDfn)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	decisions := tasks.Explain(time.Now(), *opts.force)
+	sort.Sort(decisions)
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TASK\tLAST RUN\tNEXT RUN\tACTION\tREASON")
+	for _, decision := range decisions {
+		action := "SKIP"
+		if decision.Run {
+			action = "RUN"
+		}
+		lastRun, nextRun := formatTime(decision.LastRun), formatTime(decision.NextRun)
+		if decision.Err != nil {
+			lastRun, nextRun = "unknown", "unknown"
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", decision.Name, lastRun, nextRun, action, decision.Reason)
+	}
+
+	return writer.Flush()
+}
+
+func validate(opts *cliOptions, out io.Writer) error {
+	cfg, err := config.Load(*opts.config)
+	if err != nil {
+		return err
+	}
+
+	var errors *multierror.Error
+	if err := config.Validate(cfg.Tasks); err != nil {
+		errors = multierror.Append(errors, err)
+	}
+	if err := config.ValidateNotifiers(cfg.Notifiers, cfg.Tasks); err != nil {
+		errors = multierror.Append(errors, err)
+	}
+	if err := errors.ErrorOrNil(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Configuration is valid (%d tasks, %d notifiers).\n", len(cfg.Tasks), len(cfg.Notifiers))
+
+	return nil
+}
+
+// Runs the tasks due, or all the selected ones when forced. Results are notified by withNotifier.
+func run(opts *cliOptions, cfg *config.Configuration, _ notifier.Notifier) backup.Results {
+	tasks, err := loadTasks(opts, cfg.Tasks)
+	if err != nil {
+		panic(configError{err})
 	}
 
 	pid := utils.NewPidFile(*opts.pidFile)
@@ -87,19 +337,96 @@ func run(opts *cliOptions) backup.Results {
 	}
 	defer pid.MustRelease()
 
-	now := time.Now()
-	results := tasks.Run(now, *opts.parallel)
+	return recordResults(opts, tasks.Run(time.Now(), *opts.parallel, *opts.force))
+}
+
+// Sorts the results by status, successes first and timeouts last, then records them in the metrics textfile and
+// in the report, when they are enabled.
+func recordResults(opts *cliOptions, results backup.Results) backup.Results {
 	sort.Sort(results)
 
+	if textfile := metricsTextfile(opts); textfile != "" {
+		if err := updateMetricsTextfile(textfile, results); err != nil {
+			utils.DefaultLogger().With("component", "metrics").Error("Metrics not written", err)
+		}
+	}
+	if report := reportFile(opts); report != "" {
+		if err := writeReport(report, results); err != nil {
+			utils.DefaultLogger().With("component", "report").Error("Report not written", err)
+		}
+	}
+
 	return results
 }
 
+func reportFile(opts *cliOptions) string {
+	if opts.report == nil {
+		return ""
+	}
+
+	return *opts.report
+}
+
+// Writes the results as a JSON array, replacing the file atomically.
+func writeReport(path string, results backup.Results) error {
+	if results == nil {
+		results = backup.Results{}
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(path, append(data, '\n'), 0644)
+}
+
+func metricsTextfile(opts *cliOptions) string {
+	if opts.metricsTextfile == nil {
+		return ""
+	}
+
+	return *opts.metricsTextfile
+}
+
+// Records the results in the node_exporter textfile, preserving the metrics of tasks that were not run. The
+// results are numbered in place with their attempt, derived from the runs previously recorded in the textfile.
+func updateMetricsTextfile(path string, results backup.Results) error {
+	registry := metrics.NewRegistry()
+	if err := registry.ReadFile(path); err != nil {
+		return err
+	}
+	for i, result := range results {
+		if result.Status() != backup.StatusSkipped {
+			results[i] = result.WithAttempt(registry.Attempt(result.Name()))
+		}
+	}
+	registry.Record(results...)
+
+	return registry.WriteFile(path)
+}
+
 func main() {
-	if opts, err := parseOptions(os.Args[0], os.Args[1:]); err == flag.ErrHelp {
+	opts, err := parseOptions(os.Args[0], os.Args[1:])
+	if err == flag.ErrHelp {
 		os.Exit(0)
 	} else if err != nil {
-		os.Exit(2)
+		os.Exit(EXIT_USAGE)
+	}
+	utils.SetLogFormat(opts.logFormat)
+
+	if opts.validate {
+		if err := validate(opts, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(EXIT_CONFIG)
+		}
+	} else if *opts.dryRun {
+		if err := explain(opts, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(EXIT_CONFIG)
+		}
+	} else if *opts.daemon {
+		os.Exit(runTasks(opts, runDaemon))
 	} else {
-		withNotifier(opts, run)
+		os.Exit(runTasks(opts, run))
 	}
 }
@@ -1,20 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/chialab/streamlined-backup/backup"
 	"github.com/chialab/streamlined-backup/config"
 	"github.com/chialab/streamlined-backup/handler"
+	"github.com/chialab/streamlined-backup/notifier"
+	"github.com/chialab/streamlined-backup/utils"
 	"github.com/hashicorp/go-multierror"
 )
 
@@ -38,7 +47,7 @@ func TestListOfStrings(t *testing.T) {
 func TestParseOptions(t *testing.T) {
 	t.Parallel()
 
-	args := []string{"-parallel=42", "-config=foo.json", "-slack-webhook=http://example.org", "-slack-webhook=http://example.com", "-pid-file=pid.txt"}
+	args := []string{"-parallel=42", "-config=foo.json", "-slack-webhook=http://example.org", "-slack-webhook=http://example.com", "-pid-file=pid.txt", "-task=foo", "-task=bar_*", "-force", "-dry-run", "-daemon", "-interval=1m", "-log-format=json", "-report=report.json"}
 	if opts, err := parseOptions("foo", args); err != nil {
 		t.Errorf("unexpected error: %#v", err)
 	} else if *opts.parallel != 42 {
@@ -49,6 +58,42 @@ func TestParseOptions(t *testing.T) {
 		t.Errorf("expected %#v, got %#v", expected, opts.slackWebhooks)
 	} else if *opts.pidFile != "pid.txt" {
 		t.Errorf("expected pid.txt, got %#v", *opts.pidFile)
+	} else if expected := (&listOfStrings{"foo", "bar_*"}); !reflect.DeepEqual(opts.tasks, expected) {
+		t.Errorf("expected %#v, got %#v", expected, opts.tasks)
+	} else if !*opts.force {
+		t.Errorf("expected force to be true")
+	} else if !*opts.dryRun {
+		t.Errorf("expected dry-run to be true")
+	} else if !*opts.daemon {
+		t.Errorf("expected daemon to be true")
+	} else if *opts.interval != time.Minute {
+		t.Errorf("expected 1m0s, got %s", *opts.interval)
+	} else if opts.logFormat != utils.LogFormatJSON {
+		t.Errorf("expected json, got %s", opts.logFormat)
+	} else if *opts.report != "report.json" {
+		t.Errorf("expected report.json, got %#v", *opts.report)
+	}
+}
+
+func TestParseOptionsDefaults(t *testing.T) {
+	t.Parallel()
+
+	if opts, err := parseOptions("foo", []string{}); err != nil {
+		t.Errorf("unexpected error: %#v", err)
+	} else if *opts.parallel != PARALLEL_TASKS {
+		t.Errorf("expected %d, got %#v", PARALLEL_TASKS, *opts.parallel)
+	} else if len(*opts.tasks) != 0 {
+		t.Errorf("expected no tasks, got %#v", *opts.tasks)
+	} else if *opts.force {
+		t.Errorf("expected force to be false")
+	} else if *opts.dryRun {
+		t.Errorf("expected dry-run to be false")
+	} else if *opts.daemon {
+		t.Errorf("expected daemon to be false")
+	} else if *opts.interval != CHECK_INTERVAL {
+		t.Errorf("expected %s, got %s", CHECK_INTERVAL, *opts.interval)
+	} else if opts.logFormat != utils.LogFormatText {
+		t.Errorf("expected text, got %s", opts.logFormat)
 	}
 }
 
@@ -63,6 +108,16 @@ func TestParseOptionsErr(t *testing.T) {
 	}
 }
 
+// Runs the tasks with the configuration loaded as withNotifier does.
+func runConfigured(t *testing.T, opts *cliOptions) backup.Results {
+	cfg, err := loadConfiguration(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return run(opts, cfg, notifier.NewMultiNotifier())
+}
+
 func TestWithNotifier(t *testing.T) {
 	t.Parallel()
 
@@ -79,7 +134,7 @@ func TestWithNotifier(t *testing.T) {
 	}
 
 	invocations := 0
-	withNotifier(opts, func(o *cliOptions) backup.Results {
+	withNotifier(opts, func(*cliOptions, *config.Configuration, notifier.Notifier) backup.Results {
 		invocations++
 
 		return backup.Results{backup.NewResultSuccess(&backup.Task{}, []string{})}
@@ -123,7 +178,7 @@ func TestWithNotifierCallbackPanic(t *testing.T) {
 		}
 	}()
 
-	withNotifier(opts, func(o *cliOptions) backup.Results {
+	withNotifier(opts, func(*cliOptions, *config.Configuration, notifier.Notifier) backup.Results {
 		invocations++
 
 		panic("test error")
@@ -167,7 +222,7 @@ func TestWithNotifierNotifyPanic(t *testing.T) {
 		}
 	}()
 
-	withNotifier(opts, func(o *cliOptions) backup.Results {
+	withNotifier(opts, func(*cliOptions, *config.Configuration, notifier.Notifier) backup.Results {
 		invocations++
 
 		return backup.Results{backup.NewResultSuccess(&backup.Task{}, []string{})}
@@ -175,21 +230,121 @@ func TestWithNotifierNotifyPanic(t *testing.T) {
 	t.Fatal("expected panic")
 }
 
+func TestWithNotifierRoutes(t *testing.T) {
+	t.Parallel()
+
+	mutex := sync.Mutex{}
+	received := map[string][]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		for _, task := range []string{"foo", "bar"} {
+			if strings.Contains(string(body), `"task": "`+task+`"`) {
+				mutex.Lock()
+				received[r.URL.Path] = append(received[r.URL.Path], task)
+				mutex.Unlock()
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	configFile := path.Join(t.TempDir(), "config.toml")
+	data := fmt.Sprintf(`
+[notifiers.dba]
+type = "webhook"
+webhook = { urls = ["%[1]s/dba"] }
+
+[notifiers.ops]
+type = "webhook"
+webhook = { urls = ["%[1]s/ops"] }
+
+[foo]
+command = ["true"]
+notify = ["dba"]
+`, ts.URL)
+	if err := os.WriteFile(configFile, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &cliOptions{config: &configFile, slackWebhooks: &listOfStrings{}}
+	withNotifier(opts, func(*cliOptions, *config.Configuration, notifier.Notifier) backup.Results {
+		results := backup.Results{}
+		for _, name := range []string{"foo", "bar"} {
+			task, err := backup.NewTask(name, config.Task{Destination: config.Destination{Type: config.S3Destination}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			results = append(results, backup.NewResultSuccess(task, []string{}))
+		}
+
+		return results
+	})
+
+	expected := map[string][]string{"/dba": {"bar", "foo"}, "/ops": {"bar"}}
+	for _, tasks := range received {
+		sort.Strings(tasks)
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("expected %v, got %v", expected, received)
+	}
+}
+
+func TestWithNotifierInvalidNotifiers(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	configFile := path.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(configFile, []byte("[foo]\ncommand = [\"true\"]\nnotify = [\"missing\"]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &cliOptions{config: &configFile, slackWebhooks: &listOfStrings{ts.URL}}
+	invocations := 0
+	defer func() {
+		if invocations != 0 {
+			t.Errorf("expected callback not to be invoked, got %d", invocations)
+		}
+		if requests != 1 {
+			t.Errorf("expected Slack webhook to be called once, got %d", requests)
+		}
+		if panicked := recover(); panicked == nil {
+			t.Errorf("expected panic, got nil")
+		} else if err, ok := panicked.(error); !ok || !strings.Contains(err.Error(), `task "foo": unknown notifier "missing"`) {
+			t.Errorf("expected unknown notifier error, got %#v", panicked)
+		}
+	}()
+
+	withNotifier(opts, func(*cliOptions, *config.Configuration, notifier.Notifier) backup.Results {
+		invocations++
+
+		return backup.Results{}
+	})
+	t.Fatal("expected panic")
+}
+
 func TestRunInvalidConfigFile(t *testing.T) {
 	t.Parallel()
 
 	configFile := "foo.xml"
-	opts := &cliOptions{config: &configFile}
+	opts := &cliOptions{config: &configFile, slackWebhooks: &listOfStrings{}}
 
 	defer func() {
 		if panicked := recover(); panicked == nil {
 			t.Errorf("expected panic, got nil")
-		} else if panicked != config.ErrUnsupportedConfigFile {
-			t.Errorf("expected %#v, got %#v", config.ErrUnsupportedConfigFile, panicked)
+		} else if err, ok := panicked.(configError); !ok || !errors.Is(err, config.ErrUnsupportedConfigFile) {
+			t.Errorf("expected %#v, got %#v", configError{config.ErrUnsupportedConfigFile}, panicked)
 		}
 	}()
 
-	run(opts)
+	withNotifier(opts, run)
 	t.Fatal("expected panic")
 }
 
@@ -203,17 +358,17 @@ func TestRunInvalidConfig(t *testing.T) {
 		t.Fatalf("unepected error: %s", err)
 	}
 
-	opts := &cliOptions{config: &configFile}
+	opts := &cliOptions{config: &configFile, tasks: &listOfStrings{}}
 
 	defer func() {
 		if panicked := recover(); panicked == nil {
 			t.Errorf("expected panic, got nil")
-		} else if panicked != handler.ErrUnknownDestination {
-			t.Errorf("expected %#v, got %#v", handler.ErrUnknownDestination, panicked)
+		} else if err, ok := panicked.(configError); !ok || !errors.Is(err, handler.ErrUnknownDestination) {
+			t.Errorf("expected %#v, got %#v", configError{handler.ErrUnknownDestination}, panicked)
 		}
 	}()
 
-	run(opts)
+	runConfigured(t, opts)
 	t.Fatal("expected panic")
 }
 
@@ -245,9 +400,9 @@ func TestRunPidRunning(t *testing.T) {
 		}
 	}()
 
-	opts := &cliOptions{config: &configFile, pidFile: &pidFile}
+	opts := &cliOptions{config: &configFile, pidFile: &pidFile, tasks: &listOfStrings{}}
 
-	results := run(opts)
+	results := runConfigured(t, opts)
 	if len(results) != 0 {
 		t.Errorf("expected 0 results, got %d", len(results))
 	}
@@ -265,10 +420,553 @@ func TestRun(t *testing.T) {
 	pidFile := path.Join(tmpDir, "foo.pid")
 
 	parallel := uint(1)
-	opts := &cliOptions{config: &configFile, pidFile: &pidFile, parallel: &parallel}
+	force := false
+	report := path.Join(tmpDir, "report.json")
+	opts := &cliOptions{config: &configFile, pidFile: &pidFile, parallel: &parallel, tasks: &listOfStrings{}, force: &force, report: &report}
 
-	results := run(opts)
+	results := runConfigured(t, opts)
 	if len(results) != 0 {
 		t.Errorf("expected 0 results, got %d", len(results))
 	}
+	if data, err := os.ReadFile(report); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if string(data) != "[]\n" {
+		t.Errorf("expected empty report, got %q", data)
+	}
+}
+
+func TestRunTasksConfigError(t *testing.T) {
+	t.Parallel()
+
+	configFile := "foo.xml"
+	opts := &cliOptions{config: &configFile, slackWebhooks: &listOfStrings{}, tasks: &listOfStrings{}}
+
+	if code := runTasks(opts, run); code != EXIT_CONFIG {
+		t.Errorf("expected %d, got %d", EXIT_CONFIG, code)
+	}
+}
+
+func TestRunTasksPanic(t *testing.T) {
+	t.Parallel()
+
+	opts := &cliOptions{slackWebhooks: &listOfStrings{}}
+	code := runTasks(opts, func(*cliOptions, *config.Configuration, notifier.Notifier) backup.Results {
+		panic(errors.New("test error"))
+	})
+	if code != EXIT_FAILURE {
+		t.Errorf("expected %d, got %d", EXIT_FAILURE, code)
+	}
+}
+
+func TestRunTasksNotifyError(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		expected int
+		result   backup.Result
+	}{
+		"success": {expected: EXIT_FAILURE, result: backup.NewResultSuccess(task, []string{})},
+		"timeout": {expected: EXIT_TIMEOUT, result: backup.NewResultTimeout(task, []string{})},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := &cliOptions{slackWebhooks: &listOfStrings{ts.URL}}
+			code := runTasks(opts, func(*cliOptions, *config.Configuration, notifier.Notifier) backup.Results {
+				return backup.Results{tc.result}
+			})
+			if code != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, code)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	success := backup.NewResultSuccess(task, []string{})
+	skipped := backup.NewResultSkipped(task)
+	failed := backup.NewResultFailed(task, errors.New("test error"), []string{})
+	suspicious := backup.NewResultSuspicious(task, errors.New("test error"), []string{})
+	timeout := backup.NewResultTimeout(task, []string{})
+
+	testCases := map[string]struct {
+		expected int
+		results  backup.Results
+	}{
+		"none":       {expected: 0, results: backup.Results{}},
+		"success":    {expected: 0, results: backup.Results{success, skipped}},
+		"failed":     {expected: EXIT_FAILURE, results: backup.Results{success, failed}},
+		"suspicious": {expected: EXIT_FAILURE, results: backup.Results{suspicious, success}},
+		"timeout":    {expected: EXIT_TIMEOUT, results: backup.Results{success, timeout}},
+		"both":       {expected: EXIT_FAILURE, results: backup.Results{timeout, failed}},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if code := exitCode(tc.results); code != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, code)
+			}
+		})
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	t.Parallel()
+
+	report := path.Join(t.TempDir(), "report.json")
+	newTask := func(name string) *backup.Task {
+		task, err := backup.NewTask(name, config.Task{Destination: config.Destination{Type: config.S3Destination}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return task
+	}
+	results := backup.Results{
+		backup.NewResultFailed(newTask("bar"), errors.New("test error"), []string{"logging"}),
+		backup.NewResultSuccess(newTask("foo"), []string{}),
+	}
+
+	if err := writeReport(report, results); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written backup.Results
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(written) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(written))
+	}
+	if written[0].Name() != "bar" || written[0].Status() != backup.StatusFailed || written[0].Error().Error() != "test error" {
+		t.Errorf("expected failed result of bar, got %+v", written[0])
+	}
+	if written[1].Name() != "foo" || written[1].Status() != backup.StatusSuccess {
+		t.Errorf("expected successful result of foo, got %+v", written[1])
+	}
+
+	if err := writeReport(report, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if data, err := os.ReadFile(report); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "[]\n" {
+		t.Errorf("expected empty report, got %q", data)
+	}
+}
+
+func TestRecordResults(t *testing.T) {
+	t.Parallel()
+
+	report := path.Join(t.TempDir(), "report.json")
+	newTask := func(name string) *backup.Task {
+		task, err := backup.NewTask(name, config.Task{Destination: config.Destination{Type: config.S3Destination}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return task
+	}
+	results := backup.Results{
+		backup.NewResultTimeout(newTask("foo"), []string{}),
+		backup.NewResultSuccess(newTask("bar"), []string{}),
+		backup.NewResultFailed(newTask("baz"), errors.New("test error"), []string{}),
+		backup.NewResultSuspicious(newTask("qux"), errors.New("test warning"), []string{}),
+		backup.NewResultSuccess(newTask("abc"), []string{}),
+	}
+
+	recordResults(&cliOptions{report: &report}, results)
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written backup.Results
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	actual := []string{}
+	for _, result := range written {
+		actual = append(actual, fmt.Sprintf("%s:%s", result.Name(), result.Status()))
+	}
+	expected := []string{"abc:success", "bar:success", "qux:suspicious", "baz:failed", "foo:timeout"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected report in order %v, got %v", expected, actual)
+	}
+}
+
+func TestUpdateMetricsTextfile(t *testing.T) {
+	t.Parallel()
+
+	textfile := path.Join(t.TempDir(), "streamlined_backup.prom")
+	newTask := func(name string) *backup.Task {
+		task, err := backup.NewTask(name, config.Task{Destination: config.Destination{Type: config.S3Destination}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return task
+	}
+	newResult := func(name string) backup.Result {
+		return backup.NewResultSuccess(newTask(name), []string{})
+	}
+	newFailedResult := func(name string) backup.Result {
+		return backup.NewResultFailed(newTask(name), errors.New("test error"), []string{})
+	}
+
+	if err := updateMetricsTextfile(textfile, backup.Results{newResult("foo")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := updateMetricsTextfile(textfile, backup.Results{newResult("bar")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`streamlined_backup_status{task="foo",status="success"} 1`, `streamlined_backup_status{task="bar",status="success"} 1`} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("expected %s, got %s", expected, data)
+		}
+	}
+
+	results := backup.Results{newFailedResult("foo"), newResult("bar")}
+	if err := updateMetricsTextfile(textfile, results); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if attempt := results[0].Attempt(); attempt != 1 {
+		t.Errorf("expected attempt 1 after a success, got %d", attempt)
+	}
+	for i, expected := range []int{2, 3} {
+		results := backup.Results{newFailedResult("foo")}
+		if err := updateMetricsTextfile(textfile, results); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if attempt := results[0].Attempt(); attempt != expected {
+			t.Errorf("run %d: expected attempt %d, got %d", i+1, expected, attempt)
+		}
+	}
+
+	if err := os.WriteFile(textfile, []byte("invalid\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateMetricsTextfile(textfile, backup.Results{}); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestSelectTasks(t *testing.T) {
+	t.Parallel()
+
+	tasks := map[string]config.Task{
+		"mysql_daily":    {},
+		"mysql_weekly":   {},
+		"postgres_daily": {},
+		"files":          {},
+	}
+
+	type testCase struct {
+		patterns []string
+		expected []string
+	}
+	testCases := map[string]testCase{
+		"all": {
+			patterns: []string{},
+			expected: []string{"files", "mysql_daily", "mysql_weekly", "postgres_daily"},
+		},
+		"exact": {
+			patterns: []string{"files"},
+			expected: []string{"files"},
+		},
+		"glob": {
+			patterns: []string{"mysql_*"},
+			expected: []string{"mysql_daily", "mysql_weekly"},
+		},
+		"multiple": {
+			patterns: []string{"*_daily", "files", "postgres_*"},
+			expected: []string{"files", "mysql_daily", "postgres_daily"},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			selected, err := selectTasks(tasks, tc.patterns...)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			names := []string{}
+			for name := range selected {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestSelectTasksError(t *testing.T) {
+	t.Parallel()
+
+	tasks := map[string]config.Task{"foo": {}}
+
+	if _, err := selectTasks(tasks, "foo", "bar*"); err == nil {
+		t.Errorf("expected error, got nil")
+	} else if err.Error() != `no task matches "bar*"` {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := selectTasks(tasks, "[foo"); err == nil {
+		t.Errorf("expected error, got nil")
+	} else if !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("expected %#v, got %#v", path.ErrBadPattern, err)
+	}
+}
+
+func TestRunSelectedTasks(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	configFile := path.Join(tmpDir, "foo.json")
+	data := `{"foo": {"destination": {"type": "unknown"}}, "bar": {"destination": {"type": "s3"}}}`
+	if err := os.WriteFile(configFile, []byte(data), 0644); err != nil {
+		t.Fatalf("unepected error: %s", err)
+	}
+
+	pidFile := path.Join(tmpDir, "foo.pid")
+	cmd := exec.Command("tail", "-f", "/dev/null")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+	defer func() {
+		if err := cmd.Process.Signal(os.Kill); err != nil {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+		var exitErr *exec.ExitError
+		if err := cmd.Wait(); err != nil && !errors.As(err, &exitErr) {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	}()
+
+	// Task "foo" has an invalid destination, but it is not selected.
+	opts := &cliOptions{config: &configFile, pidFile: &pidFile, tasks: &listOfStrings{"ba?"}}
+
+	results := runConfigured(t, opts)
+	if len(results) != 0 {
+		t.Errorf("expected 0 results, got %d", len(results))
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	t.Parallel()
+
+	if actual := formatTime(time.Time{}); actual != "never" {
+		t.Errorf("expected never, got %s", actual)
+	}
+	ts := time.Date(2021, 10, 6, 19, 10, 38, 0, time.UTC)
+	if actual := formatTime(ts); actual != "2021-10-06T19:10:38Z" {
+		t.Errorf("expected 2021-10-06T19:10:38Z, got %s", actual)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	configFile := path.Join(tmpDir, "foo.json")
+	if err := os.WriteFile(configFile, []byte(`{}`), 0644); err != nil {
+		t.Fatalf("unepected error: %s", err)
+	}
+
+	force := false
+	opts := &cliOptions{config: &configFile, tasks: &listOfStrings{}, force: &force}
+
+	out := bytes.NewBuffer(nil)
+	if err := explain(opts, out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "TASK  LAST RUN  NEXT RUN  ACTION  REASON\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestExplainInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	configFile := path.Join(tmpDir, "foo.json")
+	data := `{"foo": {"destination": {"type": "unknown"}}}`
+	if err := os.WriteFile(configFile, []byte(data), 0644); err != nil {
+		t.Fatalf("unepected error: %s", err)
+	}
+
+	force := false
+	opts := &cliOptions{config: &configFile, tasks: &listOfStrings{}, force: &force}
+
+	out := bytes.NewBuffer(nil)
+	if err := explain(opts, out); err != handler.ErrUnknownDestination {
+		t.Errorf("expected %#v, got %#v", handler.ErrUnknownDestination, err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output, got %q", out.String())
+	}
+}
+
+func TestParseOptionsInvalidLogFormat(t *testing.T) {
+	t.Parallel()
+
+	args := []string{"-config=foo.json", "-log-format=xml"}
+	if _, err := parseOptions("foo", args); err == nil {
+		t.Errorf("expected error, got nil")
+	} else if !errors.Is(err, utils.ErrUnknownLogFormat) {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestParseOptionsValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string][]string{
+		"before_flags": {"validate", "-config=foo.json"},
+		"after_flags":  {"-config=foo.json", "validate"},
+	}
+	for name, args := range testCases {
+		args := args
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if opts, err := parseOptions("foo", args); err != nil {
+				t.Errorf("unexpected error: %#v", err)
+			} else if !opts.validate {
+				t.Errorf("expected validate to be true")
+			} else if *opts.config != "foo.json" {
+				t.Errorf("expected foo.json, got %#v", *opts.config)
+			}
+		})
+	}
+}
+
+func TestParseOptionsUnexpectedArguments(t *testing.T) {
+	t.Parallel()
+
+	args := []string{"-config=foo.json", "foo", "bar"}
+	if _, err := parseOptions("foo", args); err == nil {
+		t.Errorf("expected error, got nil")
+	} else if err.Error() != "unexpected arguments: foo bar" {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	configFile := path.Join(tmpDir, "foo.json")
+	data := `{"foo": {"schedule": "@daily", "command": ["true"], "destination": {"type": "s3", "s3": {"bucket": "example-bucket", "region": "eu-west-1"}}}}`
+	if err := os.WriteFile(configFile, []byte(data), 0644); err != nil {
+		t.Fatalf("unepected error: %s", err)
+	}
+
+	opts := &cliOptions{config: &configFile}
+
+	out := bytes.NewBuffer(nil)
+	if err := validate(opts, out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "Configuration is valid (1 tasks, 0 notifiers).\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	configFile := path.Join(tmpDir, "foo.json")
+	data := `{"foo": {"schedule": "@daily", "destination": {"type": "s3", "s3": {"bucket": "example-bucket", "region": "eu-west-1"}}}, "bar": {"command": ["true"], "destination": {"type": "s3", "s3": {"bucket": "example-bucket", "region": "eu-west-1"}}}}`
+	if err := os.WriteFile(configFile, []byte(data), 0644); err != nil {
+		t.Fatalf("unepected error: %s", err)
+	}
+
+	opts := &cliOptions{config: &configFile}
+
+	out := bytes.NewBuffer(nil)
+	err := validate(opts, out)
+	if merr, ok := err.(*multierror.Error); !ok {
+		t.Fatalf("expected *multierror.Error, got %#v", err)
+	} else if len(merr.Errors) != 3 {
+		t.Errorf("expected 3 errors, got %d", len(merr.Errors))
+	} else if expected := `task "bar": schedule is required`; merr.Errors[0].Error() != expected {
+		t.Errorf("expected %s, got %s", expected, merr.Errors[0])
+	} else if expected := `task "foo": command is required`; merr.Errors[1].Error() != expected {
+		t.Errorf("expected %s, got %s", expected, merr.Errors[1])
+	} else if expected := `task "bar": destination overlaps with task "foo", last run would be ambiguous`; merr.Errors[2].Error() != expected {
+		t.Errorf("expected %s, got %s", expected, merr.Errors[2])
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output, got %q", out.String())
+	}
+}
+
+func TestValidateNotifierErrors(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	configFile := path.Join(tmpDir, "foo.json")
+	data := `{"notifiers": {"slack": {"type": "slack"}}, "foo": {"schedule": "@daily", "command": ["true"], "notify": ["pagerduty"], "destination": {"type": "s3", "s3": {"bucket": "example-bucket", "region": "eu-west-1"}}}}`
+	if err := os.WriteFile(configFile, []byte(data), 0644); err != nil {
+		t.Fatalf("unepected error: %s", err)
+	}
+
+	opts := &cliOptions{config: &configFile}
+
+	err := validate(opts, bytes.NewBuffer(nil))
+	if merr, ok := err.(*multierror.Error); !ok {
+		t.Fatalf("expected *multierror.Error, got %#v", err)
+	} else if len(merr.Errors) != 2 {
+		t.Errorf("expected 2 errors, got %d", len(merr.Errors))
+	} else if expected := `notifier "slack": slack.webhooks is required`; merr.Errors[0].Error() != expected {
+		t.Errorf("expected %s, got %s", expected, merr.Errors[0])
+	} else if expected := `task "foo": unknown notifier "pagerduty"`; merr.Errors[1].Error() != expected {
+		t.Errorf("expected %s, got %s", expected, merr.Errors[1])
+	}
+}
+
+func TestValidateInvalidConfigFile(t *testing.T) {
+	t.Parallel()
+
+	configFile := "foo.xml"
+	opts := &cliOptions{config: &configFile}
+
+	if err := validate(opts, bytes.NewBuffer(nil)); err != config.ErrUnsupportedConfigFile {
+		t.Errorf("expected %#v, got %#v", config.ErrUnsupportedConfigFile, err)
+	}
 }
@@ -0,0 +1,228 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/utils"
+)
+
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	lastSuccessMetric = "streamlined_backup_last_success_timestamp_seconds"
+	lastAttemptMetric = "streamlined_backup_last_attempt_timestamp_seconds"
+	durationMetric    = "streamlined_backup_last_duration_seconds"
+	uploadedMetric    = "streamlined_backup_last_uploaded_bytes"
+	partsMetric       = "streamlined_backup_last_upload_parts"
+	statusMetric      = "streamlined_backup_status"
+	retriesMetric     = "streamlined_backup_retries"
+)
+
+var definitions = []struct {
+	name string
+	help string
+}{
+	{lastSuccessMetric, "Time the last successful run of the task completed, in seconds since the epoch."},
+	{lastAttemptMetric, "Time the last run of the task started, in seconds since the epoch."},
+	{durationMetric, "Duration of the last run of the task, in seconds."},
+	{uploadedMetric, "Bytes uploaded to the destination by the last run of the task."},
+	{partsMetric, "Number of parts uploaded by the last run of the task."},
+	{statusMetric, "Outcome of the last run of the task: 1 for the current status, 0 for the others."},
+	{retriesMetric, "Number of consecutive runs of the task that did not succeed before the last one."},
+}
+
+var statuses = []backup.Status{backup.StatusSuccess, backup.StatusSuspicious, backup.StatusFailed, backup.StatusTimeout}
+
+// Per-task gauges in the Prometheus text format. Values are kept for tasks that were not run, so that
+// the registry can be written to a node_exporter textfile by each run, or served in daemon mode.
+type Registry struct {
+	mutex sync.Mutex
+	// Values by metric name and labels, as they appear in the text format.
+	values map[string]map[string]float64
+	now    func() time.Time
+}
+
+func NewRegistry() *Registry {
+	values := map[string]map[string]float64{}
+	for _, definition := range definitions {
+		values[definition.name] = map[string]float64{}
+	}
+
+	return &Registry{values: values, now: time.Now}
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func taskLabels(task string) string {
+	return fmt.Sprintf(`task="%s"`, escapeLabel(task))
+}
+
+func statusLabels(task string, status backup.Status) string {
+	return fmt.Sprintf(`task="%s",status="%s"`, escapeLabel(task), status)
+}
+
+// Number of the next run of the task among its consecutive runs that did not succeed: 1 unless the last
+// recorded run of the task failed, timed out or was suspicious.
+func (r *Registry) Attempt(task string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.attempt(task)
+}
+
+func (r *Registry) attempt(task string) int {
+	// A run that follows a success is not a retry, even if it fails.
+	if previous, ok := r.values[statusMetric][statusLabels(task, backup.StatusSuccess)]; ok && previous == 0 {
+		return int(r.values[retriesMetric][taskLabels(task)]) + 2
+	}
+
+	return 1
+}
+
+// Updates the metrics of the tasks with their results. Skipped results are ignored.
+func (r *Registry) Record(results ...backup.Result) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, result := range results {
+		if result.Status() == backup.StatusSkipped {
+			continue
+		}
+
+		labels := taskLabels(result.Name())
+		startTime, endTime := result.StartTime(), result.EndTime()
+		if startTime.IsZero() {
+			startTime = r.now()
+		}
+		if endTime.IsZero() {
+			endTime = startTime
+		}
+
+		retries := float64(r.attempt(result.Name()) - 1)
+		r.values[lastAttemptMetric][labels] = float64(startTime.UnixNano()) / 1e9
+		r.values[durationMetric][labels] = result.Duration().Seconds()
+		r.values[uploadedMetric][labels] = float64(result.BytesUploaded())
+		r.values[partsMetric][labels] = float64(result.Parts())
+		r.values[retriesMetric][labels] = retries
+		for _, status := range statuses {
+			value := 0.0
+			if status == result.Status() {
+				value = 1
+			}
+			r.values[statusMetric][statusLabels(result.Name(), status)] = value
+		}
+		if result.Status() == backup.StatusSuccess {
+			r.values[lastSuccessMetric][labels] = float64(endTime.UnixNano()) / 1e9
+		}
+	}
+}
+
+// Writes the metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	buf := bytes.NewBuffer(nil)
+	for _, definition := range definitions {
+		values := r.values[definition.name]
+		if len(values) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(buf, "# HELP %s %s\n", definition.name, definition.help)
+		fmt.Fprintf(buf, "# TYPE %s gauge\n", definition.name)
+
+		labels := make([]string, 0, len(values))
+		for label := range values {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			fmt.Fprintf(buf, "%s{%s} %s\n", definition.name, label, strconv.FormatFloat(values[label], 'f', -1, 64))
+		}
+	}
+
+	return buf.WriteTo(w)
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	if _, err := r.WriteTo(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Writes the metrics to a file atomically, so that node_exporter never reads a partial file.
+func (r *Registry) WriteFile(path string) error {
+	buf := bytes.NewBuffer(nil)
+	if _, err := r.WriteTo(buf); err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(path, buf.Bytes(), 0644)
+}
+
+// Reads the values previously written to a file, so that metrics of tasks that are not run are preserved.
+// A missing file is not an error.
+func (r *Registry) ReadFile(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	values := map[string]map[string]float64{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		start, end, space := strings.IndexByte(text, '{'), strings.LastIndexByte(text, '}'), strings.LastIndexByte(text, ' ')
+		if start == -1 || end < start || space < end {
+			return fmt.Errorf("%s:%d: invalid sample", path, line)
+		}
+		value, err := strconv.ParseFloat(text[space+1:], 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid value: %w", path, line, err)
+		}
+
+		name := text[:start]
+		if _, ok := r.values[name]; !ok {
+			continue
+		} else if values[name] == nil {
+			values[name] = map[string]float64{}
+		}
+		values[name][text[start+1:end]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for name, samples := range values {
+		for labels, value := range samples {
+			r.values[name][labels] = value
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chialab/streamlined-backup/backup"
+)
+
+func newTestResult(t *testing.T, data string) backup.Result {
+	result := backup.Result{}
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+const expectedMetrics = `# HELP streamlined_backup_last_success_timestamp_seconds Time the last successful run of the task completed, in seconds since the epoch.
+# TYPE streamlined_backup_last_success_timestamp_seconds gauge
+streamlined_backup_last_success_timestamp_seconds{task="foo"} 1633716557.5
+# HELP streamlined_backup_last_attempt_timestamp_seconds Time the last run of the task started, in seconds since the epoch.
+# TYPE streamlined_backup_last_attempt_timestamp_seconds gauge
+streamlined_backup_last_attempt_timestamp_seconds{task="bar"} 1633716600
+streamlined_backup_last_attempt_timestamp_seconds{task="foo"} 1633716540
+# HELP streamlined_backup_last_duration_seconds Duration of the last run of the task, in seconds.
+# TYPE streamlined_backup_last_duration_seconds gauge
+streamlined_backup_last_duration_seconds{task="bar"} 0
+streamlined_backup_last_duration_seconds{task="foo"} 17.5
+# HELP streamlined_backup_last_uploaded_bytes Bytes uploaded to the destination by the last run of the task.
+# TYPE streamlined_backup_last_uploaded_bytes gauge
+streamlined_backup_last_uploaded_bytes{task="bar"} 0
+streamlined_backup_last_uploaded_bytes{task="foo"} 10485760
+# HELP streamlined_backup_last_upload_parts Number of parts uploaded by the last run of the task.
+# TYPE streamlined_backup_last_upload_parts gauge
+streamlined_backup_last_upload_parts{task="bar"} 0
+streamlined_backup_last_upload_parts{task="foo"} 2
+# HELP streamlined_backup_status Outcome of the last run of the task: 1 for the current status, 0 for the others.
+# TYPE streamlined_backup_status gauge
+streamlined_backup_status{task="bar",status="failed"} 1
+streamlined_backup_status{task="bar",status="success"} 0
+streamlined_backup_status{task="bar",status="suspicious"} 0
+streamlined_backup_status{task="bar",status="timeout"} 0
+streamlined_backup_status{task="foo",status="failed"} 0
+streamlined_backup_status{task="foo",status="success"} 1
+streamlined_backup_status{task="foo",status="suspicious"} 0
+streamlined_backup_status{task="foo",status="timeout"} 0
+# HELP streamlined_backup_retries Number of consecutive runs of the task that did not succeed before the last one.
+# TYPE streamlined_backup_retries gauge
+streamlined_backup_retries{task="bar"} 1
+streamlined_backup_retries{task="foo"} 0
+`
+
+func newTestRegistry(t *testing.T) *Registry {
+	registry := NewRegistry()
+	registry.now = func() time.Time { return time.Date(2021, 10, 8, 18, 10, 0, 0, time.UTC) }
+
+	registry.Record(
+		newTestResult(t, `{"task": "foo", "status": "success", "start_time": "2021-10-08T18:09:00Z", "end_time": "2021-10-08T18:09:17.5Z", "bytes_uploaded": 10485760, "parts": 2}`),
+		newTestResult(t, `{"task": "bar", "status": "failed", "error": "could not find last run"}`),
+		newTestResult(t, `{"task": "baz", "status": "skipped"}`),
+	)
+	registry.Record(newTestResult(t, `{"task": "bar", "status": "failed", "error": "could not find last run"}`))
+
+	return registry
+}
+
+func TestRegistryWriteTo(t *testing.T) {
+	t.Parallel()
+
+	out := strings.Builder{}
+	if _, err := newTestRegistry(t).WriteTo(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != expectedMetrics {
+		t.Errorf("expected %s, got %s", expectedMetrics, out.String())
+	}
+
+	if _, err := NewRegistry().WriteTo(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if out.String() != expectedMetrics {
+		t.Errorf("expected empty registry to write nothing, got %s", strings.TrimPrefix(out.String(), expectedMetrics))
+	}
+}
+
+func TestRegistryRetries(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	expected := []float64{0, 1, 2, 0, 1, 0}
+	for i, status := range []string{"failed", "timeout", "success", "failed", "success", "success"} {
+		registry.Record(newTestResult(t, `{"task": "foo", "status": "`+status+`"}`))
+		if retries := registry.values[retriesMetric][`task="foo"`]; retries != expected[i] {
+			t.Errorf("run %d: expected %v retries, got %v", i+1, expected[i], retries)
+		}
+	}
+}
+
+func TestRegistryAttempt(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	if attempt := registry.Attempt("foo"); attempt != 1 {
+		t.Errorf("expected attempt 1 before any run, got %d", attempt)
+	}
+
+	expected := []int{2, 3, 1, 2, 1, 1}
+	for i, status := range []string{"failed", "timeout", "success", "suspicious", "success", "success"} {
+		registry.Record(newTestResult(t, `{"task": "foo", "status": "`+status+`"}`))
+		if attempt := registry.Attempt("foo"); attempt != expected[i] {
+			t.Errorf("run %d: expected attempt %d, got %d", i+1, expected[i], attempt)
+		}
+	}
+	if attempt := registry.Attempt("bar"); attempt != 1 {
+		t.Errorf("expected attempt 1 for another task, got %d", attempt)
+	}
+}
+
+func TestRegistryEscapeLabels(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	registry.Record(newTestResult(t, `{"task": "foo \"bar\"\\baz\n", "status": "success"}`))
+
+	out := strings.Builder{}
+	if _, err := registry.WriteTo(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := `streamlined_backup_retries{task="foo \"bar\"\\baz\n"} 0`; !strings.Contains(out.String(), expected) {
+		t.Errorf("expected %s, got %s", expected, out.String())
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(newTestRegistry(t))
+	defer ts.Close()
+
+	response, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != CONTENT_TYPE {
+		t.Errorf("expected %s, got %s", CONTENT_TYPE, contentType)
+	}
+	if string(body) != expectedMetrics {
+		t.Errorf("expected %s, got %s", expectedMetrics, body)
+	}
+}
+
+func TestRegistryFile(t *testing.T) {
+	t.Parallel()
+
+	textfile := path.Join(t.TempDir(), "streamlined_backup.prom")
+	if err := newTestRegistry(t).WriteFile(textfile); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	registry := NewRegistry()
+	if err := registry.ReadFile(textfile); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out := strings.Builder{}
+	if _, err := registry.WriteTo(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if out.String() != expectedMetrics {
+		t.Errorf("expected %s, got %s", expectedMetrics, out.String())
+	}
+
+	// Tasks that are not run keep their values, the others are updated.
+	registry.Record(newTestResult(t, `{"task": "bar", "status": "success", "start_time": "2021-10-09T18:09:00Z", "end_time": "2021-10-09T18:09:01Z"}`))
+	if err := registry.WriteFile(textfile); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`streamlined_backup_last_success_timestamp_seconds{task="bar"} 1633802941`,
+		`streamlined_backup_last_success_timestamp_seconds{task="foo"} 1633716557.5`,
+		`streamlined_backup_retries{task="bar"} 2`,
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("expected %s, got %s", expected, data)
+		}
+	}
+}
+
+func TestRegistryReadFileErrors(t *testing.T) {
+	t.Parallel()
+
+	if err := NewRegistry().ReadFile(path.Join(t.TempDir(), "missing.prom")); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	testCases := map[string]string{
+		"no_labels":     "streamlined_backup_retries 1\n",
+		"invalid_value": "streamlined_backup_retries{task=\"foo\"} one\n",
+	}
+	for name, data := range testCases {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			textfile := path.Join(t.TempDir(), "streamlined_backup.prom")
+			if err := os.WriteFile(textfile, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := NewRegistry().ReadFile(textfile); err == nil {
+				t.Error("expected error, got nil")
+			} else if !strings.HasPrefix(err.Error(), textfile+":1: ") {
+				t.Errorf("expected error to point to the line, got %s", err)
+			}
+		})
+	}
+}
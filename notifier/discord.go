@@ -0,0 +1,140 @@
+package notifier
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Discord limits on embeds, see https://discord.com/developers/docs/resources/channel#embed-object-embed-limits
+const (
+	discordMaxEmbeds       = 10
+	discordMaxEmbedsLength = 6000
+	discordMaxFieldValue   = 1024
+)
+
+type DiscordNotifier struct {
+	webhooks []string
+}
+
+func NewDiscordNotifier(webhooks ...string) *DiscordNotifier {
+	return &DiscordNotifier{webhooks: webhooks}
+}
+
+var discordIcons = map[backup.Status]string{
+	backup.StatusSuccess:    "✅",
+	backup.StatusSuspicious: "⚠️",
+	backup.StatusFailed:     "\U0001f6a8",
+	backup.StatusTimeout:    "⌛",
+}
+
+// Wraps a value in a code block, keeping its end if it exceeds the size of an embed field.
+func discordCodeBlock(value string) string {
+	const fence, ellipsis = "```\n%s\n```", "...\n"
+	if runes, max := []rune(value), discordMaxFieldValue-len(fence)+2; len(runes) > max {
+		value = ellipsis + string(runes[len(runes)-max+len(ellipsis):])
+	}
+
+	return fmt.Sprintf(fence, value)
+}
+
+// Characters of an embed that count towards the total allowed in a message.
+func discordEmbedLength(embed map[string]interface{}) int {
+	length := 0
+	for _, key := range []string{"title", "description"} {
+		if value, ok := embed[key].(string); ok {
+			length += utf8.RuneCountInString(value)
+		}
+	}
+	if fields, ok := embed["fields"].([]map[string]interface{}); ok {
+		for _, field := range fields {
+			for _, key := range []string{"name", "value"} {
+				if value, ok := field[key].(string); ok {
+					length += utf8.RuneCountInString(value)
+				}
+			}
+		}
+	}
+
+	return length
+}
+
+func (n DiscordNotifier) Format(o *backup.Result) map[string]interface{} {
+	formatted := formatResult(o)
+	if formatted == nil {
+		return nil
+	}
+
+	embed := map[string]interface{}{
+		"title": fmt.Sprintf("%s %s", discordIcons[formatted.status], fmt.Sprintf(formatted.headline, formatted.task)),
+		"color": formatted.color,
+	}
+	if len(formatted.fields) > 0 {
+		fields := []map[string]interface{}{}
+		for _, field := range formatted.fields {
+			fields = append(fields, map[string]interface{}{
+				"name":  field.title,
+				"value": discordCodeBlock(field.value),
+			})
+		}
+		embed["fields"] = fields
+	}
+
+	return embed
+}
+
+func (n DiscordNotifier) Notify(results ...backup.Result) error {
+	embeds := []map[string]interface{}{}
+	alert := false
+	for _, result := range results {
+		if embed := n.Format(&result); embed != nil {
+			embeds = append(embeds, embed)
+			alert = alert || formatResult(&result).alert
+		}
+	}
+
+	// Embeds are split in messages that stay within both the number and the total length allowed.
+	messages := [][]map[string]interface{}{}
+	length := 0
+	for _, embed := range embeds {
+		last := len(messages) - 1
+		if last < 0 || len(messages[last]) == discordMaxEmbeds || length+discordEmbedLength(embed) > discordMaxEmbedsLength {
+			messages = append(messages, []map[string]interface{}{})
+			last, length = last+1, 0
+		}
+		messages[last] = append(messages[last], embed)
+		length += discordEmbedLength(embed)
+	}
+
+	var errors *multierror.Error
+	for i, message := range messages {
+		body := map[string]interface{}{"embeds": message}
+		if alert && i == 0 {
+			body["content"] = "@here"
+		}
+		if err := n.Send(body); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
+	return errors.ErrorOrNil()
+}
+
+func (n DiscordNotifier) Error(err error) error {
+	return n.Send(map[string]interface{}{
+		"content": "@here",
+		"embeds": []map[string]interface{}{
+			{
+				"title":       fmt.Sprintf("%s %s", discordIcons[backup.StatusFailed], errorHeadline),
+				"description": discordCodeBlock(fmt.Sprintf("%v", err)),
+				"color":       colorDanger,
+			},
+		},
+	})
+}
+
+func (n DiscordNotifier) Send(body interface{}) error {
+	return postJSON(n.webhooks, body)
+}
@@ -0,0 +1,203 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+)
+
+func TestDiscordFormat(t *testing.T) {
+	t.Parallel()
+
+	task, err := backup.NewTask("foo", config.Task{Command: config.Command{{"echo", "foo bar"}}, Cwd: "/tmp", Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		input    backup.Result
+		expected map[string]interface{}
+	}{
+		"skipped": {
+			input:    backup.NewResultSkipped(nil),
+			expected: nil,
+		},
+		"success": {
+			input: backup.NewResultSuccess(task, []string{}),
+			expected: map[string]interface{}{
+				"title": "✅ Backup task foo completed successfully.",
+				"color": colorGood,
+			},
+		},
+		"failure": {
+			input: backup.NewResultFailed(task, errors.New("test error"), []string{"test log 1", "test log 2"}),
+			expected: map[string]interface{}{
+				"title": "\U0001f6a8 Error running backup task foo!",
+				"color": colorDanger,
+				"fields": []map[string]interface{}{
+					{"name": "Command", "value": "```\necho 'foo bar'\n```"},
+					{"name": "Working directory", "value": "```\n/tmp\n```"},
+					{"name": "Error", "value": "```\ntest error\n```"},
+					{"name": "Log lines (written to stderr)", "value": "```\ntest log 1\ntest log 2\n```"},
+				},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := new(DiscordNotifier).Format(&tc.input); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDiscordCodeBlock(t *testing.T) {
+	t.Parallel()
+
+	if actual := discordCodeBlock("test"); actual != "```\ntest\n```" {
+		t.Errorf("expected short value to be kept, got %s", actual)
+	}
+
+	long := strings.Repeat("è", 2000) + "end"
+	actual := discordCodeBlock(long)
+	if length := len([]rune(actual)); length != discordMaxFieldValue {
+		t.Errorf("expected %d characters, got %d", discordMaxFieldValue, length)
+	}
+	if !strings.HasPrefix(actual, "```\n...\nèè") || !strings.HasSuffix(actual, "èend\n```") {
+		t.Errorf("expected value to be truncated at the beginning, got %s", actual)
+	}
+}
+
+func TestDiscordNotify(t *testing.T) {
+	t.Parallel()
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	many := []backup.Result{backup.NewResultFailed(task, errors.New("test error"), []string{})}
+	for i := 0; i < 11; i++ {
+		many = append(many, backup.NewResultSuccess(task, []string{}))
+	}
+	long := []backup.Result{}
+	for i := 0; i < 5; i++ {
+		long = append(long, backup.NewResultFailed(task, errors.New(strings.Repeat("e", 2000)), []string{strings.Repeat("l", 2000)}))
+	}
+
+	testCases := map[string]struct {
+		results  []backup.Result
+		expected []string
+	}{
+		"empty": {
+			results:  []backup.Result{backup.NewResultSkipped(nil)},
+			expected: []string{},
+		},
+		"success": {
+			results:  []backup.Result{backup.NewResultSkipped(nil), backup.NewResultSuccess(task, []string{})},
+			expected: []string{"1 embeds"},
+		},
+		"alert": {
+			results:  []backup.Result{backup.NewResultSuccess(task, []string{}), backup.NewResultFailed(task, errors.New("test error"), []string{})},
+			expected: []string{"@here 2 embeds"},
+		},
+		"split": {
+			results:  many,
+			expected: []string{"@here 10 embeds", "2 embeds"},
+		},
+		"split_long": {
+			results:  long,
+			expected: []string{"@here 2 embeds", "2 embeds", "1 embeds"},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			mutex := sync.Mutex{}
+			requests := []string{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				var body struct {
+					Content string                   `json:"content"`
+					Embeds  []map[string]interface{} `json:"embeds"`
+				}
+				if data, err := ioutil.ReadAll(r.Body); err != nil {
+					panic(err)
+				} else if err := json.Unmarshal(data, &body); err != nil {
+					panic(err)
+				}
+				length := 0
+				for _, embed := range body.Embeds {
+					length += len([]rune(embed["title"].(string)))
+					if fields, ok := embed["fields"].([]interface{}); ok {
+						for _, field := range fields {
+							field := field.(map[string]interface{})
+							length += len([]rune(field["name"].(string))) + len([]rune(field["value"].(string)))
+						}
+					}
+				}
+				if length > discordMaxEmbedsLength {
+					t.Errorf("expected at most %d characters in embeds, got %d", discordMaxEmbedsLength, length)
+				}
+				requests = append(requests, strings.TrimSpace(fmt.Sprintf("%s %d embeds", body.Content, len(body.Embeds))))
+
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer ts.Close()
+
+			if err := NewDiscordNotifier(ts.URL).Notify(tc.results...); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(requests, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, requests)
+			}
+		})
+	}
+}
+
+func TestDiscordError(t *testing.T) {
+	t.Parallel()
+
+	expectedBody := `{"content":"@here","embeds":[{"color":10682880,"description":"` + "```\\ntest error\\n```" + `","title":"🚨 Error running backup task!"}]}` + "\n"
+
+	requests := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, err := ioutil.ReadAll(r.Body); err != nil {
+			panic(err)
+		} else {
+			requests = append(requests, string(body))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	if err := NewDiscordNotifier(ts.URL).Error(errors.New("test error")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	if requests[0] != expectedBody {
+		t.Errorf("expected body %s, got %s", expectedBody, requests[0])
+	}
+}
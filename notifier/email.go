@@ -0,0 +1,460 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/utils"
+)
+
+type EmailSecurity string
+
+const (
+	EmailSecurityNone     EmailSecurity = "none"
+	EmailSecurityStartTLS EmailSecurity = "starttls"
+	EmailSecurityTLS      EmailSecurity = "tls"
+)
+
+type EmailAuth string
+
+const (
+	EmailAuthNone  EmailAuth = ""
+	EmailAuthPlain EmailAuth = "plain"
+	EmailAuthLogin EmailAuth = "login"
+)
+
+var ErrUnsupportedEmailOption = errors.New("unsupported email option")
+
+const emailDialTimeout = 30 * time.Second
+
+// Maximum duration of the whole SMTP exchange, so that a server stalling after accepting the connection
+// cannot block notifications forever.
+const emailTimeout = 2 * time.Minute
+
+type EmailOptions struct {
+	Host string
+	// Defaults to 587 for STARTTLS, 465 for implicit TLS, and 25 otherwise.
+	Port     int
+	Security EmailSecurity
+	Auth     EmailAuth
+	Username string
+	Password string
+	From     string
+	To       []string
+	// Used to verify the server certificate. If nil, system roots are used.
+	TLSConfig *tls.Config
+}
+
+type EmailNotifier struct {
+	addr      string
+	host      string
+	security  EmailSecurity
+	auth      smtp.Auth
+	from      string
+	to        []string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+}
+
+func NewEmailNotifier(options EmailOptions) (*EmailNotifier, error) {
+	port := options.Port
+	switch options.Security {
+	case EmailSecurityStartTLS:
+		if port == 0 {
+			port = 587
+		}
+	case EmailSecurityTLS:
+		if port == 0 {
+			port = 465
+		}
+	case EmailSecurityNone, "":
+		if port == 0 {
+			port = 25
+		}
+	default:
+		return nil, fmt.Errorf("%w: security %q", ErrUnsupportedEmailOption, options.Security)
+	}
+
+	var auth smtp.Auth
+	switch options.Auth {
+	case EmailAuthPlain:
+		auth = smtp.PlainAuth("", options.Username, options.Password, options.Host)
+	case EmailAuthLogin:
+		auth = &loginAuth{username: options.Username, password: options.Password, host: options.Host}
+	case EmailAuthNone:
+	default:
+		return nil, fmt.Errorf("%w: auth %q", ErrUnsupportedEmailOption, options.Auth)
+	}
+
+	tlsConfig := &tls.Config{}
+	if options.TLSConfig != nil {
+		tlsConfig = options.TLSConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = options.Host
+	}
+
+	return &EmailNotifier{
+		addr:      net.JoinHostPort(options.Host, strconv.Itoa(port)),
+		host:      options.Host,
+		security:  options.Security,
+		auth:      auth,
+		from:      options.From,
+		to:        options.To,
+		tlsConfig: tlsConfig,
+		timeout:   emailTimeout,
+	}, nil
+}
+
+// SMTP LOGIN authentication, which is not implemented by net/smtp. Like PLAIN, credentials are only sent
+// over TLS or to localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	isLocalhost := server.Name == "localhost" || server.Name == "127.0.0.1" || server.Name == "::1"
+	if !server.TLS && !isLocalhost {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
+
+type emailSummary struct {
+	Headline string
+	Results  []emailResult
+}
+
+type emailResult struct {
+	Name        string
+	Status      backup.Status
+	Command     string
+	Error       string
+	Duration    time.Duration
+	Uploaded    string
+	Destination string
+	Attachment  string
+}
+
+const emailTextTemplate = `{{ .Headline }}
+{{ range .Results }}
+[{{ .Status }}] {{ .Name }}
+    Duration: {{ .Duration }}
+{{- if .Destination }}
+    Uploaded: {{ .Uploaded }} to {{ .Destination }}
+{{- end }}
+{{- if .Error }}
+    Command: {{ .Command }}
+    Error: {{ .Error }}
+{{- end }}
+{{- if .Attachment }}
+    Full logs are attached as {{ .Attachment }}.
+{{- end }}
+{{ end }}`
+
+const emailHTMLTemplate = `<!DOCTYPE html>
+<html>
+<body>
+<p>{{ .Headline }}</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Task</th><th>Status</th><th>Duration</th><th>Uploaded</th><th>Details</th></tr>
+{{- range .Results }}
+<tr>
+<td><code>{{ .Name }}</code></td>
+<td>{{ .Status }}</td>
+<td>{{ .Duration }}</td>
+<td>{{ if .Destination }}{{ .Uploaded }} to <code>{{ .Destination }}</code>{{ end }}</td>
+<td>
+{{- if .Error }}<pre>{{ .Command }}</pre><pre>{{ .Error }}</pre>{{ end }}
+{{- if .Attachment }}Full logs are attached as <code>{{ .Attachment }}</code>.{{ end -}}
+</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`
+
+var (
+	emailText = template.Must(template.New("text").Parse(emailTextTemplate))
+	emailHTML = htmltemplate.Must(htmltemplate.New("html").Parse(emailHTMLTemplate))
+)
+
+var attachmentNameReplacer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+var emailStatusLabels = []struct {
+	status backup.Status
+	label  string
+}{
+	{backup.StatusTimeout, "timed out"},
+	{backup.StatusFailed, "failed"},
+	{backup.StatusSuspicious, "suspicious"},
+	{backup.StatusSuccess, "succeeded"},
+}
+
+// Counts results by status, from the most severe, e.g. `1 failed, 2 succeeded`.
+func summarizeStatuses(results backup.Results) string {
+	counts := map[backup.Status]int{}
+	for _, result := range results {
+		counts[result.Status()]++
+	}
+
+	summary := []string{}
+	for _, status := range emailStatusLabels {
+		if count := counts[status.status]; count > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", count, status.label))
+		}
+	}
+
+	return strings.Join(summary, ", ")
+}
+
+func (n EmailNotifier) Notify(results ...backup.Result) error {
+	notified := backup.Results{}
+	for _, result := range results {
+		if result.Status() != backup.StatusSkipped {
+			notified = append(notified, result)
+		}
+	}
+	if len(notified) == 0 {
+		return nil
+	}
+	sort.Sort(notified)
+
+	summary := emailSummary{Headline: fmt.Sprintf("Backup tasks completed: %s.", summarizeStatuses(notified))}
+	attachments := map[string][]byte{}
+	for _, result := range notified {
+		item := emailResult{
+			Name:        result.Name(),
+			Status:      result.Status(),
+			Duration:    result.Duration(),
+			Uploaded:    utils.FormatBytes(result.BytesUploaded()),
+			Destination: result.Destination(),
+		}
+		if result.Status() != backup.StatusSuccess {
+			item.Command = result.Command()
+			if err := result.Error(); err != nil {
+				item.Error = strings.TrimSpace(err.Error())
+			}
+		}
+		if result.Status() == backup.StatusFailed || result.Status() == backup.StatusTimeout {
+			item.Attachment = attachmentNameReplacer.ReplaceAllString(result.Name(), "_") + ".log"
+			attachments[item.Attachment] = []byte(strings.Join(result.Logs(), "\n"))
+		}
+		summary.Results = append(summary.Results, item)
+	}
+
+	message, err := n.message(fmt.Sprintf("Backup report: %s", summarizeStatuses(notified)), summary, attachments)
+	if err != nil {
+		return err
+	}
+
+	return n.Send(message)
+}
+
+func (n EmailNotifier) Error(err error) error {
+	summary := emailSummary{Headline: fmt.Sprintf("Error running backup task: %v", err)}
+	message, msgErr := n.message("Backup error", summary, nil)
+	if msgErr != nil {
+		return msgErr
+	}
+
+	return n.Send(message)
+}
+
+// Builds a MIME message with plain text and HTML alternatives, followed by the attachments.
+func (n EmailNotifier) message(subject string, summary emailSummary, attachments map[string][]byte) ([]byte, error) {
+	alternative := bytes.NewBuffer(nil)
+	alternativeWriter := multipart.NewWriter(alternative)
+
+	text := bytes.NewBuffer(nil)
+	if err := emailText.Execute(text, summary); err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintablePart(alternativeWriter, "text/plain; charset=utf-8", text.Bytes()); err != nil {
+		return nil, err
+	}
+
+	html := bytes.NewBuffer(nil)
+	if err := emailHTML.Execute(html, summary); err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintablePart(alternativeWriter, "text/html; charset=utf-8", html.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := alternativeWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	message := bytes.NewBuffer(nil)
+	mixedWriter := multipart.NewWriter(message)
+	headers := []string{
+		"From: " + n.from,
+		"To: " + strings.Join(n.to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: " + mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixedWriter.Boundary()}),
+	}
+	message.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	part, err := mixedWriter.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternativeWriter.Boundary()})},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(alternative.Bytes()); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(attachments))
+	for name := range attachments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		part, err := mixedWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType("text/plain", map[string]string{"charset": "utf-8", "name": name})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoded := base64.StdEncoding.EncodeToString(attachments[name])
+		for len(encoded) > 76 {
+			if _, err := part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+				return nil, err
+			}
+			encoded = encoded[76:]
+		}
+		if _, err := part.Write([]byte(encoded + "\r\n")); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixedWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return message.Bytes(), nil
+}
+
+func writeQuotedPrintablePart(writer *multipart.Writer, contentType string, body []byte) error {
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := quotedprintable.NewWriter(part)
+	if _, err := encoder.Write(body); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+func (n EmailNotifier) Send(message []byte) error {
+	dialer := &net.Dialer{Timeout: emailDialTimeout}
+	var conn net.Conn
+	var err error
+	if n.security == EmailSecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", n.addr, n.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", n.addr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(n.timeout)); err != nil {
+		conn.Close()
+
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+
+		return err
+	}
+	defer client.Close()
+
+	if n.security == EmailSecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", n.addr)
+		}
+		if err := client.StartTLS(n.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := client.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
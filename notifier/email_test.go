@@ -0,0 +1,467 @@
+package notifier
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+)
+
+type fakeSMTPMessage struct {
+	tls  bool
+	auth []string
+	from string
+	to   []string
+	data string
+}
+
+// Minimal SMTP server, accepting any credentials and storing received messages.
+type fakeSMTPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	startTLS  bool
+	mutex     sync.Mutex
+	messages  []fakeSMTPMessage
+}
+
+func newFakeSMTPServer(t *testing.T, security EmailSecurity) (*fakeSMTPServer, *tls.Config) {
+	// Borrow the certificate of a TLS test server, which is valid for 127.0.0.1.
+	ts := httptest.NewTLSServer(nil)
+	ts.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	var listener net.Listener
+	var err error
+	if security == EmailSecurityTLS {
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", ts.TLS)
+	} else {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeSMTPServer{listener: listener, tlsConfig: ts.TLS, startTLS: security == EmailSecurityStartTLS}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, security == EmailSecurityTLS)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+
+	return server, &tls.Config{RootCAs: roots}
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) received() []fakeSMTPMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.messages
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn, secure bool) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	message := fakeSMTPMessage{tls: secure}
+	reply := func(lines ...string) {
+		for _, line := range lines {
+			if err := text.PrintfLine("%s", line); err != nil {
+				panic(err)
+			}
+		}
+	}
+	readAuth := func(challenge string) string {
+		reply("334 " + base64.StdEncoding.EncodeToString([]byte(challenge)))
+		line, _ := text.ReadLine()
+		decoded, _ := base64.StdEncoding.DecodeString(line)
+
+		return string(decoded)
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		argument := strings.TrimSpace(strings.TrimPrefix(line, strings.SplitN(line, " ", 2)[0]))
+
+		switch command {
+		case "EHLO", "HELO":
+			if s.startTLS && !message.tls {
+				reply("250-localhost", "250-STARTTLS", "250 AUTH PLAIN LOGIN")
+			} else {
+				reply("250-localhost", "250 AUTH PLAIN LOGIN")
+			}
+		case "STARTTLS":
+			reply("220 Ready to start TLS")
+			secureConn := tls.Server(conn, s.tlsConfig)
+			if err := secureConn.Handshake(); err != nil {
+				return
+			}
+			conn = secureConn
+			text = textproto.NewConn(conn)
+			message.tls = true
+		case "AUTH":
+			fields := strings.Fields(argument)
+			switch strings.ToUpper(fields[0]) {
+			case "PLAIN":
+				decoded, _ := base64.StdEncoding.DecodeString(fields[1])
+				message.auth = append([]string{"PLAIN"}, strings.Split(string(decoded), "\x00")[1:]...)
+			case "LOGIN":
+				message.auth = []string{"LOGIN", readAuth("Username:"), readAuth("Password:")}
+			}
+			reply("235 Authentication successful")
+		case "MAIL":
+			message.from = strings.Trim(strings.TrimPrefix(strings.Fields(argument)[0], "FROM:"), "<>")
+			reply("250 OK")
+		case "RCPT":
+			message.to = append(message.to, strings.Trim(strings.TrimPrefix(argument, "TO:"), "<>"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data, err := ioutil.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			message.data = string(data)
+			s.mutex.Lock()
+			s.messages = append(s.messages, message)
+			s.mutex.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+type emailPart struct {
+	contentType string
+	filename    string
+	body        string
+}
+
+// Flattens the parts of a multipart message.
+func readEmailParts(t *testing.T, contentType string, body io.Reader) []emailPart {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return []emailPart{{contentType: mediaType, body: string(data)}}
+	}
+
+	parts := []emailPart{}
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		var partBody io.Reader = part
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			partBody = base64.NewDecoder(base64.StdEncoding, part)
+		}
+		for _, nested := range readEmailParts(t, part.Header.Get("Content-Type"), partBody) {
+			if nested.filename == "" {
+				nested.filename = part.FileName()
+			}
+			parts = append(parts, nested)
+		}
+	}
+
+	return parts
+}
+
+func TestEmailNotify(t *testing.T) {
+	t.Parallel()
+
+	taskFoo, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskBar, err := backup.NewTask("bar <db>", config.Task{Command: config.Command{{"echo", "foo bar"}}, Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []backup.Result{
+		backup.NewResultSkipped(nil),
+		backup.NewResultFailed(taskBar, errors.New("test error"), []string{"test log 1", "test log 2"}),
+		backup.NewResultSuccess(taskFoo, []string{}),
+	}
+
+	testCases := map[string]struct {
+		security EmailSecurity
+		auth     EmailAuth
+		expected []string
+	}{
+		"plain": {
+			security: EmailSecurityNone,
+			auth:     EmailAuthNone,
+			expected: nil,
+		},
+		"starttls_login": {
+			security: EmailSecurityStartTLS,
+			auth:     EmailAuthLogin,
+			expected: []string{"LOGIN", "user", "s3cr3t"},
+		},
+		"tls_plain": {
+			security: EmailSecurityTLS,
+			auth:     EmailAuthPlain,
+			expected: []string{"PLAIN", "user", "s3cr3t"},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server, tlsConfig := newFakeSMTPServer(t, tc.security)
+			notifier, err := NewEmailNotifier(EmailOptions{
+				Host:      "127.0.0.1",
+				Port:      server.port(),
+				Security:  tc.security,
+				Auth:      tc.auth,
+				Username:  "user",
+				Password:  "s3cr3t",
+				From:      "backup@example.com",
+				To:        []string{"ops@example.com", "admin@example.com"},
+				TLSConfig: tlsConfig,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := notifier.Notify(results...); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			messages := server.received()
+			if len(messages) != 1 {
+				t.Fatalf("expected 1 message, got %d", len(messages))
+			}
+			message := messages[0]
+			if message.tls != (tc.security != EmailSecurityNone) {
+				t.Errorf("expected TLS to be %t, got %t", tc.security != EmailSecurityNone, message.tls)
+			}
+			if !reflect.DeepEqual(message.auth, tc.expected) {
+				t.Errorf("expected auth %v, got %v", tc.expected, message.auth)
+			}
+			if message.from != "backup@example.com" {
+				t.Errorf("expected from backup@example.com, got %s", message.from)
+			}
+			if expected := []string{"ops@example.com", "admin@example.com"}; !reflect.DeepEqual(message.to, expected) {
+				t.Errorf("expected recipients %v, got %v", expected, message.to)
+			}
+
+			parsed, err := mail.ReadMessage(strings.NewReader(message.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subject := parsed.Header.Get("Subject"); subject != "Backup report: 1 failed, 1 succeeded" {
+				t.Errorf("expected subject %q, got %q", "Backup report: 1 failed, 1 succeeded", subject)
+			}
+
+			parts := readEmailParts(t, parsed.Header.Get("Content-Type"), parsed.Body)
+			if len(parts) != 3 {
+				t.Fatalf("expected 3 parts, got %d", len(parts))
+			}
+			if parts[0].contentType != "text/plain" || !strings.Contains(parts[0].body, "[failed] bar <db>\n    Duration: 0s\n    Command: echo 'foo bar'\n    Error: test error\n    Full logs are attached as bar_db_.log.") {
+				t.Errorf("unexpected plain text part %s: %s", parts[0].contentType, parts[0].body)
+			}
+			if !strings.Contains(parts[0].body, "[success] foo\n") {
+				t.Errorf("expected plain text part to list foo, got %s", parts[0].body)
+			}
+			if parts[1].contentType != "text/html" || !strings.Contains(parts[1].body, "<code>bar &lt;db&gt;</code>") {
+				t.Errorf("unexpected HTML part %s: %s", parts[1].contentType, parts[1].body)
+			}
+			if parts[2].filename != "bar_db_.log" || parts[2].body != "test log 1\ntest log 2" {
+				t.Errorf("unexpected attachment %s: %s", parts[2].filename, parts[2].body)
+			}
+		})
+	}
+}
+
+func TestEmailNotifyEmpty(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newFakeSMTPServer(t, EmailSecurityNone)
+	notifier, err := NewEmailNotifier(EmailOptions{Host: "127.0.0.1", Port: server.port(), From: "backup@example.com", To: []string{"ops@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := notifier.Notify(backup.NewResultSkipped(nil)); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if messages := server.received(); len(messages) != 0 {
+		t.Errorf("expected 0 messages, got %d", len(messages))
+	}
+}
+
+func TestEmailError(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newFakeSMTPServer(t, EmailSecurityNone)
+	notifier, err := NewEmailNotifier(EmailOptions{Host: "127.0.0.1", Port: server.port(), From: "backup@example.com", To: []string{"ops@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := notifier.Error(errors.New("test error")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(messages[0].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := readEmailParts(t, parsed.Header.Get("Content-Type"), parsed.Body)
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+	if !strings.HasPrefix(parts[0].body, "Error running backup task: test error\n") {
+		t.Errorf("unexpected plain text part: %s", parts[0].body)
+	}
+}
+
+func TestEmailSendError(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newFakeSMTPServer(t, EmailSecurityNone)
+	testCases := map[string]struct {
+		options  EmailOptions
+		expected string
+	}{
+		"starttls_unsupported": {
+			options:  EmailOptions{Security: EmailSecurityStartTLS},
+			expected: "does not support STARTTLS",
+		},
+		"login_unencrypted": {
+			options:  EmailOptions{Host: "localhost.localdomain", Auth: EmailAuthLogin},
+			expected: "unencrypted connection",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.options.Port = server.port()
+			tc.options.From = "backup@example.com"
+			tc.options.To = []string{"ops@example.com"}
+			if tc.options.Host == "" {
+				tc.options.Host = "127.0.0.1"
+			}
+			notifier, err := NewEmailNotifier(tc.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.options.Host != "127.0.0.1" {
+				notifier.addr = server.listener.Addr().String()
+			}
+
+			if err := notifier.Error(errors.New("test error")); err == nil {
+				t.Error("expected error, got nil")
+			} else if !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestEmailSendTimeout(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		// Accept connections without ever sending the greeting.
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	notifier, err := NewEmailNotifier(EmailOptions{Host: "127.0.0.1", From: "backup@example.com", To: []string{"ops@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier.addr = listener.Addr().String()
+	notifier.timeout = 50 * time.Millisecond
+
+	if err := notifier.Error(errors.New("test error")); err == nil {
+		t.Error("expected error, got nil")
+	} else if !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
+func TestNewEmailNotifierError(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]EmailOptions{
+		"security": {Host: "127.0.0.1", Security: "ssl"},
+		"auth":     {Host: "127.0.0.1", Auth: "cram-md5"},
+	}
+
+	for name, options := range testCases {
+		options := options
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := NewEmailNotifier(options); !errors.Is(err, ErrUnsupportedEmailOption) {
+				t.Errorf("expected %v, got %v", ErrUnsupportedEmailOption, err)
+			}
+		})
+	}
+}
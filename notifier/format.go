@@ -0,0 +1,105 @@
+package notifier
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chialab/streamlined-backup/backup"
+)
+
+const errorHeadline = "Error running backup task!"
+
+const (
+	colorGood    = 0x2eb886
+	colorWarning = 0xdaa038
+	colorDanger  = 0xa30200
+)
+
+// Result details shared by chat notifiers, so that all of them show the same fields.
+type formattedResult struct {
+	status backup.Status
+	task   string
+	// Format string with a single verb for the task name, so that each notifier can apply its own markup.
+	headline string
+	// Whether the channel should be alerted.
+	alert  bool
+	color  int
+	fields []formattedField
+}
+
+type formattedField struct {
+	title string
+	value string
+}
+
+// Returns nil for results that should not be notified.
+func formatResult(o *backup.Result) *formattedResult {
+	switch o.Status() {
+	case backup.StatusSuccess:
+		return &formattedResult{
+			status:   o.Status(),
+			task:     o.Name(),
+			headline: "Backup task %s completed successfully.",
+			color:    colorGood,
+		}
+
+	case backup.StatusSuspicious:
+		artifact := o.Destination()
+		if artifact == "" {
+			artifact = "Not stored."
+		}
+
+		return &formattedResult{
+			status:   o.Status(),
+			task:     o.Name(),
+			headline: "Backup task %s produced a suspicious artifact!",
+			alert:    true,
+			color:    colorWarning,
+			fields: []formattedField{
+				{title: "Reason", value: strings.TrimSpace(o.Error().Error())},
+				{title: "Artifact", value: artifact},
+			},
+		}
+
+	case backup.StatusFailed, backup.StatusTimeout:
+		headline := "Error running backup task %s!"
+		if o.Status() == backup.StatusTimeout {
+			headline = "Backup task %s timed out!"
+		}
+
+		errorMessage := "No error available."
+		if err := o.Error(); err != nil {
+			errorMessage = strings.TrimSpace(err.Error())
+		}
+
+		return &formattedResult{
+			status:   o.Status(),
+			task:     o.Name(),
+			headline: headline,
+			alert:    true,
+			color:    colorDanger,
+			fields: []formattedField{
+				{title: "Command", value: o.Command()},
+				{title: "Working directory", value: o.ActualCwd()},
+				{title: "Error", value: errorMessage},
+				{title: "Log lines (written to stderr)", value: strings.TrimSpace(strings.Join(truncateLogs(o.Logs()), "\n"))},
+			},
+		}
+	}
+
+	return nil
+}
+
+// Keeps the first and last lines of long logs.
+func truncateLogs(logs []string) []string {
+	if len(logs) == 0 {
+		return []string{"No logs available."}
+	} else if len(logs) > 13 {
+		truncated := append([]string{}, logs[:5]...)
+		truncated = append(truncated, fmt.Sprintf("... %d lines omitted ...", len(logs)-10))
+
+		return append(truncated, logs[len(logs)-5:]...)
+	}
+
+	return logs
+}
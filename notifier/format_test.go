@@ -0,0 +1,128 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+)
+
+func TestTruncateLogs(t *testing.T) {
+	t.Parallel()
+
+	long := []string{}
+	for i := 1; i <= 20; i++ {
+		long = append(long, fmt.Sprintf("line %d", i))
+	}
+
+	testCases := map[string]struct {
+		input    []string
+		expected []string
+	}{
+		"empty": {
+			input:    []string{},
+			expected: []string{"No logs available."},
+		},
+		"short": {
+			input:    long[:13],
+			expected: long[:13],
+		},
+		"long": {
+			input: long,
+			expected: []string{
+				"line 1", "line 2", "line 3", "line 4", "line 5",
+				"... 10 lines omitted ...",
+				"line 16", "line 17", "line 18", "line 19", "line 20",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			input := append([]string{}, tc.input...)
+			if actual := truncateLogs(input); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+			if !reflect.DeepEqual(input, tc.input) {
+				t.Errorf("expected input to be unchanged, got %v", input)
+			}
+		})
+	}
+}
+
+func TestFormatResult(t *testing.T) {
+	t.Parallel()
+
+	task, err := backup.NewTask("foo", config.Task{Command: config.Command{{"echo", "foo bar"}}, Cwd: "/tmp", Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		input    backup.Result
+		expected *formattedResult
+	}{
+		"skipped": {
+			input:    backup.NewResultSkipped(task),
+			expected: nil,
+		},
+		"success": {
+			input: backup.NewResultSuccess(task, []string{}),
+			expected: &formattedResult{
+				status:   backup.StatusSuccess,
+				task:     "foo",
+				headline: "Backup task %s completed successfully.",
+				color:    colorGood,
+			},
+		},
+		"timeout": {
+			input: backup.NewResultTimeout(task, []string{"test log"}),
+			expected: &formattedResult{
+				status:   backup.StatusTimeout,
+				task:     "foo",
+				headline: "Backup task %s timed out!",
+				alert:    true,
+				color:    colorDanger,
+				fields: []formattedField{
+					{title: "Command", value: "echo 'foo bar'"},
+					{title: "Working directory", value: "/tmp"},
+					{title: "Error", value: "No error available."},
+					{title: "Log lines (written to stderr)", value: "test log"},
+				},
+			},
+		},
+		"failed": {
+			input: backup.NewResultFailed(task, errors.New("test error\n"), []string{}),
+			expected: &formattedResult{
+				status:   backup.StatusFailed,
+				task:     "foo",
+				headline: "Error running backup task %s!",
+				alert:    true,
+				color:    colorDanger,
+				fields: []formattedField{
+					{title: "Command", value: "echo 'foo bar'"},
+					{title: "Working directory", value: "/tmp"},
+					{title: "Error", value: "test error"},
+					{title: "Log lines (written to stderr)", value: "No logs available."},
+				},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := formatResult(&tc.input); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
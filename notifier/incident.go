@@ -0,0 +1,225 @@
+package notifier
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/hashicorp/go-multierror"
+)
+
+type IncidentProvider string
+
+const (
+	PagerDutyProvider IncidentProvider = "pagerduty"
+	OpsgenieProvider  IncidentProvider = "opsgenie"
+)
+
+const (
+	DEFAULT_PAGERDUTY_URL = "https://events.pagerduty.com"
+	DEFAULT_OPSGENIE_URL  = "https://api.opsgenie.com"
+)
+
+const incidentKeyPrefix = "streamlined-backup/"
+
+var ErrUnknownIncidentProvider = errors.New("unknown incident provider")
+
+type IncidentOptions struct {
+	Provider IncidentProvider
+	// PagerDuty integration routing key, or Opsgenie API key.
+	Key string
+	// Base URL of the API, such as `https://api.eu.opsgenie.com`. Defaults to the provider's public API.
+	URL string
+	// Name of the machine running the backups. Defaults to the host name.
+	Source string
+}
+
+type incidentAlert struct {
+	key     string
+	summary string
+	fields  []formattedField
+}
+
+func (a incidentAlert) details() map[string]string {
+	details := map[string]string{}
+	for _, field := range a.fields {
+		details[field.title] = field.value
+	}
+
+	return details
+}
+
+type incidentClient interface {
+	trigger(alert incidentAlert) error
+	resolve(key string, note string) error
+}
+
+// Opens an alert when a task fails or times out, and resolves it when the same task succeeds. Alerts are
+// deduplicated by task name, so that a task failing repeatedly only pages once.
+type IncidentNotifier struct {
+	client incidentClient
+}
+
+func NewIncidentNotifier(options IncidentOptions) (*IncidentNotifier, error) {
+	source := options.Source
+	if source == "" {
+		if hostname, err := os.Hostname(); err == nil {
+			source = hostname
+		} else {
+			source = "streamlined-backup"
+		}
+	}
+
+	baseUrl := strings.TrimSuffix(options.URL, "/")
+	switch options.Provider {
+	case PagerDutyProvider:
+		if baseUrl == "" {
+			baseUrl = DEFAULT_PAGERDUTY_URL
+		}
+
+		return &IncidentNotifier{client: pagerDutyClient{url: baseUrl, routingKey: options.Key, source: source}}, nil
+
+	case OpsgenieProvider:
+		if baseUrl == "" {
+			baseUrl = DEFAULT_OPSGENIE_URL
+		}
+
+		return &IncidentNotifier{client: opsgenieClient{url: baseUrl, apiKey: options.Key, source: source}}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownIncidentProvider, options.Provider)
+}
+
+func (n IncidentNotifier) Notify(results ...backup.Result) error {
+	var errors *multierror.Error
+	for _, result := range results {
+		key := incidentKeyPrefix + result.Name()
+
+		switch result.Status() {
+		case backup.StatusFailed, backup.StatusTimeout:
+			formatted := formatResult(&result)
+			alert := incidentAlert{
+				key:     key,
+				summary: fmt.Sprintf(formatted.headline, formatted.task),
+				fields:  formatted.fields,
+			}
+			if err := n.client.trigger(alert); err != nil {
+				errors = multierror.Append(errors, err)
+			}
+
+		case backup.StatusSuccess:
+			// Resolving an alert that is not open is a no-op for both providers.
+			note := fmt.Sprintf(formatResult(&result).headline, result.Name())
+			if err := n.client.resolve(key, note); err != nil {
+				errors = multierror.Append(errors, err)
+			}
+		}
+	}
+
+	return errors.ErrorOrNil()
+}
+
+func (n IncidentNotifier) Error(err error) error {
+	return n.client.trigger(incidentAlert{
+		key:     incidentKeyPrefix + "error",
+		summary: errorHeadline,
+		fields:  []formattedField{{title: "Error", value: fmt.Sprintf("%v", err)}},
+	})
+}
+
+func postIncident(endpoint string, body interface{}, header http.Header) error {
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(MustToJSON(body)))
+	if err != nil {
+		return err
+	}
+	request.Header = header
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("error sending notification to %s: %s", endpoint, response.Status)
+	}
+
+	return nil
+}
+
+// Client for PagerDuty Events API v2.
+type pagerDutyClient struct {
+	url        string
+	routingKey string
+	source     string
+}
+
+func (c pagerDutyClient) trigger(alert incidentAlert) error {
+	return postIncident(c.url+"/v2/enqueue", map[string]interface{}{
+		"routing_key":  c.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    alert.key,
+		"payload": map[string]interface{}{
+			"summary":        alert.summary,
+			"source":         c.source,
+			"severity":       "error",
+			"component":      "streamlined-backup",
+			"custom_details": alert.details(),
+		},
+	}, http.Header{})
+}
+
+func (c pagerDutyClient) resolve(key string, note string) error {
+	return postIncident(c.url+"/v2/enqueue", map[string]interface{}{
+		"routing_key":  c.routingKey,
+		"event_action": "resolve",
+		"dedup_key":    key,
+	}, http.Header{})
+}
+
+// Client for Opsgenie Alert API, using the dedup key as alert alias.
+type opsgenieClient struct {
+	url    string
+	apiKey string
+	source string
+}
+
+const opsgenieMaxMessage = 130
+
+func (c opsgenieClient) header() http.Header {
+	return http.Header{"Authorization": {"GenieKey " + c.apiKey}}
+}
+
+func (c opsgenieClient) trigger(alert incidentAlert) error {
+	message := []rune(alert.summary)
+	if len(message) > opsgenieMaxMessage {
+		message = append(message[:opsgenieMaxMessage-3], []rune("...")...)
+	}
+
+	description := []string{}
+	for _, field := range alert.fields {
+		description = append(description, fmt.Sprintf("%s:\n%s", field.title, field.value))
+	}
+
+	return postIncident(c.url+"/v2/alerts", map[string]interface{}{
+		"message":     string(message),
+		"alias":       alert.key,
+		"description": strings.Join(description, "\n\n"),
+		"details":     alert.details(),
+		"source":      c.source,
+		"tags":        []string{"streamlined-backup"},
+	}, c.header())
+}
+
+func (c opsgenieClient) resolve(key string, note string) error {
+	return postIncident(fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", c.url, url.PathEscape(key)), map[string]interface{}{
+		"source": c.source,
+		"note":   note,
+	}, c.header())
+}
@@ -0,0 +1,270 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+	"github.com/hashicorp/go-multierror"
+)
+
+type incidentRequest struct {
+	path          string
+	authorization string
+	body          map[string]interface{}
+}
+
+func TestIncidentNotify(t *testing.T) {
+	t.Parallel()
+
+	newTask := func(name string) *backup.Task {
+		task, err := backup.NewTask(name, config.Task{Command: config.Command{{"echo", "foo bar"}}, Cwd: "/tmp", Destination: config.Destination{Type: config.S3Destination}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return task
+	}
+	results := []backup.Result{
+		backup.NewResultSkipped(newTask("skipped")),
+		backup.NewResultFailed(newTask("foo"), errors.New("test error"), []string{"test log"}),
+		backup.NewResultSuccess(newTask("bar"), []string{}),
+		backup.NewResultSuspicious(newTask("baz"), errors.New("too small"), []string{}),
+		backup.NewResultTimeout(newTask("qux"), []string{}),
+	}
+	fooDetails := map[string]interface{}{
+		"Command":                       "echo 'foo bar'",
+		"Working directory":             "/tmp",
+		"Error":                         "test error",
+		"Log lines (written to stderr)": "test log",
+	}
+	quxDetails := map[string]interface{}{
+		"Command":                       "echo 'foo bar'",
+		"Working directory":             "/tmp",
+		"Error":                         "No error available.",
+		"Log lines (written to stderr)": "No logs available.",
+	}
+
+	testCases := map[string]struct {
+		provider IncidentProvider
+		expected []incidentRequest
+	}{
+		"pagerduty": {
+			provider: PagerDutyProvider,
+			expected: []incidentRequest{
+				{
+					path: "/v2/enqueue",
+					body: map[string]interface{}{
+						"routing_key":  "test-key",
+						"event_action": "trigger",
+						"dedup_key":    "streamlined-backup/foo",
+						"payload": map[string]interface{}{
+							"summary":        "Error running backup task foo!",
+							"source":         "test-host",
+							"severity":       "error",
+							"component":      "streamlined-backup",
+							"custom_details": fooDetails,
+						},
+					},
+				},
+				{
+					path: "/v2/enqueue",
+					body: map[string]interface{}{
+						"routing_key":  "test-key",
+						"event_action": "resolve",
+						"dedup_key":    "streamlined-backup/bar",
+					},
+				},
+				{
+					path: "/v2/enqueue",
+					body: map[string]interface{}{
+						"routing_key":  "test-key",
+						"event_action": "trigger",
+						"dedup_key":    "streamlined-backup/qux",
+						"payload": map[string]interface{}{
+							"summary":        "Backup task qux timed out!",
+							"source":         "test-host",
+							"severity":       "error",
+							"component":      "streamlined-backup",
+							"custom_details": quxDetails,
+						},
+					},
+				},
+			},
+		},
+		"opsgenie": {
+			provider: OpsgenieProvider,
+			expected: []incidentRequest{
+				{
+					path:          "/v2/alerts",
+					authorization: "GenieKey test-key",
+					body: map[string]interface{}{
+						"message":     "Error running backup task foo!",
+						"alias":       "streamlined-backup/foo",
+						"description": "Command:\necho 'foo bar'\n\nWorking directory:\n/tmp\n\nError:\ntest error\n\nLog lines (written to stderr):\ntest log",
+						"details":     fooDetails,
+						"source":      "test-host",
+						"tags":        []interface{}{"streamlined-backup"},
+					},
+				},
+				{
+					path:          "/v2/alerts/streamlined-backup%2Fbar/close?identifierType=alias",
+					authorization: "GenieKey test-key",
+					body: map[string]interface{}{
+						"source": "test-host",
+						"note":   "Backup task bar completed successfully.",
+					},
+				},
+				{
+					path:          "/v2/alerts",
+					authorization: "GenieKey test-key",
+					body: map[string]interface{}{
+						"message":     "Backup task qux timed out!",
+						"alias":       "streamlined-backup/qux",
+						"description": "Command:\necho 'foo bar'\n\nWorking directory:\n/tmp\n\nError:\nNo error available.\n\nLog lines (written to stderr):\nNo logs available.",
+						"details":     quxDetails,
+						"source":      "test-host",
+						"tags":        []interface{}{"streamlined-backup"},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			mutex := sync.Mutex{}
+			requests := []incidentRequest{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				request := incidentRequest{path: r.URL.RequestURI(), authorization: r.Header.Get("Authorization")}
+				if body, err := ioutil.ReadAll(r.Body); err != nil {
+					panic(err)
+				} else if err := json.Unmarshal(body, &request.body); err != nil {
+					panic(err)
+				}
+				requests = append(requests, request)
+
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer ts.Close()
+
+			notifier, err := NewIncidentNotifier(IncidentOptions{Provider: tc.provider, Key: "test-key", URL: ts.URL + "/", Source: "test-host"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := notifier.Notify(results...); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if !reflect.DeepEqual(requests, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, requests)
+			}
+		})
+	}
+}
+
+func TestIncidentError(t *testing.T) {
+	t.Parallel()
+
+	mutex := sync.Mutex{}
+	requests := []incidentRequest{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		request := incidentRequest{path: r.URL.RequestURI(), authorization: r.Header.Get("Authorization")}
+		if body, err := ioutil.ReadAll(r.Body); err != nil {
+			panic(err)
+		} else if err := json.Unmarshal(body, &request.body); err != nil {
+			panic(err)
+		}
+		requests = append(requests, request)
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	notifier, err := NewIncidentNotifier(IncidentOptions{Provider: PagerDutyProvider, Key: "test-key", URL: ts.URL, Source: "test-host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Error(errors.New("test error")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	expected := []incidentRequest{
+		{
+			path: "/v2/enqueue",
+			body: map[string]interface{}{
+				"routing_key":  "test-key",
+				"event_action": "trigger",
+				"dedup_key":    "streamlined-backup/error",
+				"payload": map[string]interface{}{
+					"summary":        "Error running backup task!",
+					"source":         "test-host",
+					"severity":       "error",
+					"component":      "streamlined-backup",
+					"custom_details": map[string]interface{}{"Error": "test error"},
+				},
+			},
+		},
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected %+v, got %+v", expected, requests)
+	}
+}
+
+func TestIncidentNotifyError(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier, err := NewIncidentNotifier(IncidentOptions{Provider: OpsgenieProvider, Key: "test-key", URL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []backup.Result{
+		backup.NewResultFailed(task, errors.New("test error"), []string{}),
+		backup.NewResultSuccess(task, []string{}),
+	}
+	if err := notifier.Notify(results...); err == nil {
+		t.Error("expected error, got nil")
+	} else if merr, ok := err.(*multierror.Error); !ok {
+		t.Errorf("expected multierror, got %T", err)
+	} else if len(merr.Errors) != 2 {
+		t.Errorf("expected 2 errors, got %d", len(merr.Errors))
+	}
+}
+
+func TestNewIncidentNotifierError(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewIncidentNotifier(IncidentOptions{Provider: "victorops"}); !errors.Is(err, ErrUnknownIncidentProvider) {
+		t.Errorf("expected %v, got %v", ErrUnknownIncidentProvider, err)
+	}
+}
@@ -3,13 +3,17 @@ package notifier
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
 
 	"github.com/chialab/streamlined-backup/backup"
+	"github.com/hashicorp/go-multierror"
 )
 
 type Notifier interface {
 	Notify(...backup.Result) error
-	Error(interface{}) error
+	Error(error) error
 }
 
 func MustToJSON(val interface{}) []byte {
@@ -20,3 +24,41 @@ func MustToJSON(val interface{}) []byte {
 
 	return buf.Bytes()
 }
+
+// Posts a JSON body to all the webhooks concurrently.
+func postJSON(webhooks []string, body interface{}) error {
+	jsonBody := MustToJSON(body)
+
+	wg := sync.WaitGroup{}
+	mutex := sync.Mutex{}
+	var errors *multierror.Error
+	for _, webhook := range webhooks {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+
+			body := bytes.NewBuffer(jsonBody)
+
+			response, err := http.Post(url, "application/json", body)
+			if err != nil {
+				mutex.Lock()
+				defer mutex.Unlock()
+				errors = multierror.Append(errors, err)
+
+				return
+			}
+			defer response.Body.Close()
+
+			if response.StatusCode < 200 || response.StatusCode >= 300 {
+				err := fmt.Errorf("error sending notification to %s: %s", url, response.Status)
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				errors = multierror.Append(errors, err)
+			}
+		}(webhook)
+	}
+	wg.Wait()
+
+	return errors.ErrorOrNil()
+}
@@ -0,0 +1,181 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/utils"
+	"github.com/hashicorp/go-multierror"
+)
+
+type Policy string
+
+const (
+	PolicyAlways       Policy = "always"
+	PolicyFailuresOnly Policy = "failures_only"
+	PolicyOnChange     Policy = "on_change"
+	PolicyDailyDigest  Policy = "daily_digest"
+	PolicyWeeklyDigest Policy = "weekly_digest"
+)
+
+var ErrUnknownPolicy = errors.New("unknown notification policy")
+
+// State that policies need across runs: last status of each task, and results waiting for the next digest.
+type policyState struct {
+	Statuses    map[string]backup.Status `json:"statuses"`
+	DigestSince time.Time                `json:"digest_since"`
+	Pending     []backup.Result          `json:"pending"`
+}
+
+// Filters the results passed to a notifier according to a policy. Errors are always passed through.
+//
+// The state is kept in memory and, if a path is given, in a file, so that it survives between runs
+// when backups are started by cron.
+type PolicyNotifier struct {
+	notifier  Notifier
+	policy    Policy
+	statePath string
+	now       func() time.Time
+
+	mutex sync.Mutex
+	state policyState
+}
+
+func NewPolicyNotifier(notifier Notifier, policy Policy, statePath string) (*PolicyNotifier, error) {
+	switch policy {
+	case "":
+		policy = PolicyAlways
+	case PolicyAlways, PolicyFailuresOnly, PolicyOnChange, PolicyDailyDigest, PolicyWeeklyDigest:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPolicy, policy)
+	}
+
+	n := &PolicyNotifier{
+		notifier:  notifier,
+		policy:    policy,
+		statePath: statePath,
+		now:       time.Now,
+		state:     policyState{Statuses: map[string]backup.Status{}},
+	}
+	if statePath != "" {
+		if data, err := os.ReadFile(statePath); err == nil {
+			if err := json.Unmarshal(data, &n.state); err != nil {
+				return nil, fmt.Errorf("invalid notification state %s: %w", statePath, err)
+			}
+			if n.state.Statuses == nil {
+				n.state.Statuses = map[string]backup.Status{}
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+func isFailure(status backup.Status) bool {
+	return status.Priority() > backup.StatusSuccess.Priority()
+}
+
+func (n *PolicyNotifier) digestPeriod() time.Duration {
+	if n.policy == PolicyWeeklyDigest {
+		return 7 * 24 * time.Hour
+	}
+
+	return 24 * time.Hour
+}
+
+// The state is only updated once the results are delivered: on failure, digests keep their pending results and
+// changes are notified again on the next run.
+func (n *PolicyNotifier) Notify(results ...backup.Result) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	state := policyState{
+		Statuses:    make(map[string]backup.Status, len(n.state.Statuses)),
+		DigestSince: n.state.DigestSince,
+		Pending:     append([]backup.Result{}, n.state.Pending...),
+	}
+	for name, status := range n.state.Statuses {
+		state.Statuses[name] = status
+	}
+
+	notified := []backup.Result{}
+	for _, result := range results {
+		status := result.Status()
+		if status == backup.StatusSkipped {
+			continue
+		}
+
+		switch n.policy {
+		case PolicyAlways:
+			notified = append(notified, result)
+
+		case PolicyFailuresOnly:
+			if isFailure(status) {
+				notified = append(notified, result)
+			}
+
+		case PolicyOnChange:
+			// A task failing on its first known run is a change too, but a task succeeding is not.
+			previous, known := state.Statuses[result.Name()]
+			if (known && isFailure(previous) != isFailure(status)) || (!known && isFailure(status)) {
+				notified = append(notified, result)
+			}
+			state.Statuses[result.Name()] = status
+
+		case PolicyDailyDigest, PolicyWeeklyDigest:
+			state.Pending = append(state.Pending, result)
+		}
+	}
+
+	if n.policy == PolicyDailyDigest || n.policy == PolicyWeeklyDigest {
+		now := n.now()
+		if state.DigestSince.IsZero() {
+			state.DigestSince = now
+		}
+		if now.Sub(state.DigestSince) >= n.digestPeriod() {
+			notified, state.Pending = state.Pending, nil
+			state.DigestSince = now
+		}
+	}
+
+	if len(notified) > 0 {
+		if err := n.notifier.Notify(notified...); err != nil {
+			if n.policy == PolicyDailyDigest || n.policy == PolicyWeeklyDigest {
+				n.state.Pending = notified
+				if saveErr := n.save(); saveErr != nil {
+					return multierror.Append(err, saveErr)
+				}
+			}
+
+			return err
+		}
+	}
+
+	n.state = state
+
+	return n.save()
+}
+
+func (n *PolicyNotifier) Error(err error) error {
+	return n.notifier.Error(err)
+}
+
+func (n *PolicyNotifier) save() error {
+	if n.statePath == "" || n.policy == PolicyAlways || n.policy == PolicyFailuresOnly {
+		return nil
+	}
+
+	data, err := json.Marshal(n.state)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(n.statePath, data, 0600)
+}
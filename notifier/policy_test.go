@@ -0,0 +1,267 @@
+package notifier
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+)
+
+type recordingNotifier struct {
+	notified [][]string
+	errors   []error
+	err      error
+}
+
+func (n *recordingNotifier) Notify(results ...backup.Result) error {
+	statuses := []string{}
+	for _, result := range results {
+		statuses = append(statuses, result.Name()+":"+string(result.Status()))
+	}
+	n.notified = append(n.notified, statuses)
+
+	return n.err
+}
+
+func (n *recordingNotifier) Error(err error) error {
+	n.errors = append(n.errors, err)
+
+	return nil
+}
+
+func TestPolicyNotify(t *testing.T) {
+	t.Parallel()
+
+	newTask := func(name string) *backup.Task {
+		task, err := backup.NewTask(name, config.Task{Destination: config.Destination{Type: config.S3Destination}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return task
+	}
+	foo, bar := newTask("foo"), newTask("bar")
+	runs := [][]backup.Result{
+		{backup.NewResultSuccess(foo, []string{}), backup.NewResultFailed(bar, errors.New("test error"), []string{})},
+		{backup.NewResultSuccess(foo, []string{}), backup.NewResultSkipped(bar)},
+		{backup.NewResultTimeout(foo, []string{}), backup.NewResultFailed(bar, errors.New("test error"), []string{})},
+		{backup.NewResultFailed(foo, errors.New("test error"), []string{}), backup.NewResultSuccess(bar, []string{})},
+		{backup.NewResultSuccess(foo, []string{}), backup.NewResultSuspicious(bar, errors.New("too small"), []string{})},
+	}
+
+	testCases := map[string]struct {
+		policy   Policy
+		expected [][]string
+	}{
+		"default": {
+			policy: "",
+			expected: [][]string{
+				{"foo:success", "bar:failed"},
+				{"foo:success"},
+				{"foo:timeout", "bar:failed"},
+				{"foo:failed", "bar:success"},
+				{"foo:success", "bar:suspicious"},
+			},
+		},
+		"failures_only": {
+			policy: PolicyFailuresOnly,
+			expected: [][]string{
+				{"bar:failed"},
+				{"foo:timeout", "bar:failed"},
+				{"foo:failed"},
+				{"bar:suspicious"},
+			},
+		},
+		"on_change": {
+			policy: PolicyOnChange,
+			expected: [][]string{
+				{"bar:failed"},
+				{"foo:timeout"},
+				{"bar:success"},
+				{"foo:success", "bar:suspicious"},
+			},
+		},
+		"daily_digest": {
+			policy: PolicyDailyDigest,
+			expected: [][]string{
+				{"foo:success", "bar:failed", "foo:success", "foo:timeout", "bar:failed"},
+				{"foo:failed", "bar:success", "foo:success", "bar:suspicious"},
+			},
+		},
+		"weekly_digest": {
+			policy:   PolicyWeeklyDigest,
+			expected: nil,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := &recordingNotifier{}
+			notifier, err := NewPolicyNotifier(recorder, tc.policy, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			now := time.Date(2021, 10, 8, 4, 30, 0, 0, time.UTC)
+			for _, results := range runs {
+				notifier.now = func() time.Time { return now }
+				if err := notifier.Notify(results...); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				now = now.Add(12 * time.Hour)
+			}
+
+			if !reflect.DeepEqual(recorder.notified, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, recorder.notified)
+			}
+		})
+	}
+}
+
+func TestPolicyState(t *testing.T) {
+	t.Parallel()
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	now := time.Date(2021, 10, 8, 4, 30, 0, 0, time.UTC)
+
+	// Each run uses a new notifier, like when backups are started by cron.
+	run := func(policy Policy, result backup.Result) [][]string {
+		recorder := &recordingNotifier{}
+		notifier, err := NewPolicyNotifier(recorder, policy, statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		notifier.now = func() time.Time { return now }
+		if err := notifier.Notify(result); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		now = now.Add(24 * time.Hour)
+
+		return recorder.notified
+	}
+
+	if notified := run(PolicyOnChange, backup.NewResultFailed(task, errors.New("test error"), []string{})); len(notified) != 1 {
+		t.Errorf("expected failure to be notified, got %v", notified)
+	}
+	if notified := run(PolicyOnChange, backup.NewResultFailed(task, errors.New("test error"), []string{})); len(notified) != 0 {
+		t.Errorf("expected repeated failure not to be notified, got %v", notified)
+	}
+	if notified := run(PolicyOnChange, backup.NewResultSuccess(task, []string{})); len(notified) != 1 {
+		t.Errorf("expected recovery to be notified, got %v", notified)
+	}
+
+	if err := os.Remove(statePath); err != nil {
+		t.Fatal(err)
+	}
+	if notified := run(PolicyDailyDigest, backup.NewResultFailed(task, errors.New("test error"), []string{"test log"})); len(notified) != 0 {
+		t.Errorf("expected digest not to be sent, got %v", notified)
+	}
+	expected := [][]string{{"foo:failed", "foo:success"}}
+	if notified := run(PolicyDailyDigest, backup.NewResultSuccess(task, []string{})); !reflect.DeepEqual(notified, expected) {
+		t.Errorf("expected %v, got %v", expected, notified)
+	}
+}
+
+func TestPolicyDeliveryError(t *testing.T) {
+	t.Parallel()
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		policy   Policy
+		results  []backup.Result
+		expected [][]string
+	}{
+		"on_change": {
+			policy:   PolicyOnChange,
+			results:  []backup.Result{backup.NewResultFailed(task, errors.New("test error"), []string{}), backup.NewResultFailed(task, errors.New("test error"), []string{})},
+			expected: [][]string{{"foo:failed"}},
+		},
+		"daily_digest": {
+			policy:   PolicyDailyDigest,
+			results:  []backup.Result{backup.NewResultFailed(task, errors.New("test error"), []string{}), backup.NewResultSuccess(task, []string{}), backup.NewResultSuccess(task, []string{})},
+			expected: [][]string{{"foo:failed", "foo:success", "foo:success"}},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			statePath := filepath.Join(t.TempDir(), "state.json")
+			now := time.Date(2021, 10, 8, 4, 30, 0, 0, time.UTC)
+			testErr := errors.New("delivery failed")
+
+			// Each run uses a new notifier, like when backups are started by cron, and only the last one delivers.
+			var recorder *recordingNotifier
+			for i, result := range tc.results {
+				recorder = &recordingNotifier{}
+				if i < len(tc.results)-1 {
+					recorder.err = testErr
+				}
+				notifier, err := NewPolicyNotifier(recorder, tc.policy, statePath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				notifier.now = func() time.Time { return now }
+				if err := notifier.Notify(result); err != nil && !errors.Is(err, testErr) {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				now = now.Add(24 * time.Hour)
+			}
+
+			if !reflect.DeepEqual(recorder.notified, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, recorder.notified)
+			}
+		})
+	}
+}
+
+func TestPolicyError(t *testing.T) {
+	t.Parallel()
+
+	recorder := &recordingNotifier{}
+	notifier, err := NewPolicyNotifier(recorder, PolicyOnChange, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testErr := errors.New("test error")
+	if err := notifier.Error(testErr); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(recorder.errors, []error{testErr}) {
+		t.Errorf("expected %v, got %v", []error{testErr}, recorder.errors)
+	}
+}
+
+func TestNewPolicyNotifierError(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewPolicyNotifier(&recordingNotifier{}, "hourly", ""); !errors.Is(err, ErrUnknownPolicy) {
+		t.Errorf("expected %v, got %v", ErrUnknownPolicy, err)
+	}
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(statePath, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPolicyNotifier(&recordingNotifier{}, PolicyOnChange, statePath); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
@@ -0,0 +1,185 @@
+package notifier
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Sends notifications to all the notifiers, collecting their errors.
+type MultiNotifier []Notifier
+
+func NewMultiNotifier(notifiers ...Notifier) MultiNotifier {
+	return MultiNotifier(notifiers)
+}
+
+func (n MultiNotifier) Notify(results ...backup.Result) error {
+	var errors *multierror.Error
+	for _, notifier := range n {
+		if err := notifier.Notify(results...); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
+	return errors.ErrorOrNil()
+}
+
+func (n MultiNotifier) Error(err error) error {
+	var errors *multierror.Error
+	for _, notifier := range n {
+		if notifyErr := notifier.Error(err); notifyErr != nil {
+			errors = multierror.Append(errors, notifyErr)
+		}
+	}
+
+	return errors.ErrorOrNil()
+}
+
+// Sends the results of each task to the notifiers listed in its routes. Tasks without routes are notified
+// to all notifiers, and so are errors.
+type Router struct {
+	notifiers map[string]Notifier
+	routes    map[string][]string
+}
+
+func NewRouter(notifiers map[string]Notifier, routes map[string][]string) *Router {
+	return &Router{notifiers: notifiers, routes: routes}
+}
+
+// Builds the notifiers defined in the configuration, and routes tasks according to their `notify` list.
+func NewRouterFromConfig(definitions map[string]config.Notifier, tasks map[string]config.Task) (*Router, error) {
+	notifiers := map[string]Notifier{}
+	for name, definition := range definitions {
+		notifier, err := FromConfig(definition)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q: %w", name, err)
+		}
+		notifiers[name] = notifier
+	}
+
+	routes := map[string][]string{}
+	for name, task := range tasks {
+		if len(task.Notify) > 0 {
+			routes[name] = task.Notify
+		}
+	}
+
+	return NewRouter(notifiers, routes), nil
+}
+
+func (r *Router) names() []string {
+	names := make([]string, 0, len(r.notifiers))
+	for name := range r.notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (r *Router) Notify(results ...backup.Result) error {
+	routed := map[string][]backup.Result{}
+	for _, result := range results {
+		names, ok := r.routes[result.Name()]
+		if !ok {
+			names = r.names()
+		}
+		for _, name := range names {
+			routed[name] = append(routed[name], result)
+		}
+	}
+
+	var errors *multierror.Error
+	for _, name := range r.names() {
+		if len(routed[name]) == 0 {
+			continue
+		}
+		if err := r.notifiers[name].Notify(routed[name]...); err != nil {
+			errors = multierror.Append(errors, fmt.Errorf("notifier %q: %w", name, err))
+		}
+	}
+
+	return errors.ErrorOrNil()
+}
+
+func (r *Router) Error(err error) error {
+	var errors *multierror.Error
+	for _, name := range r.names() {
+		if notifyErr := r.notifiers[name].Error(err); notifyErr != nil {
+			errors = multierror.Append(errors, fmt.Errorf("notifier %q: %w", name, notifyErr))
+		}
+	}
+
+	return errors.ErrorOrNil()
+}
+
+// Builds a notifier from its definition, applying its notification policy.
+func FromConfig(definition config.Notifier) (Notifier, error) {
+	var notifier Notifier
+	var err error
+	switch definition.Type {
+	case config.SlackNotifier:
+		notifier = NewSlackNotifier(definition.Slack.Webhooks...)
+	case config.TeamsNotifier:
+		notifier = NewTeamsNotifier(definition.Teams.Webhooks...)
+	case config.DiscordNotifier:
+		notifier = NewDiscordNotifier(definition.Discord.Webhooks...)
+	case config.WebhookNotifier:
+		notifier, err = NewWebhookNotifier(WebhookOptions{
+			URLs:            definition.Webhook.URLs,
+			Payload:         definition.Webhook.Payload,
+			Headers:         definition.Webhook.Headers,
+			Secret:          definition.Webhook.Secret,
+			SignatureHeader: definition.Webhook.SignatureHeader,
+			Aggregate:       definition.Webhook.Aggregate,
+		})
+	case config.EmailNotifier:
+		notifier, err = NewEmailNotifier(EmailOptions{
+			Host:     definition.Email.Host,
+			Port:     definition.Email.Port,
+			Security: EmailSecurity(definition.Email.Security),
+			Auth:     EmailAuth(definition.Email.Auth),
+			Username: definition.Email.Username,
+			Password: definition.Email.Password,
+			From:     definition.Email.From,
+			To:       definition.Email.To,
+		})
+	case config.PagerDutyNotifier:
+		notifier, err = newIncidentFromConfig(PagerDutyProvider, definition.PagerDuty)
+	case config.OpsgenieNotifier:
+		notifier, err = newIncidentFromConfig(OpsgenieProvider, definition.Opsgenie)
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", definition.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	policy, ok := configPolicies[definition.Policy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPolicy, definition.Policy)
+	}
+
+	return NewPolicyNotifier(notifier, policy, definition.StateFile)
+}
+
+var configPolicies = map[config.NotificationPolicy]Policy{
+	"":                        PolicyAlways,
+	config.PolicyAlways:       PolicyAlways,
+	config.PolicyFailuresOnly: PolicyFailuresOnly,
+	config.PolicyOnChange:     PolicyOnChange,
+	config.PolicyDailyDigest:  PolicyDailyDigest,
+	config.PolicyWeeklyDigest: PolicyWeeklyDigest,
+}
+
+func newIncidentFromConfig(provider IncidentProvider, definition config.IncidentDefinition) (*IncidentNotifier, error) {
+	return NewIncidentNotifier(IncidentOptions{
+		Provider: provider,
+		Key:      definition.Key,
+		URL:      definition.URL,
+		Source:   definition.Source,
+	})
+}
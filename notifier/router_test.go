@@ -0,0 +1,164 @@
+package notifier
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+)
+
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(results ...backup.Result) error {
+	return errors.New("notify error")
+}
+
+func (failingNotifier) Error(err error) error {
+	return errors.New("error error")
+}
+
+func TestRouterNotify(t *testing.T) {
+	t.Parallel()
+
+	newTask := func(name string) *backup.Task {
+		task, err := backup.NewTask(name, config.Task{Destination: config.Destination{Type: config.S3Destination}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return task
+	}
+	foo, bar, baz := newTask("foo"), newTask("bar"), newTask("baz")
+
+	slack, pagerduty := &recordingNotifier{}, &recordingNotifier{}
+	router := NewRouter(
+		map[string]Notifier{"dba-slack": slack, "pagerduty": pagerduty},
+		map[string][]string{"foo": {"dba-slack", "pagerduty"}, "bar": {"pagerduty"}},
+	)
+
+	if err := router.Notify(
+		backup.NewResultSuccess(foo, []string{}),
+		backup.NewResultFailed(bar, errors.New("test error"), []string{}),
+		backup.NewResultTimeout(baz, []string{}),
+	); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := router.Notify(backup.NewResultSuccess(bar, []string{})); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if expected := [][]string{{"foo:success", "baz:timeout"}}; !reflect.DeepEqual(slack.notified, expected) {
+		t.Errorf("expected %v, got %v", expected, slack.notified)
+	}
+	if expected := [][]string{{"foo:success", "bar:failed", "baz:timeout"}, {"bar:success"}}; !reflect.DeepEqual(pagerduty.notified, expected) {
+		t.Errorf("expected %v, got %v", expected, pagerduty.notified)
+	}
+
+	testErr := errors.New("test error")
+	if err := router.Error(testErr); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(slack.errors) != 1 || len(pagerduty.errors) != 1 {
+		t.Errorf("expected error to be sent to all notifiers, got %v and %v", slack.errors, pagerduty.errors)
+	}
+}
+
+func TestRouterErrors(t *testing.T) {
+	t.Parallel()
+
+	recorder := &recordingNotifier{}
+	router := NewRouter(map[string]Notifier{"broken": failingNotifier{}, "working": recorder}, map[string][]string{})
+
+	if err := router.Notify(backup.NewResultSuccess(&backup.Task{}, []string{})); err == nil {
+		t.Error("expected error, got nil")
+	} else if !strings.Contains(err.Error(), `notifier "broken": notify error`) {
+		t.Errorf("expected error to name the notifier, got %q", err)
+	}
+	if err := router.Error(errors.New("test error")); err == nil {
+		t.Error("expected error, got nil")
+	}
+	if len(recorder.notified) != 1 || len(recorder.errors) != 1 {
+		t.Errorf("expected working notifier to be notified despite errors, got %v and %v", recorder.notified, recorder.errors)
+	}
+}
+
+func TestMultiNotifier(t *testing.T) {
+	t.Parallel()
+
+	first, second := &recordingNotifier{}, &recordingNotifier{}
+	notifier := NewMultiNotifier(first, failingNotifier{}, second)
+
+	if err := notifier.Notify(backup.NewResultSuccess(&backup.Task{}, []string{})); err == nil {
+		t.Error("expected error, got nil")
+	}
+	if err := notifier.Error(errors.New("test error")); err == nil {
+		t.Error("expected error, got nil")
+	}
+	for i, recorder := range []*recordingNotifier{first, second} {
+		if len(recorder.notified) != 1 || len(recorder.errors) != 1 {
+			t.Errorf("expected notifier %d to be notified, got %v and %v", i, recorder.notified, recorder.errors)
+		}
+	}
+}
+
+func TestNewRouterFromConfig(t *testing.T) {
+	t.Parallel()
+
+	router, err := NewRouterFromConfig(map[string]config.Notifier{
+		"slack":     {Type: config.SlackNotifier, Slack: config.ChatNotifier{Webhooks: []string{"https://hooks.slack.com"}}},
+		"teams":     {Type: config.TeamsNotifier, Policy: config.PolicyFailuresOnly, Teams: config.ChatNotifier{Webhooks: []string{"https://example.webhook.office.com"}}},
+		"discord":   {Type: config.DiscordNotifier, Discord: config.ChatNotifier{Webhooks: []string{"https://discord.com/api/webhooks/1/x"}}},
+		"webhook":   {Type: config.WebhookNotifier, Webhook: config.WebhookDefinition{URLs: []string{"https://example.com"}}},
+		"email":     {Type: config.EmailNotifier, Email: config.EmailDefinition{Host: "localhost", From: "backup@example.com", To: []string{"ops@example.com"}}},
+		"pagerduty": {Type: config.PagerDutyNotifier, Policy: config.PolicyOnChange, PagerDuty: config.IncidentDefinition{Key: "key"}},
+		"opsgenie":  {Type: config.OpsgenieNotifier, Opsgenie: config.IncidentDefinition{Key: "key"}},
+	}, map[string]config.Task{
+		"foo": {Notify: []string{"slack"}},
+		"bar": {},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if expected := []string{"discord", "email", "opsgenie", "pagerduty", "slack", "teams", "webhook"}; !reflect.DeepEqual(router.names(), expected) {
+		t.Errorf("expected %v, got %v", expected, router.names())
+	}
+	if expected := map[string][]string{"foo": {"slack"}}; !reflect.DeepEqual(router.routes, expected) {
+		t.Errorf("expected %v, got %v", expected, router.routes)
+	}
+	if policy := router.notifiers["teams"].(*PolicyNotifier).policy; policy != PolicyFailuresOnly {
+		t.Errorf("expected %s, got %s", PolicyFailuresOnly, policy)
+	}
+
+	stateFile := path.Join(t.TempDir(), "state.json")
+	for policy, expected := range map[config.NotificationPolicy]Policy{
+		"":                        PolicyAlways,
+		config.PolicyAlways:       PolicyAlways,
+		config.PolicyFailuresOnly: PolicyFailuresOnly,
+		config.PolicyOnChange:     PolicyOnChange,
+		config.PolicyDailyDigest:  PolicyDailyDigest,
+		config.PolicyWeeklyDigest: PolicyWeeklyDigest,
+	} {
+		definition := config.Notifier{Type: config.SlackNotifier, Policy: policy, StateFile: stateFile, Slack: config.ChatNotifier{Webhooks: []string{"https://hooks.slack.com"}}}
+		if notifier, err := FromConfig(definition); err != nil {
+			t.Errorf("unexpected error for policy %q: %s", policy, err)
+		} else if actual := notifier.(*PolicyNotifier).policy; actual != expected {
+			t.Errorf("expected %s, got %s", expected, actual)
+		}
+	}
+	if _, err := FromConfig(config.Notifier{Type: config.SlackNotifier, Policy: "hourly"}); !errors.Is(err, ErrUnknownPolicy) {
+		t.Errorf("expected %#v, got %#v", ErrUnknownPolicy, err)
+	}
+
+	if _, err := NewRouterFromConfig(map[string]config.Notifier{
+		"hook": {Type: config.WebhookNotifier, Webhook: config.WebhookDefinition{URLs: []string{"https://example.com"}, Payload: "{{ .Results"}},
+	}, map[string]config.Task{}); err == nil {
+		t.Error("expected error, got nil")
+	} else if !strings.HasPrefix(err.Error(), `notifier "hook": `) {
+		t.Errorf("expected error to name the notifier, got %q", err)
+	}
+}
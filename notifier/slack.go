@@ -1,14 +1,9 @@
 package notifier
 
 import (
-	"bytes"
 	"fmt"
-	"net/http"
-	"strings"
-	"sync"
 
 	"github.com/chialab/streamlined-backup/backup"
-	"github.com/hashicorp/go-multierror"
 )
 
 type SlackNotifier struct {
@@ -19,55 +14,43 @@ func NewSlackNotifier(webhooks ...string) *SlackNotifier {
 	return &SlackNotifier{webhooks: webhooks}
 }
 
+var slackIcons = map[backup.Status]string{
+	backup.StatusSuccess:    ":white_check_mark:",
+	backup.StatusSuspicious: ":warning:",
+	backup.StatusFailed:     ":rotating_light:",
+	backup.StatusTimeout:    ":hourglass:",
+}
+
 func (n SlackNotifier) Format(o *backup.Result) map[string]interface{} {
-	switch o.Status() {
-	case backup.StatusSuccess:
-		return map[string]interface{}{
-			"type": "section",
-			"text": map[string]string{
-				"type": "mrkdwn",
-				"text": fmt.Sprintf(":white_check_mark: Backup task `%s` completed successfully.", o.Name()),
-			},
-		}
+	formatted := formatResult(o)
+	if formatted == nil {
+		return nil
+	}
 
-	case backup.StatusFailed:
-		logs := o.Logs()
-		if len(logs) == 0 {
-			logs = []string{"No logs available."}
-		} else if len(logs) > 13 {
-			tail := logs[len(logs)-5:]
-			logs = append(logs[:5], fmt.Sprintf("... %d lines omitted ...", len(logs)-10))
-			logs = append(logs, tail...)
-		}
+	text := fmt.Sprintf(formatted.headline, "`"+formatted.task+"`")
+	if formatted.alert {
+		text = fmt.Sprintf("*%s* @channel", text)
+	}
+	block := map[string]interface{}{
+		"type": "section",
+		"text": map[string]string{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("%s %s", slackIcons[formatted.status], text),
+		},
+	}
 
-		return map[string]interface{}{
-			"type": "section",
-			"text": map[string]string{
+	if len(formatted.fields) > 0 {
+		fields := []map[string]string{}
+		for _, field := range formatted.fields {
+			fields = append(fields, map[string]string{
 				"type": "mrkdwn",
-				"text": fmt.Sprintf(":rotating_light: *Error running backup task `%s`!* @channel", o.Name()),
-			},
-			"fields": []map[string]string{
-				{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Command:*\n```\n%s\n```", o.Command()),
-				},
-				{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Working directory:*\n```\n%s\n```", o.ActualCwd()),
-				},
-				{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Error:*\n```\n%s\n```", strings.TrimSpace(o.Error().Error())),
-				},
-				{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Log lines (written to stderr):*\n```\n%s\n```", strings.TrimSpace(strings.Join(logs, "\n"))),
-				},
-			},
+				"text": fmt.Sprintf("*%s:*\n```\n%s\n```", field.title, field.value),
+			})
 		}
+		block["fields"] = fields
 	}
 
-	return nil
+	return block
 }
 
 func (n SlackNotifier) Notify(results ...backup.Result) error {
@@ -96,7 +79,7 @@ func (n SlackNotifier) Error(err error) error {
 				"type": "section",
 				"text": map[string]string{
 					"type": "mrkdwn",
-					"text": fmt.Sprintf(":rotating_light: *Error running backup task!* @channel\n```\n%v\n```", err),
+					"text": fmt.Sprintf(":rotating_light: *%s* @channel\n```\n%v\n```", errorHeadline, err),
 				},
 			},
 		},
@@ -106,38 +89,5 @@ func (n SlackNotifier) Error(err error) error {
 }
 
 func (n SlackNotifier) Send(body interface{}) error {
-	jsonBody := MustToJSON(body)
-
-	wg := sync.WaitGroup{}
-	mutex := sync.Mutex{}
-	var errors *multierror.Error
-	for _, webhook := range n.webhooks {
-		wg.Add(1)
-		go func(url string) {
-			defer wg.Done()
-
-			body := bytes.NewBuffer(jsonBody)
-
-			response, err := http.Post(url, "application/json", body)
-			if err != nil {
-				mutex.Lock()
-				defer mutex.Unlock()
-				errors = multierror.Append(errors, err)
-
-				return
-			}
-			defer response.Body.Close()
-
-			if response.StatusCode != 200 {
-				err := fmt.Errorf("error sending notification to %s: %s", url, response.Status)
-
-				mutex.Lock()
-				defer mutex.Unlock()
-				errors = multierror.Append(errors, err)
-			}
-		}(webhook)
-	}
-	wg.Wait()
-
-	return errors.ErrorOrNil()
+	return postJSON(n.webhooks, body)
 }
@@ -23,7 +23,7 @@ func TestSlackFormat(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	taskBar, err := backup.NewTask("bar", config.Task{Command: []string{"echo", "foo bar"}, Cwd: tmpDir, Destination: config.Destination{Type: config.S3Destination}})
+	taskBar, err := backup.NewTask("bar", config.Task{Command: config.Command{{"echo", "foo bar"}}, Cwd: tmpDir, Destination: config.Destination{Type: config.S3Destination}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -46,6 +46,26 @@ func TestSlackFormat(t *testing.T) {
 				},
 			},
 		},
+		"suspicious": {
+			input: backup.NewResultSuspicious(taskFoo, errors.New("artifact size 20.0 KiB is below min_size 1.0 MiB"), []string{}),
+			expected: map[string]interface{}{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": ":warning: *Backup task `foo` produced a suspicious artifact!* @channel",
+				},
+				"fields": []map[string]string{
+					{
+						"type": "mrkdwn",
+						"text": "*Reason:*\n```\nartifact size 20.0 KiB is below min_size 1.0 MiB\n```",
+					},
+					{
+						"type": "mrkdwn",
+						"text": "*Artifact:*\n```\nNot stored.\n```",
+					},
+				},
+			},
+		},
 		"failure": {
 			input: backup.NewResultFailed(taskBar, errors.New("test error"), []string{"test log 1", "test log 2", ""}),
 			expected: map[string]interface{}{
@@ -74,6 +94,34 @@ func TestSlackFormat(t *testing.T) {
 				},
 			},
 		},
+		"timeout": {
+			input: backup.NewResultTimeout(taskBar, []string{}),
+			expected: map[string]interface{}{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": ":hourglass: *Backup task `bar` timed out!* @channel",
+				},
+				"fields": []map[string]string{
+					{
+						"type": "mrkdwn",
+						"text": "*Command:*\n```\necho 'foo bar'\n```",
+					},
+					{
+						"type": "mrkdwn",
+						"text": fmt.Sprintf("*Working directory:*\n```\n%s\n```", tmpDir),
+					},
+					{
+						"type": "mrkdwn",
+						"text": "*Error:*\n```\nNo error available.\n```",
+					},
+					{
+						"type": "mrkdwn",
+						"text": "*Log lines (written to stderr):*\n```\nNo logs available.\n```",
+					},
+				},
+			},
+		},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
@@ -0,0 +1,117 @@
+package notifier
+
+import (
+	"fmt"
+
+	"github.com/chialab/streamlined-backup/backup"
+)
+
+type TeamsNotifier struct {
+	webhooks []string
+}
+
+func NewTeamsNotifier(webhooks ...string) *TeamsNotifier {
+	return &TeamsNotifier{webhooks: webhooks}
+}
+
+var teamsColors = map[backup.Status]string{
+	backup.StatusSuccess:    "Good",
+	backup.StatusSuspicious: "Warning",
+	backup.StatusFailed:     "Attention",
+	backup.StatusTimeout:    "Attention",
+}
+
+// Formats a result as Adaptive Card elements.
+func (n TeamsNotifier) Format(o *backup.Result) []map[string]interface{} {
+	formatted := formatResult(o)
+	if formatted == nil {
+		return nil
+	}
+
+	weight := "Default"
+	if formatted.alert {
+		weight = "Bolder"
+	}
+	elements := []map[string]interface{}{
+		{
+			"type":   "TextBlock",
+			"text":   fmt.Sprintf(formatted.headline, "**"+formatted.task+"**"),
+			"weight": weight,
+			"color":  teamsColors[formatted.status],
+			"wrap":   true,
+		},
+	}
+	for _, field := range formatted.fields {
+		elements = append(elements, map[string]interface{}{
+			"type":    "TextBlock",
+			"text":    field.title,
+			"weight":  "Bolder",
+			"spacing": "Small",
+			"wrap":    true,
+		}, map[string]interface{}{
+			"type":     "TextBlock",
+			"text":     field.value,
+			"fontType": "Monospace",
+			"spacing":  "None",
+			"wrap":     true,
+		})
+	}
+
+	return elements
+}
+
+func (n TeamsNotifier) Notify(results ...backup.Result) error {
+	elements := []map[string]interface{}{}
+	for _, result := range results {
+		if formatted := n.Format(&result); formatted != nil {
+			if len(elements) > 0 {
+				formatted[0]["separator"] = true
+			}
+			elements = append(elements, formatted...)
+		}
+	}
+
+	if len(elements) == 0 {
+		return nil
+	}
+
+	return n.Send(elements)
+}
+
+func (n TeamsNotifier) Error(err error) error {
+	return n.Send([]map[string]interface{}{
+		{
+			"type":   "TextBlock",
+			"text":   errorHeadline,
+			"weight": "Bolder",
+			"color":  "Attention",
+			"wrap":   true,
+		},
+		{
+			"type":     "TextBlock",
+			"text":     fmt.Sprintf("%v", err),
+			"fontType": "Monospace",
+			"wrap":     true,
+		},
+	})
+}
+
+// Wraps Adaptive Card elements in the message format expected by incoming webhooks.
+func (n TeamsNotifier) Send(elements []map[string]interface{}) error {
+	body := map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body":    elements,
+				},
+			},
+		},
+	}
+
+	return postJSON(n.webhooks, body)
+}
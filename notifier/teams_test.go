@@ -0,0 +1,149 @@
+package notifier
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+)
+
+func TestTeamsFormat(t *testing.T) {
+	t.Parallel()
+
+	task, err := backup.NewTask("foo", config.Task{Command: config.Command{{"echo", "foo bar"}}, Cwd: "/tmp", Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		input    backup.Result
+		expected []map[string]interface{}
+	}{
+		"skipped": {
+			input:    backup.NewResultSkipped(nil),
+			expected: nil,
+		},
+		"success": {
+			input: backup.NewResultSuccess(task, []string{}),
+			expected: []map[string]interface{}{
+				{"type": "TextBlock", "text": "Backup task **foo** completed successfully.", "weight": "Default", "color": "Good", "wrap": true},
+			},
+		},
+		"suspicious": {
+			input: backup.NewResultSuspicious(task, errors.New("artifact size 20.0 KiB is below min_size 1.0 MiB"), []string{}),
+			expected: []map[string]interface{}{
+				{"type": "TextBlock", "text": "Backup task **foo** produced a suspicious artifact!", "weight": "Bolder", "color": "Warning", "wrap": true},
+				{"type": "TextBlock", "text": "Reason", "weight": "Bolder", "spacing": "Small", "wrap": true},
+				{"type": "TextBlock", "text": "artifact size 20.0 KiB is below min_size 1.0 MiB", "fontType": "Monospace", "spacing": "None", "wrap": true},
+				{"type": "TextBlock", "text": "Artifact", "weight": "Bolder", "spacing": "Small", "wrap": true},
+				{"type": "TextBlock", "text": "Not stored.", "fontType": "Monospace", "spacing": "None", "wrap": true},
+			},
+		},
+		"failure": {
+			input: backup.NewResultFailed(task, errors.New("test error"), []string{"test log 1", "test log 2"}),
+			expected: []map[string]interface{}{
+				{"type": "TextBlock", "text": "Error running backup task **foo**!", "weight": "Bolder", "color": "Attention", "wrap": true},
+				{"type": "TextBlock", "text": "Command", "weight": "Bolder", "spacing": "Small", "wrap": true},
+				{"type": "TextBlock", "text": "echo 'foo bar'", "fontType": "Monospace", "spacing": "None", "wrap": true},
+				{"type": "TextBlock", "text": "Working directory", "weight": "Bolder", "spacing": "Small", "wrap": true},
+				{"type": "TextBlock", "text": "/tmp", "fontType": "Monospace", "spacing": "None", "wrap": true},
+				{"type": "TextBlock", "text": "Error", "weight": "Bolder", "spacing": "Small", "wrap": true},
+				{"type": "TextBlock", "text": "test error", "fontType": "Monospace", "spacing": "None", "wrap": true},
+				{"type": "TextBlock", "text": "Log lines (written to stderr)", "weight": "Bolder", "spacing": "Small", "wrap": true},
+				{"type": "TextBlock", "text": "test log 1\ntest log 2", "fontType": "Monospace", "spacing": "None", "wrap": true},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := new(TeamsNotifier).Format(&tc.input); !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTeamsNotify(t *testing.T) {
+	t.Parallel()
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []backup.Result{
+		backup.NewResultSkipped(nil),
+		backup.NewResultSuccess(task, []string{}),
+		backup.NewResultSuccess(task, []string{}),
+	}
+	expectedBody := `{"attachments":[{"content":{"$schema":"http://adaptivecards.io/schemas/adaptive-card.json","body":[` +
+		`{"color":"Good","text":"Backup task **foo** completed successfully.","type":"TextBlock","weight":"Default","wrap":true},` +
+		`{"color":"Good","separator":true,"text":"Backup task **foo** completed successfully.","type":"TextBlock","weight":"Default","wrap":true}` +
+		`],"type":"AdaptiveCard","version":"1.4"},"contentType":"application/vnd.microsoft.card.adaptive"}],"type":"message"}` + "\n"
+
+	requests := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, err := ioutil.ReadAll(r.Body); err != nil {
+			panic(err)
+		} else {
+			requests = append(requests, string(body))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	notifier := NewTeamsNotifier(ts.URL)
+
+	if err := notifier.Notify(results...); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := notifier.Notify(backup.NewResultSkipped(nil)); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	if requests[0] != expectedBody {
+		t.Errorf("expected body %s, got %s", expectedBody, requests[0])
+	}
+}
+
+func TestTeamsError(t *testing.T) {
+	t.Parallel()
+
+	expectedBody := `{"attachments":[{"content":{"$schema":"http://adaptivecards.io/schemas/adaptive-card.json","body":[` +
+		`{"color":"Attention","text":"Error running backup task!","type":"TextBlock","weight":"Bolder","wrap":true},` +
+		`{"fontType":"Monospace","text":"test error","type":"TextBlock","wrap":true}` +
+		`],"type":"AdaptiveCard","version":"1.4"},"contentType":"application/vnd.microsoft.card.adaptive"}],"type":"message"}` + "\n"
+
+	requests := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, err := ioutil.ReadAll(r.Body); err != nil {
+			panic(err)
+		} else {
+			requests = append(requests, string(body))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	if err := NewTeamsNotifier(ts.URL).Error(errors.New("test error")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	if requests[0] != expectedBody {
+		t.Errorf("expected body %s, got %s", expectedBody, requests[0])
+	}
+}
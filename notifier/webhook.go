@@ -0,0 +1,204 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/hashicorp/go-multierror"
+)
+
+const DEFAULT_SIGNATURE_HEADER = "X-Signature-256"
+
+const DEFAULT_WEBHOOK_PAYLOAD = `{"results": [{{ range $i, $result := .Results }}{{ if $i }}, {{ end }}{
+	"task": {{ json .Name }},
+	"status": {{ json .Status }},
+	"error": {{ json .Error }},
+	"destination": {{ json .Destination }},
+	"bytes_uploaded": {{ .BytesUploaded }},
+	"duration_seconds": {{ .Duration.Seconds }}
+}{{ end }}], "error": {{ json .Error }}}
+`
+
+type WebhookOptions struct {
+	URLs []string
+	// Go text/template rendered with a WebhookPayload. DEFAULT_WEBHOOK_PAYLOAD is used if empty.
+	Payload string
+	Headers map[string]string
+	// When set, requests are signed with HMAC-SHA256 and the hex signature is sent as `sha256=<signature>`.
+	Secret          string
+	SignatureHeader string
+	// Send one request with all the results of a run, instead of one request per result.
+	Aggregate bool
+}
+
+// Data the payload template is rendered with. Results are never skipped ones, and Error is only set when
+// the backup could not run at all.
+type WebhookPayload struct {
+	Results []backup.Result
+	Result  *backup.Result
+	Error   error
+}
+
+type WebhookNotifier struct {
+	urls            []string
+	payload         *template.Template
+	headers         map[string]string
+	secret          []byte
+	signatureHeader string
+	aggregate       bool
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		if err, ok := value.(error); ok && err != nil {
+			value = err.Error()
+		}
+		data, err := json.Marshal(value)
+
+		return string(data), err
+	},
+	"join": strings.Join,
+	"tail": func(n int, lines []string) []string {
+		if len(lines) > n {
+			return lines[len(lines)-n:]
+		}
+
+		return lines
+	},
+}
+
+func NewWebhookNotifier(options WebhookOptions) (*WebhookNotifier, error) {
+	payload := options.Payload
+	if payload == "" {
+		payload = DEFAULT_WEBHOOK_PAYLOAD
+	}
+	tmpl, err := template.New("payload").Funcs(webhookFuncs).Parse(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	signatureHeader := options.SignatureHeader
+	if signatureHeader == "" {
+		signatureHeader = DEFAULT_SIGNATURE_HEADER
+	}
+
+	return &WebhookNotifier{
+		urls:            options.URLs,
+		payload:         tmpl,
+		headers:         options.Headers,
+		secret:          []byte(options.Secret),
+		signatureHeader: signatureHeader,
+		aggregate:       options.Aggregate,
+	}, nil
+}
+
+func (n WebhookNotifier) Render(payload WebhookPayload) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := n.payload.Execute(buf, payload); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (n WebhookNotifier) Notify(results ...backup.Result) error {
+	notified := []backup.Result{}
+	for _, result := range results {
+		if result.Status() != backup.StatusSkipped {
+			notified = append(notified, result)
+		}
+	}
+
+	payloads := []WebhookPayload{}
+	if n.aggregate && len(notified) > 0 {
+		payloads = append(payloads, WebhookPayload{Results: notified})
+	} else if !n.aggregate {
+		for i := range notified {
+			payloads = append(payloads, WebhookPayload{Results: notified[i : i+1], Result: &notified[i]})
+		}
+	}
+
+	var errors *multierror.Error
+	for _, payload := range payloads {
+		if body, err := n.Render(payload); err != nil {
+			errors = multierror.Append(errors, err)
+		} else if err := n.Send(body); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
+	return errors.ErrorOrNil()
+}
+
+func (n WebhookNotifier) Error(err error) error {
+	body, renderErr := n.Render(WebhookPayload{Results: []backup.Result{}, Error: err})
+	if renderErr != nil {
+		return renderErr
+	}
+
+	return n.Send(body)
+}
+
+// Computes the value of the signature header for a request body.
+func (n WebhookNotifier) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (n WebhookNotifier) Send(body []byte) error {
+	wg := sync.WaitGroup{}
+	mutex := sync.Mutex{}
+	var errors *multierror.Error
+	for _, url := range n.urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+
+			if err := n.post(url, body); err != nil {
+				mutex.Lock()
+				defer mutex.Unlock()
+				errors = multierror.Append(errors, err)
+			}
+		}(url)
+	}
+	wg.Wait()
+
+	return errors.ErrorOrNil()
+}
+
+func (n WebhookNotifier) post(url string, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range n.headers {
+		request.Header.Set(name, value)
+	}
+	if len(n.secret) > 0 {
+		request.Header.Set(n.signatureHeader, n.Sign(body))
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("error sending notification to %s: %s", url, response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,323 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/chialab/streamlined-backup/backup"
+	"github.com/chialab/streamlined-backup/config"
+	"github.com/hashicorp/go-multierror"
+)
+
+type webhookRequest struct {
+	method string
+	header http.Header
+	body   string
+}
+
+func TestWebhookRenderDefault(t *testing.T) {
+	t.Parallel()
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier, err := NewWebhookNotifier(WebhookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		payload  WebhookPayload
+		expected string
+	}{
+		"results": {
+			payload: WebhookPayload{Results: []backup.Result{
+				backup.NewResultSuccess(task, []string{}),
+				backup.NewResultFailed(task, errors.New("test \"error\""), []string{}),
+			}},
+			expected: `{"error":null,"results":[` +
+				`{"bytes_uploaded":0,"destination":"","duration_seconds":0,"error":null,"status":"success","task":"foo"},` +
+				`{"bytes_uploaded":0,"destination":"","duration_seconds":0,"error":"test \"error\"","status":"failed","task":"foo"}` +
+				`]}`,
+		},
+		"error": {
+			payload:  WebhookPayload{Results: []backup.Result{}, Error: errors.New("test error")},
+			expected: `{"error":"test error","results":[]}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			body, err := notifier.Render(tc.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("expected valid JSON, got %s: %s", err, body)
+			}
+			if actual := string(MustToJSON(decoded)); actual != tc.expected+"\n" {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWebhookInvalidTemplate(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewWebhookNotifier(WebhookOptions{Payload: "{{ .Results "}); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestWebhookNotify(t *testing.T) {
+	t.Parallel()
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []backup.Result{
+		backup.NewResultSkipped(nil),
+		backup.NewResultSuccess(task, []string{}),
+		backup.NewResultFailed(task, errors.New("test error"), []string{"line 1", "line 2", "line 3"}),
+	}
+
+	testCases := map[string]struct {
+		payload   string
+		aggregate bool
+		expected  []string
+	}{
+		"per_result": {
+			payload:   `{{ .Result.Name }}:{{ .Result.Status }}{{ with .Result.Error }}:{{ . }}:{{ join (tail 2 $.Result.Logs) "," }}{{ end }}`,
+			aggregate: false,
+			expected:  []string{"foo:success", "foo:failed:test error:line 2,line 3"},
+		},
+		"aggregate": {
+			payload:   `{{ range .Results }}{{ .Name }}:{{ .Status }};{{ end }}`,
+			aggregate: true,
+			expected:  []string{"foo:success;foo:failed;"},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			mutex := sync.Mutex{}
+			requests := []webhookRequest{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				if body, err := ioutil.ReadAll(r.Body); err != nil {
+					panic(err)
+				} else {
+					requests = append(requests, webhookRequest{method: r.Method, header: r.Header, body: string(body)})
+				}
+
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer ts.Close()
+
+			notifier, err := NewWebhookNotifier(WebhookOptions{URLs: []string{ts.URL}, Payload: tc.payload, Aggregate: tc.aggregate})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := notifier.Notify(results...); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if len(requests) != len(tc.expected) {
+				t.Fatalf("expected %d requests, got %d", len(tc.expected), len(requests))
+			}
+			for i, req := range requests {
+				if req.method != "POST" {
+					t.Errorf("expected POST request, got %s", req.method)
+				}
+				if req.body != tc.expected[i] {
+					t.Errorf("expected body %s, got %s", tc.expected[i], req.body)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookNotifyEmpty(t *testing.T) {
+	t.Parallel()
+
+	mutex := sync.Mutex{}
+	requests := []webhookRequest{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if body, err := ioutil.ReadAll(r.Body); err != nil {
+			panic(err)
+		} else {
+			requests = append(requests, webhookRequest{method: r.Method, header: r.Header, body: string(body)})
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	for _, aggregate := range []bool{false, true} {
+		notifier, err := NewWebhookNotifier(WebhookOptions{URLs: []string{ts.URL}, Aggregate: aggregate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := notifier.Notify(backup.NewResultSkipped(nil)); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(requests) != 0 {
+		t.Errorf("expected 0 requests, got %d", len(requests))
+	}
+}
+
+func TestWebhookHeaders(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		options     WebhookOptions
+		contentType string
+		signature   string
+		header      string
+	}{
+		"unsigned": {
+			options:     WebhookOptions{Payload: "hello"},
+			contentType: "application/json",
+			signature:   "",
+			header:      DEFAULT_SIGNATURE_HEADER,
+		},
+		"signed": {
+			options:     WebhookOptions{Payload: "hello", Secret: "s3cr3t"},
+			contentType: "application/json",
+			signature:   "sha256=6b23653f08c72072554e5dfef9b72efe01fcfe724a950689e991e7bd7089eb3e",
+			header:      DEFAULT_SIGNATURE_HEADER,
+		},
+		"custom": {
+			options: WebhookOptions{
+				Payload:         "hello",
+				Headers:         map[string]string{"Content-Type": "text/plain", "Authorization": "Bearer token"},
+				Secret:          "s3cr3t",
+				SignatureHeader: "X-Hub-Signature-256",
+			},
+			contentType: "text/plain",
+			signature:   "sha256=6b23653f08c72072554e5dfef9b72efe01fcfe724a950689e991e7bd7089eb3e",
+			header:      "X-Hub-Signature-256",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			mutex := sync.Mutex{}
+			requests := []webhookRequest{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				if body, err := ioutil.ReadAll(r.Body); err != nil {
+					panic(err)
+				} else {
+					requests = append(requests, webhookRequest{method: r.Method, header: r.Header, body: string(body)})
+				}
+
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer ts.Close()
+
+			tc.options.URLs = []string{ts.URL}
+			notifier, err := NewWebhookNotifier(tc.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := notifier.Error(errors.New("test error")); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if len(requests) != 1 {
+				t.Fatalf("expected 1 request, got %d", len(requests))
+			}
+			if contentType := requests[0].header.Get("Content-Type"); contentType != tc.contentType {
+				t.Errorf("expected Content-Type: %s, got %s", tc.contentType, contentType)
+			}
+			if signature := requests[0].header.Get(tc.header); signature != tc.signature {
+				t.Errorf("expected %s: %s, got %s", tc.header, tc.signature, signature)
+			}
+			if tc.signature != "" && notifier.Sign([]byte(requests[0].body)) != tc.signature {
+				t.Errorf("expected signature %s, got %s", tc.signature, notifier.Sign([]byte(requests[0].body)))
+			}
+			for key, value := range tc.options.Headers {
+				if actual := requests[0].header.Get(key); actual != value {
+					t.Errorf("expected %s: %s, got %s", key, value, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookNotifyError(t *testing.T) {
+	t.Parallel()
+
+	mutex := sync.Mutex{}
+	requests := []webhookRequest{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if body, err := ioutil.ReadAll(r.Body); err != nil {
+			panic(err)
+		} else {
+			requests = append(requests, webhookRequest{method: r.Method, header: r.Header, body: string(body)})
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	task, err := backup.NewTask("foo", config.Task{Destination: config.Destination{Type: config.S3Destination}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier, err := NewWebhookNotifier(WebhookOptions{URLs: []string{ts.URL, "wrong-protocol" + ts.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := notifier.Notify(backup.NewResultSuccess(task, []string{})); err == nil {
+		t.Error("expected error, got nil")
+	} else if merr, ok := err.(*multierror.Error); !ok {
+		t.Errorf("expected multierror, got %T", err)
+	} else if len(merr.Errors) != 2 {
+		t.Errorf("expected 2 errors, got %d", len(merr.Errors))
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(requests) != 1 {
+		t.Errorf("expected 1 request, got %d", len(requests))
+	}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(content), 0640); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if data, err := os.ReadFile(path); err != nil {
+			t.Fatal(err)
+		} else if string(data) != content {
+			t.Errorf("expected %s, got %s", content, data)
+		}
+	}
+
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640, got %s", info.Mode().Perm())
+	}
+	if entries, err := os.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 {
+		t.Errorf("expected temporary files to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestWriteFileAtomicError(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "missing", "state.json")
+	if err := WriteFileAtomic(path, []byte("content"), 0644); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
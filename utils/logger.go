@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LogFormat string
+
+const (
+	LogFormatText LogFormat = "text"
+	LogFormatJSON LogFormat = "json"
+)
+
+var ErrUnknownLogFormat = errors.New("unknown log format")
+
+func ParseLogFormat(value string) (LogFormat, error) {
+	switch format := LogFormat(value); format {
+	case LogFormatText, LogFormatJSON:
+		return format, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownLogFormat, value)
+}
+
+// Destination shared by a logger and all the loggers derived from it.
+type logOutput struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	format LogFormat
+	now    func() time.Time
+}
+
+type logField struct {
+	key   string
+	value interface{}
+}
+
+// Structured logger. In text format records keep the layout meant to be read by humans, such as
+// `2021/10/08 18:09:17 [task] ERROR (Upload failed): message`, where the prefix is the `task` or `component`
+// field and other fields are omitted. In JSON format each record is an object on its own line, with all fields.
+//
+// A nil logger discards all records.
+type Logger struct {
+	output *logOutput
+	fields []logField
+}
+
+func NewLogger(writer io.Writer, format LogFormat) *Logger {
+	return &Logger{output: &logOutput{writer: writer, format: format, now: time.Now}}
+}
+
+var defaultLogger = NewLogger(os.Stderr, LogFormatText)
+
+// Logger writing to stderr, used unless another one is configured.
+func DefaultLogger() *Logger {
+	return defaultLogger
+}
+
+// Changes the format of the default logger and of all the loggers derived from it.
+func SetLogFormat(format LogFormat) {
+	defaultLogger.output.mutex.Lock()
+	defer defaultLogger.output.mutex.Unlock()
+
+	defaultLogger.output.format = format
+}
+
+// Returns a logger that adds a field to all records. A field replaces any previous one with the same key.
+func (l *Logger) With(key string, value interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+
+	fields := make([]logField, 0, len(l.fields)+1)
+	for _, field := range l.fields {
+		if field.key != key {
+			fields = append(fields, field)
+		}
+	}
+
+	return &Logger{output: l.output, fields: append(fields, logField{key: key, value: value})}
+}
+
+func (l *Logger) Info(message string) {
+	l.write("info", "", message, nil)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.write("info", "", fmt.Sprintf(format, args...), nil)
+}
+
+// Logs an unexpected outcome that is not an error, written as `LABEL (message)` in text format.
+func (l *Logger) Warning(label string, message string) {
+	l.write("warning", label, message, nil)
+}
+
+// Logs an error, written as `ERROR (message): error` in text format.
+func (l *Logger) Error(message string, err error) {
+	l.write("error", "ERROR", message, err)
+}
+
+// Returns the value of a field added to the logger.
+func (l *Logger) Field(key string) (interface{}, bool) {
+	if l == nil {
+		return nil, false
+	}
+
+	for _, field := range l.fields {
+		if field.key == key {
+			return field.value, true
+		}
+	}
+
+	return nil, false
+}
+
+func (l *Logger) write(level string, label string, message string, err error) {
+	if l == nil {
+		return
+	}
+
+	l.output.mutex.Lock()
+	defer l.output.mutex.Unlock()
+
+	now := l.output.now()
+	buf := bytes.NewBuffer(nil)
+	if l.output.format == LogFormatJSON {
+		buf.WriteString("{")
+		writeJSONField(buf, "time", now.Format(time.RFC3339Nano))
+		buf.WriteString(",")
+		writeJSONField(buf, "level", level)
+		buf.WriteString(",")
+		writeJSONField(buf, "msg", message)
+		for _, field := range l.fields {
+			buf.WriteString(",")
+			writeJSONField(buf, field.key, field.value)
+		}
+		if err != nil {
+			buf.WriteString(",")
+			writeJSONField(buf, "error", err)
+		}
+		buf.WriteString("}\n")
+	} else {
+		buf.WriteString(now.Format("2006/01/02 15:04:05 "))
+		if name, ok := l.Field("task"); ok {
+			fmt.Fprintf(buf, "[%v] ", name)
+		} else if name, ok := l.Field("component"); ok {
+			fmt.Fprintf(buf, "[%v] ", name)
+		}
+
+		switch {
+		case err != nil:
+			fmt.Fprintf(buf, "%s (%s): %s", label, message, err)
+		case label != "":
+			fmt.Fprintf(buf, "%s (%s)", label, message)
+		default:
+			buf.WriteString(message)
+		}
+		if !strings.HasSuffix(buf.String(), "\n") {
+			buf.WriteString("\n")
+		}
+	}
+
+	l.output.writer.Write(buf.Bytes())
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	encodedKey, _ := json.Marshal(key)
+	encodedValue, err := json.Marshal(value)
+	if err != nil {
+		encodedValue, _ = json.Marshal(fmt.Sprintf("%v", value))
+	}
+
+	buf.Write(encodedKey)
+	buf.WriteString(":")
+	buf.Write(encodedValue)
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testCode int
+
+func (c testCode) String() string {
+	return "test_code"
+}
+
+func newFixedLogger(format LogFormat) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, format)
+	logger.output.now = func() time.Time {
+		return time.Date(2021, 10, 8, 18, 9, 17, 0, time.UTC)
+	}
+
+	return logger, &buf
+}
+
+func TestParseLogFormat(t *testing.T) {
+	t.Parallel()
+
+	if format, err := ParseLogFormat("json"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if format != LogFormatJSON {
+		t.Errorf("expected %s, got %s", LogFormatJSON, format)
+	}
+
+	if _, err := ParseLogFormat("xml"); !errors.Is(err, ErrUnknownLogFormat) {
+		t.Errorf("expected %s, got %v", ErrUnknownLogFormat, err)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		format   LogFormat
+		log      func(*Logger)
+		expected string
+	}
+
+	testCases := map[string]testCase{
+		"text_info": {
+			format:   LogFormatText,
+			log:      func(l *Logger) { l.With("task", "foo").With("run_id", "abc").Info("DONE") },
+			expected: "2021/10/08 18:09:17 [foo] DONE\n",
+		},
+		"text_component": {
+			format:   LogFormatText,
+			log:      func(l *Logger) { l.With("component", "daemon").Infof("Started (%d tasks)", 2) },
+			expected: "2021/10/08 18:09:17 [daemon] Started (2 tasks)\n",
+		},
+		"text_warning": {
+			format:   LogFormatText,
+			log:      func(l *Logger) { l.Warning("TIMEOUT", "Command took more than 1s") },
+			expected: "2021/10/08 18:09:17 TIMEOUT (Command took more than 1s)\n",
+		},
+		"text_error": {
+			format: LogFormatText,
+			log: func(l *Logger) {
+				l.With("task", "foo").With("part", 2).Error("Upload failed", errors.New("test error"))
+			},
+			expected: "2021/10/08 18:09:17 [foo] ERROR (Upload failed): test error\n",
+		},
+		"json_info": {
+			format:   LogFormatJSON,
+			log:      func(l *Logger) { l.With("task", "foo").With("stream", "stderr").Info("some \"output\"") },
+			expected: `{"time":"2021-10-08T18:09:17Z","level":"info","msg":"some \"output\"","task":"foo","stream":"stderr"}` + "\n",
+		},
+		"json_error": {
+			format: LogFormatJSON,
+			log: func(l *Logger) {
+				l.With("task", "foo").With("part", int64(2)).With("error_code", testCode(1)).Error("Upload failed", errors.New("test error"))
+			},
+			expected: `{"time":"2021-10-08T18:09:17Z","level":"error","msg":"Upload failed","task":"foo","part":2,"error_code":"test_code","error":"test error"}` + "\n",
+		},
+		"json_replaced_field": {
+			format: LogFormatJSON,
+			log: func(l *Logger) {
+				l.With("phase", "upload").With("phase", "command").Warning("TIMEOUT", "Command took more than 1s")
+			},
+			expected: `{"time":"2021-10-08T18:09:17Z","level":"warning","msg":"Command took more than 1s","phase":"command"}` + "\n",
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			logger, buf := newFixedLogger(tc.format)
+			tc.log(logger)
+			if buf.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestLoggerWithDoesNotAlterParent(t *testing.T) {
+	t.Parallel()
+
+	logger, buf := newFixedLogger(LogFormatText)
+	logger.With("task", "foo")
+	logger.Info("DONE")
+
+	if expected := "2021/10/08 18:09:17 DONE\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+	if _, ok := logger.Field("task"); ok {
+		t.Errorf("expected no task field")
+	}
+}
+
+func TestLoggerNil(t *testing.T) {
+	t.Parallel()
+
+	var logger *Logger
+	logger.With("task", "foo").Error("Upload failed", errors.New("test error"))
+	if _, ok := logger.Field("task"); ok {
+		t.Errorf("expected no task field")
+	}
+}
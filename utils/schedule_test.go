@@ -16,6 +16,7 @@ func TestScheduleUnmarshal(t *testing.T) {
 		"weekly":                 "@weekly",
 	}
 	for name, expr := range ok {
+		expr := expr
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 			s := ScheduleExpression{}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidSize = errors.New("invalid size")
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// Parses a size such as `512`, `20 KB` or `1.5GiB`. Units are case insensitive: KB, MB, GB and TB are powers
+// of 1000, while KiB, MiB, GiB and TiB are powers of 1024.
+func ParseBytes(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	number := strings.TrimRightFunc(size, func(r rune) bool {
+		return r == ' ' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	})
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%w %q", ErrInvalidSize, size)
+	}
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(size[len(number):]))]
+	if !ok {
+		return 0, fmt.Errorf("%w %q: unknown unit", ErrInvalidSize, size)
+	}
+
+	return int64(value * unit), nil
+}
+
+// Formats a number of bytes using binary units, such as `1.5 MiB`.
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit && bytes > -unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value, exp := float64(bytes)/unit, 0
+	for value >= unit || value <= -unit {
+		value /= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTPE"[exp])
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[int64]string{
+		0:                   "0 B",
+		1023:                "1023 B",
+		1024:                "1.0 KiB",
+		1536:                "1.5 KiB",
+		20 << 10:            "20.0 KiB",
+		8 << 30:             "8.0 GiB",
+		-(3 << 20):          "-3.0 MiB",
+		9223372036854775807: "8.0 EiB",
+	}
+	for bytes, expected := range testCases {
+		if actual := FormatBytes(bytes); actual != expected {
+			t.Errorf("expected %s, got %s", expected, actual)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]int64{
+		"0":       0,
+		"512":     512,
+		"512 B":   512,
+		"20KB":    20000,
+		"20 kib":  20 << 10,
+		"1.5GiB":  3 << 29,
+		"8 GB":    8e9,
+		" 2 TiB ": 2 << 40,
+		"0.5 MiB": 1 << 19,
+	}
+	for size, expected := range testCases {
+		if actual, err := ParseBytes(size); err != nil {
+			t.Errorf("%q: unexpected error: %s", size, err)
+		} else if actual != expected {
+			t.Errorf("%q: expected %d, got %d", size, expected, actual)
+		}
+	}
+}
+
+func TestParseBytesError(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]string{
+		"":        `invalid size ""`,
+		"MiB":     `invalid size "MiB"`,
+		"-1 KB":   `invalid size "-1 KB"`,
+		"ten":     `invalid size "ten"`,
+		"20 PB":   `invalid size "20 PB": unknown unit`,
+		"2 Mbits": `invalid size "2 Mbits": unknown unit`,
+	}
+	for size, expected := range testCases {
+		if actual, err := ParseBytes(size); err == nil {
+			t.Errorf("%q: expected error, got %d", size, actual)
+		} else if !errors.Is(err, ErrInvalidSize) {
+			t.Errorf("%q: expected ErrInvalidSize, got %s", size, err)
+		} else if err.Error() != expected {
+			t.Errorf("%q: expected %s, got %s", size, expected, err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import "io"
+
+// Writer that keeps track of how many bytes were written to the underlying writer.
+type CountingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func NewCountingWriter(writer io.Writer) *CountingWriter {
+	return &CountingWriter{writer: writer}
+}
+
+func (w *CountingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.writer.Write(p)
+	w.count += int64(n)
+
+	return n, err
+}
+
+func (w CountingWriter) Count() int64 {
+	return w.count
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCountingWriter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	writer := NewCountingWriter(&buf)
+	for _, chunk := range []string{"foo", "", "bar baz\n"} {
+		if n, err := writer.Write([]byte(chunk)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		} else if n != len(chunk) {
+			t.Errorf("expected %d, got %d", len(chunk), n)
+		}
+	}
+
+	if count := writer.Count(); count != 11 {
+		t.Errorf("expected 11, got %d", count)
+	}
+	if data := buf.String(); data != "foobar baz\n" {
+		t.Errorf("expected %q, got %q", "foobar baz\n", data)
+	}
+}
+
+func TestCountingWriterError(t *testing.T) {
+	t.Parallel()
+
+	reader, pipeWriter := io.Pipe()
+	reader.Close()
+
+	writer := NewCountingWriter(pipeWriter)
+	if _, err := writer.Write([]byte("foo")); err != io.ErrClosedPipe {
+		t.Errorf("expected %s, got %v", io.ErrClosedPipe, err)
+	}
+	if count := writer.Count(); count != 0 {
+		t.Errorf("expected 0, got %d", count)
+	}
+}
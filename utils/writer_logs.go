@@ -1,37 +1,41 @@
 package utils
 
 import (
-	"log"
 	"strings"
+	"sync"
 )
 
+// Splits what is written into lines, which are collected and passed to output as soon as they are complete.
+// It is safe for concurrent use, and output is never called concurrently.
 type LogWriter struct {
+	mutex       sync.Mutex
 	currentLine string
 	lines       []string
-	logger      *log.Logger
+	output      func(line string)
 }
 
-func NewLogWriter(logger *log.Logger) *LogWriter {
+func NewLogWriter(output func(line string)) *LogWriter {
 	return &LogWriter{
-		logger: logger,
+		output: output,
 		lines:  make([]string, 0),
 	}
 }
 
 func (w *LogWriter) Write(p []byte) (n int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
 	data := strings.Split(w.currentLine+string(p), "\n")
 	w.currentLine = data[len(data)-1]
 	lines := data[:len(data)-1]
 	w.lines = append(w.lines, lines...)
 
-	if w.logger == nil {
+	if w.output == nil {
 		return len(p), nil
 	}
 
 	for _, line := range lines {
-		if err := w.logger.Output(2, line); err != nil {
-			return len(p), err
-		}
+		w.output(line)
 	}
 
 	return len(p), nil
@@ -47,6 +51,6 @@ func (w *LogWriter) Close() error {
 	return nil
 }
 
-func (w LogWriter) Lines() []string {
+func (w *LogWriter) Lines() []string {
 	return w.lines
 }
@@ -1,27 +1,17 @@
 package utils
 
 import (
-	"bytes"
-	"log"
 	"reflect"
-	"strings"
 	"testing"
 )
 
-func newTestLogger() (*log.Logger, func() []string) {
-	var buf bytes.Buffer
-	logger := log.New(&buf, "", 0)
-
-	lines := func() []string {
-		lines := strings.Split(buf.String(), "\n")
-		if lines[len(lines)-1] == "" {
-			lines = lines[:len(lines)-1]
-		}
-
-		return lines
+func newTestOutput() (func(string), func() []string) {
+	logs := []string{}
+	output := func(line string) {
+		logs = append(logs, line)
 	}
 
-	return logger, lines
+	return output, func() []string { return logs }
 }
 
 func TestLogWriter(t *testing.T) {
@@ -77,11 +67,11 @@ func TestLogWriter(t *testing.T) {
 
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			logger, lines := newTestLogger()
+			output, lines := newTestOutput()
 
 			writer := NewLogWriter(nil)
 			if tc.useUnderlyingLogger {
-				writer = NewLogWriter(logger)
+				writer = NewLogWriter(output)
 			}
 
 			for _, step := range tc.steps {